@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/utils"
+)
+
+// runConvert converts a WAV file, or raw PCM from stdin, to a WAV file with another sample format.
+func runConvert(args []string) error {
+	var inputFile, outputFile, bitDepth string
+	var sampleRate, channels int
+	fs := newFlagSet("convert")
+	fs.StringVar(&inputFile, "input-file", "", "WAV file to convert, or \"-\" for raw 16-bit little-endian PCM on stdin")
+	fs.StringVar(&outputFile, "output", "", "WAV file to write")
+	fs.StringVar(&bitDepth, "bit-depth", bitDepth16, "Sample format of the output: \"16\" (PCM) or \"32f\" (IEEE float)")
+	fs.IntVar(&sampleRate, "sample-rate", 0, "Sample rate of the raw PCM read from stdin (required with -input-file -)")
+	fs.IntVar(&channels, "channels", 0, "Channel count of the raw PCM read from stdin (required with -input-file -)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if inputFile == "" || outputFile == "" {
+		return usageError{errors.New("-input-file and -output are required")}
+	}
+	outputFormat, ok := recordingFormats[bitDepth]
+	if !ok {
+		return fmt.Errorf("invalid -bit-depth %q: must be %q or %q", bitDepth, bitDepth16, bitDepth32Float)
+	}
+
+	data, inputFormat, err := readAudioInput(inputFile, sampleRate, channels)
+	if err != nil {
+		return fmt.Errorf("error reading audio input: %w", err)
+	}
+	samples, err := utils.DecodeSamples(data, inputFormat)
+	if err != nil {
+		return fmt.Errorf("error decoding audio data: %w", err)
+	}
+
+	// Only the sample encoding changes; the rate and channel layout are kept.
+	outputFormat.SampleRate = inputFormat.SampleRate
+	outputFormat.NumChannels = inputFormat.NumChannels
+	converted, err := utils.EncodeSamples(samples, outputFormat)
+	if err != nil {
+		return fmt.Errorf("error encoding audio data: %w", err)
+	}
+
+	if err := utils.SaveAudioDataToFileWithFormat(outputFile, converted, outputFormat); err != nil {
+		return fmt.Errorf("error saving audio data to file: %w", err)
+	}
+	fmt.Printf("Converted %d samples to %s\n", len(samples), outputFile)
+
+	return nil
+}
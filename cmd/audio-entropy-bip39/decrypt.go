@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/crypto"
+)
+
+// runDecrypt prints a mnemonic saved with -encrypted-out.
+func runDecrypt(args []string) error {
+	var inputFile string
+	fs := newFlagSet("decrypt")
+	fs.StringVar(&inputFile, "input-file", "", "File written by -encrypted-out")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if inputFile == "" {
+		return usageError{errors.New("-input-file is required")}
+	}
+	passphrase := os.Getenv(passphraseEnv)
+	if passphrase == "" {
+		return fmt.Errorf("a passphrase is required in $%s", passphraseEnv)
+	}
+
+	blob, err := os.ReadFile(inputFile)
+	if err != nil {
+		return err
+	}
+	mnemonic, err := crypto.DecryptWithPassphrase(blob, []byte(passphrase))
+	if err != nil {
+		return fmt.Errorf("error decrypting %s: %w", inputFile, err)
+	}
+	fmt.Printf("Mnemonic: %s\n", mnemonic)
+
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/audio"
+)
+
+// runDevices lists the audio input devices.
+func runDevices(args []string) error {
+	fs := newFlagSet("devices")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	devices, err := audio.ListInputDevices()
+	if err != nil {
+		return err
+	}
+
+	for _, device := range devices {
+		fmt.Println(formatDevice(device))
+	}
+
+	return nil
+}
+
+// formatDevice formats a line of the device list, numbered with the PortAudio index of the device, which is
+// what DeviceContext hashes, and marked with "*" for the default device.
+func formatDevice(device audio.DeviceInfo) string {
+	marker := " "
+	if device.Default {
+		marker = "*"
+	}
+	return fmt.Sprintf("%s %d: %s (%s, %d channels, %.0f Hz)", marker, device.Index, device.Name, device.HostAPI, device.MaxInputChannels, device.DefaultSampleRate)
+}
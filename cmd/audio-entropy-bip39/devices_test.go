@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/audio"
+)
+
+func TestFormatDevice(t *testing.T) {
+	// The device list skips output-only devices, so its positions differ from the PortAudio indices.
+	tests := []struct {
+		device audio.DeviceInfo
+		want   string
+	}{
+		{audio.DeviceInfo{Index: 3, Name: "USB Microphone", HostAPI: "ALSA", MaxInputChannels: 1, DefaultSampleRate: 48000, Default: true}, "* 3: USB Microphone (ALSA, 1 channels, 48000 Hz)"},
+		{audio.DeviceInfo{Index: 7, Name: "Line In", HostAPI: "JACK", MaxInputChannels: 2, DefaultSampleRate: 44100}, "  7: Line In (JACK, 2 channels, 44100 Hz)"},
+	}
+	for _, tt := range tests {
+		if got := formatDevice(tt.device); got != tt.want {
+			t.Errorf("formatDevice(%+v) = %q, want %q", tt.device, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/audio"
+)
+
+// runDiag prints diagnostics about the audio setup.
+func runDiag(args []string) error {
+	fs := newFlagSet("diag")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	fmt.Printf("PortAudio: %s\n", audio.PortAudioVersion())
+
+	devices, err := audio.ListInputDevices()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Input devices: %d\n", len(devices))
+
+	for _, device := range devices {
+		if device.Default {
+			fmt.Printf("Default input device: %s (%s, %d channels, %.0f Hz)\n", device.Name, device.HostAPI, device.MaxInputChannels, device.DefaultSampleRate)
+			return nil
+		}
+	}
+	fmt.Println("Default input device: none")
+
+	return nil
+}
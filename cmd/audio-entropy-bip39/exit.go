@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/audio"
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/crypto"
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/utils"
+)
+
+// Exit codes of the tool, by category of error (see exitCode).
+const (
+	exitError      = 1 // Any other error
+	exitUsage      = 2 // Unknown command, invalid flags, or an invalid combination of flags
+	exitNoDevice   = 3 // No audio input device, or a build without audio support
+	exitLowEntropy = 4 // Not enough entropy: no audio captured, or an unavailable or weak entropy source
+)
+
+// quietErrors is set by -quiet-errors: errors are printed as a single line without the log timestamp.
+var quietErrors bool
+
+// newFlagSet returns the flag set of a command, with the flags every command accepts: -quiet-errors, which can
+// also be given before the command.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.BoolVar(&quietErrors, "quiet-errors", quietErrors, "Print errors as a single line without the log timestamp, for scripts")
+	return fs
+}
+
+// usageError marks an error in the command line, such as an invalid combination of flags.
+type usageError struct {
+	error
+}
+
+// Unwrap returns the error in the command line.
+func (e usageError) Unwrap() error {
+	return e.error
+}
+
+// noDeviceErrors and lowEntropyErrors are the errors of the exitNoDevice and exitLowEntropy categories.
+var (
+	noDeviceErrors   = []error{audio.ErrNoInputDevice, audio.ErrAudioUnavailable}
+	lowEntropyErrors = []error{audio.ErrNoAudioCaptured, crypto.ErrEntropyUnavailable, crypto.ErrWeakSystemEntropy, utils.ErrNoTimingEntropy, utils.ErrShortEntropyRead}
+)
+
+// exitCode returns the exit code of the category of err.
+func exitCode(err error) int {
+	var usage usageError
+	switch {
+	case errors.As(err, &usage):
+		return exitUsage
+	case isAny(err, noDeviceErrors):
+		return exitNoDevice
+	case isAny(err, lowEntropyErrors):
+		return exitLowEntropy
+	}
+	return exitError
+}
+
+// isAny reports whether err matches any of the targets.
+func isAny(err error, targets []error) bool {
+	for _, target := range targets {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// exitWith prints err and exits with the exit code of its category. With -quiet-errors, the error is printed
+// on a single line, without the log timestamp, for scripts.
+func exitWith(err error) {
+	if quietErrors {
+		fmt.Fprintf(os.Stderr, "error: %s\n", strings.ReplaceAll(err.Error(), "\n", "; "))
+	} else {
+		log.Print(err)
+	}
+	os.Exit(exitCode(err))
+}
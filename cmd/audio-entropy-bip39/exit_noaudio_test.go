@@ -0,0 +1,14 @@
+//go:build noaudio
+
+package main
+
+import "testing"
+
+func TestExitCodesNoAudio(t *testing.T) {
+	// A build without audio support has no input device to record from or list.
+	for _, args := range [][]string{{"devices"}, {"diag"}, {"record", "-stdout=false", "-mnemonic-out="}} {
+		if code, stderr := runMain(t, t.TempDir(), args...); code != exitNoDevice {
+			t.Errorf("exit code of %q = %d, want %d\n%s", args, code, exitNoDevice, stderr)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/audio"
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/crypto"
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/utils"
+)
+
+// mainArgsEnv holds the arguments of main when the test binary runs it in a subprocess (see runMain).
+const mainArgsEnv = "AEB_TEST_MAIN_ARGS"
+
+// TestMain runs main instead of the tests when runMain starts the test binary in a subprocess.
+func TestMain(m *testing.M) {
+	if args, ok := os.LookupEnv(mainArgsEnv); ok {
+		os.Args = append([]string{"audio-entropy-bip39"}, strings.Split(args, "\n")...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runMain runs main with args in a subprocess in dir, and returns its exit code and standard error.
+func runMain(t *testing.T, dir string, args ...string) (int, string) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0])
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), mainArgsEnv+"="+strings.Join(args, "\n"))
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		t.Fatalf("running main %q: %v", args, err)
+	}
+	return cmd.ProcessState.ExitCode(), stderr.String()
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{errors.New("disk full"), exitError},
+		{usageError{errors.New("-words 13")}, exitUsage},
+		{fmt.Errorf("record: %w", usageError{errors.New("-words 13")}), exitUsage},
+		{fmt.Errorf("record: %w", audio.ErrNoInputDevice), exitNoDevice},
+		{fmt.Errorf("devices: %w", audio.ErrAudioUnavailable), exitNoDevice},
+		{fmt.Errorf("record: %w", audio.ErrNoAudioCaptured), exitLowEntropy},
+		{fmt.Errorf("record: error generating entropy: %w", crypto.ErrEntropyUnavailable), exitLowEntropy},
+		{fmt.Errorf("record: %w", crypto.ErrWeakSystemEntropy), exitLowEntropy},
+		{fmt.Errorf("record: %w", utils.ErrNoTimingEntropy), exitLowEntropy},
+		{fmt.Errorf("record: %w", utils.ErrShortEntropyRead), exitLowEntropy},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	if err := utils.SaveAudioDataToFile(filepath.Join(dir, "empty.wav"), nil); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{[]string{"bogus"}, exitUsage},
+		{[]string{"record", "-no-such-flag"}, exitUsage},
+		{[]string{"record", "-words", "13"}, exitUsage},
+		{[]string{"convert"}, exitUsage},
+		{[]string{"record", "-input-file", "empty.wav", "-stdout=false", "-mnemonic-out="}, exitLowEntropy},
+		{[]string{"decrypt", "-input-file", "missing.enc"}, exitError},
+	}
+	for _, tt := range tests {
+		if code, stderr := runMain(t, dir, tt.args...); code != tt.want {
+			t.Errorf("exit code of %q = %d, want %d\n%s", tt.args, code, tt.want, stderr)
+		}
+	}
+}
+
+func TestQuietErrors(t *testing.T) {
+	dir := t.TempDir()
+	// -quiet-errors is accepted before the command and among its flags.
+	for _, args := range [][]string{
+		{"-quiet-errors", "record", "-words", "13"},
+		{"record", "-quiet-errors", "-words", "13"},
+		{"-quiet-errors", "-words", "13"},
+	} {
+		code, stderr := runMain(t, dir, args...)
+		if code != exitUsage {
+			t.Errorf("exit code of %q = %d, want %d", args, code, exitUsage)
+		}
+		if want := "error: record: invalid -words 13: must be 12, 15, 18, 21 or 24\n"; stderr != want {
+			t.Errorf("stderr of %q = %q, want %q", args, stderr, want)
+		}
+	}
+
+	// Without it, the error is logged with its timestamp.
+	if _, stderr := runMain(t, dir, "record", "-words", "13"); strings.HasPrefix(stderr, "error: ") || !strings.Contains(stderr, "invalid -words 13") {
+		t.Errorf("stderr without -quiet-errors = %q, want the logged error", stderr)
+	}
+}
@@ -0,0 +1,700 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/audio"
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/crypto"
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/utils"
+)
+
+// validateInput checks the flags of the input stage, which reads or records the audio and hashes it.
+func (c *recordConfig) validateInput() error {
+	if c.gain <= 0 {
+		return fmt.Errorf("invalid -gain %v: must be positive", c.gain)
+	}
+	if c.channels < 0 {
+		return fmt.Errorf("invalid -channels %d: must be positive", c.channels)
+	}
+	if c.swapChannels && (c.channels != 2 || c.inputFile != "") {
+		return errors.New("-swap-channels requires recording with -channels 2")
+	}
+	if c.inputFile2 != "" && (c.inputFile == "" || c.inputFile2 == "-") {
+		return errors.New("-input-file-2 requires -input-file and must be a WAV file")
+	}
+	if c.inputFile2 != "" && c.brainSong {
+		return errors.New("-input-file-2 cannot be combined with -brain-song")
+	}
+	if c.appendTo != "" && c.inputFile != "" {
+		return errors.New("-append-to cannot be combined with -input-file")
+	}
+	if c.refresh < 0 {
+		return fmt.Errorf("invalid -refresh %v: must not be negative", c.refresh)
+	}
+	if c.meterSmoothing < 0 || c.meterSmoothing >= 1 {
+		return fmt.Errorf("invalid -meter-smoothing %v: must be at least 0 and below 1", c.meterSmoothing)
+	}
+	if c.loopSleep < 0 {
+		return fmt.Errorf("invalid -loop-sleep %v: must not be negative", c.loopSleep)
+	}
+	if c.barCeiling <= 0 || c.barCeiling > 1 {
+		return fmt.Errorf("invalid -bar-ceiling %v: must be greater than 0 and at most 1", c.barCeiling)
+	}
+	if err := audio.ValidateBackend(c.backend); err != nil {
+		return err
+	}
+	if err := audio.ValidateCaptureFormat(c.captureFormat); err != nil {
+		return err
+	}
+	if err := audio.ValidateLatency(c.latency); err != nil {
+		return err
+	}
+	if err := audio.ValidateOverflowPolicy(c.overflowPolicy); err != nil {
+		return err
+	}
+	if c.mains != audio.Mains50Hz && c.mains != audio.Mains60Hz {
+		return fmt.Errorf("invalid -mains %d: must be %d or %d", c.mains, audio.Mains50Hz, audio.Mains60Hz)
+	}
+	if c.maxRepeatedBuffers < 0 {
+		return fmt.Errorf("invalid -max-repeated-buffers %d: must not be negative", c.maxRepeatedBuffers)
+	}
+	if c.maxOverflowRatio < 0 || c.maxOverflowRatio > 1 {
+		return fmt.Errorf("invalid -max-overflow-ratio %v: must be between 0 and 1", c.maxOverflowRatio)
+	}
+	if c.bindDevice && c.inputFile != "" {
+		return errors.New("-bind-device cannot be combined with -input-file")
+	}
+	if c.monitor && c.inputFile != "" {
+		return errors.New("-monitor cannot be combined with -input-file")
+	}
+	if c.streamTo != "" && c.inputFile != "" {
+		return errors.New("-stream-to cannot be combined with -input-file")
+	}
+	if c.allowRemote && c.streamTo == "" {
+		return errors.New("-allow-remote requires -stream-to")
+	}
+	if c.timingEntropy && c.inputFile != "" {
+		return errors.New("-timing-entropy cannot be combined with -input-file")
+	}
+	if c.minDuration < 0 {
+		return fmt.Errorf("invalid -min-duration %v: must not be negative", c.minDuration)
+	}
+	if c.stopOnSilence < 0 {
+		return fmt.Errorf("invalid -stop-on-silence %v: must not be negative", c.stopOnSilence)
+	}
+	if c.silenceThreshold <= 0 || c.silenceThreshold > 1 {
+		return fmt.Errorf("invalid -silence-threshold %v: must be above 0 and at most 1", c.silenceThreshold)
+	}
+	if c.clips < 1 {
+		return fmt.Errorf("invalid -clips %d: must be at least 1", c.clips)
+	}
+	if c.clips > 1 && c.inputFile != "" {
+		return errors.New("-clips cannot be combined with -input-file")
+	}
+	if c.saveClips && c.inputFile != "" {
+		return errors.New("-save-clips cannot be combined with -input-file")
+	}
+	if c.warmup < 0 {
+		return fmt.Errorf("invalid -warmup %d: must not be negative", c.warmup)
+	}
+	if c.decimate < 1 {
+		return fmt.Errorf("invalid -decimate %d: must be at least 1", c.decimate)
+	}
+	if _, ok := recordingFormats[c.bitDepth]; !ok {
+		return fmt.Errorf("invalid -bit-depth %q: must be %q or %q", c.bitDepth, bitDepth16, bitDepth32Float)
+	}
+	if _, ok := byteOrders[c.endianness]; !ok {
+		return fmt.Errorf("invalid -endianness %q: must be %q or %q", c.endianness, endiannessLittle, endiannessBig)
+	}
+	if c.hashScope != hashScopePCM && c.hashScope != hashScopeWAV {
+		return fmt.Errorf("invalid -hash-scope %q: must be %q or %q", c.hashScope, hashScopePCM, hashScopeWAV)
+	}
+	// The WAV file holds the saved samples, so the hash would depend on how they were transformed.
+	if c.hashScope == hashScopeWAV && (c.gain != 1 || c.dither || c.swapChannels) {
+		return errors.New("-hash-scope wav cannot be combined with -gain, -dither or -swap-channels, which change the saved samples")
+	}
+	return nil
+}
+
+// capturedAudio is the audio obtained by the input stage, read from an input or recorded, and its hash.
+type capturedAudio struct {
+	// data is the audio data that is hashed; saved is the audio data written to disk. They differ when gain,
+	// downmixing or decimation is applied.
+	data, saved []byte
+	// samples are used to analyze the audio and are nil if the input format cannot be decoded, and samples2
+	// are the samples of -input-file-2.
+	samples, samples2 []float32
+	format            utils.WAVFormat
+	deviceContext     crypto.DeviceContext
+	// hash is the audio hash, already computed during the recording when hashed is set.
+	hash             [32]byte
+	hashed           bool
+	discardedBuffers int
+	removedDC        float64
+	timingEntropy    []byte
+	topUp            []byte
+}
+
+// readInput reads the audio of -input-file. The samples are only transformed and encoded again for
+// -remove-dc, -downmix and -decimate.
+func (c *recordConfig) readInput() (*capturedAudio, error) {
+	data, format, err := readAudioInput(c.inputFile, c.sampleRate, c.channels)
+	if err != nil {
+		return nil, fmt.Errorf("error reading audio input: %w", err)
+	}
+	in := &capturedAudio{data: data, saved: data, format: format}
+	c.debugPrint("Read %d bytes of audio from %s\n", len(data), c.inputFile)
+
+	in.samples, err = utils.DecodeSamples(data, format)
+	if err != nil {
+		// Transforming requires the samples; without it, an undecodable input is still hashed as is.
+		if c.transformsHashedSamples() {
+			return nil, fmt.Errorf("error decoding audio data: %w", err)
+		}
+		c.debugPrint("Cannot analyze the audio input: %v\n", err)
+	} else if c.transformsHashedSamples() {
+		in.samples, in.removedDC = c.removeDCOffset(in.samples, format.NumChannels)
+		if c.removeDC {
+			if in.saved, err = utils.EncodeSamples(in.samples, format); err != nil {
+				return nil, fmt.Errorf("error encoding audio data: %w", err)
+			}
+		}
+		in.data = utils.Float32ToByteSlice(c.hashedSamples(in.samples, format.NumChannels))
+	}
+	return in, nil
+}
+
+// captureAudio records the audio from the default input device.
+func (c *recordConfig) captureAudio() (*capturedAudio, error) {
+	channels, err := c.inputChannels()
+	if err != nil {
+		return nil, err
+	}
+
+	// Initialize the audio stream.
+	stream, cleanup, err := audio.NewInputStream(c.backend, buffersize, channels, c.captureFormat, c.latency)
+	if err != nil {
+		return nil, fmt.Errorf("error creating audio stream: %w", err)
+	}
+	defer cleanup()
+
+	return c.recordInput(stream, channels)
+}
+
+// recordInput records the audio from a stream of the given channel count, with the gain, channel swap, dither
+// and clips of the flags, and appends it to -append-to if set.
+func (c *recordConfig) recordInput(stream audio.AudioStream, channels int) (*capturedAudio, error) {
+	in := &capturedAudio{format: recordingFormats[c.bitDepth]}
+	in.format.NumChannels = channels
+
+	// Clear the screen before starting the audio recording if debug mode is enabled.
+	c.clearScreen()
+
+	// Suggest a recording length from a short probe of the ambient noise if requested.
+	if c.estimate {
+		fmt.Println("Probing the ambient noise...")
+		probe, err := audio.RecordAudioWithOptions(stream, audio.CalculateVolume, audio.RecordOptions{Gain: float32(c.gain), Channels: channels, Refresh: c.refresh, Duration: probeDuration, BarCeiling: float32(c.barCeiling), LoopSleep: c.loopSleep, Smoothing: c.meterSmoothing, Color: c.colorEnabled()})
+		if err != nil {
+			return nil, fmt.Errorf("error probing audio: %w", err)
+		}
+		level := audio.EntropyPerSample(probe.Samples)
+		estimate := audio.EstimateRequiredDuration(level, estimateTargetBits, in.format.SampleRate*channels)
+		fmt.Printf("\nEstimated entropy: %.2f bits/sample; record about %s to collect %d bits\n", level, estimate.Round(time.Millisecond), estimateTargetBits)
+	}
+
+	// Collect the timing of random typing alongside the audio if requested.
+	var stopTiming func() ([]byte, error)
+	if c.timingEntropy {
+		fmt.Println("Type randomly, pressing Enter often, until the recording ends...")
+		stopTiming = startTimingEntropy()
+	}
+
+	onBuffer, closeStream, err := c.liveStream(channels)
+	if err != nil {
+		return nil, err
+	}
+	defer closeStream()
+
+	fmt.Println("Starting audio recording...")
+	stop, stopInterrupts := interruptRequests()
+	recording, clipLengths, err := c.recordClips(stream, audio.RecordOptions{
+		Gain:                float32(c.gain),
+		Channels:            channels,
+		Warmup:              c.warmup,
+		Refresh:             c.refresh,
+		Stop:                stop,
+		MinDuration:         c.minDuration,
+		OverflowPolicy:      c.overflowPolicy,
+		BarCeiling:          float32(c.barCeiling),
+		MaxOverflowRatio:    c.maxOverflowRatio,
+		MaxRepeatedBuffers:  c.maxRepeatedBuffers,
+		DeviceCheckInterval: c.deviceCheckInterval(),
+		LoopSleep:           c.loopSleep,
+		Smoothing:           c.meterSmoothing,
+		Prompt:              c.prompt,
+		Color:               c.colorEnabled(),
+		StopOnSilence:       c.stopOnSilence,
+		SilenceThreshold:    float32(c.silenceThreshold),
+		OnBuffer:            onBuffer,
+	})
+	stopInterrupts()
+	if stopTiming != nil {
+		var timingErr error
+		in.timingEntropy, timingErr = stopTiming()
+		if err == nil && timingErr != nil {
+			return nil, fmt.Errorf("error collecting timing entropy: %w", timingErr)
+		}
+		c.debugPrint("Collected %d bytes of timing entropy\n", len(in.timingEntropy))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error recording audio: %w", err)
+	}
+	in.discardedBuffers = recording.DiscardedBuffers
+	if in.discardedBuffers > 0 {
+		fmt.Printf("Discarded %d overflowed buffers\n", in.discardedBuffers)
+	}
+
+	recording.Samples, in.removedDC = c.removeDCOffset(recording.Samples, channels)
+
+	// Gain is a deterministic transform and adds no entropy, so the raw samples are hashed by default.
+	amplified := audio.ApplyGain(recording.Samples, float32(c.gain))
+	savedSamples := amplified
+	if c.swapChannels && channels == 2 {
+		// Swapping only fixes the saved layout; the hash uses the samples as captured.
+		savedSamples = audio.SwapChannels(amplified)
+	}
+	if c.dither && in.format.AudioFormat == utils.AudioFormatPCM {
+		// Dither only affects the saved recording; the hash uses the undithered samples.
+		in.saved = utils.DitherQuantize16(savedSamples)
+	} else {
+		in.saved, err = utils.EncodeSamplesWithOrder(savedSamples, in.format, byteOrders[c.endianness])
+		if err != nil {
+			return nil, fmt.Errorf("error encoding audio data: %w", err)
+		}
+	}
+
+	// Save every clip as it appears in the saved recording if requested.
+	if c.saveClips {
+		if err := saveClips(in.saved, clipLengths, in.format); err != nil {
+			return nil, err
+		}
+	}
+	in.samples = recording.Samples
+	hashedSamples := recording.Samples
+	if c.gainAffectsEntropy {
+		hashedSamples = amplified
+	}
+	in.data = utils.Float32ToByteSlice(c.hashedSamples(hashedSamples, channels))
+
+	// Bind the hash to the recording device if requested.
+	if c.bindDevice {
+		in.deviceContext, err = defaultDeviceContext(in.format.SampleRate)
+		if err != nil {
+			return nil, fmt.Errorf("error identifying the recording device: %w", err)
+		}
+		c.debugPrint("Binding the audio hash to device %d (%s)\n", in.deviceContext.Index, in.deviceContext.Name)
+	}
+
+	// The recording already hashed the raw samples as they were captured.
+	if !c.gainAffectsEntropy && !c.transformsHashedSamples() && !c.bindDevice {
+		in.hash, in.hashed = recording.Digest, true
+	}
+
+	// Continue a partial recording: the combined audio is saved and hashed, as for an input file.
+	if c.appendTo != "" {
+		combined, err := utils.AppendAudioDataToFile(c.appendTo, in.saved, in.format)
+		if err != nil {
+			return nil, fmt.Errorf("error appending to %s: %w", c.appendTo, err)
+		}
+		c.debugPrint("Appended %d bytes of audio to %s, %d bytes in total\n", len(in.saved), c.appendTo, len(combined))
+		in.saved, in.data = combined, combined
+		in.samples, err = utils.DecodeSamples(combined, in.format)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding audio data: %w", err)
+		}
+		if c.transformsHashedSamples() {
+			in.data = utils.Float32ToByteSlice(c.hashedSamples(in.samples, channels))
+		}
+		in.hashed = false
+	}
+
+	// Clear the screen after stopping the audio recording if debug mode is enabled.
+	c.clearScreen()
+
+	// Play back what was captured, as it will be saved.
+	if c.playback {
+		if err := playBack(audio.DownmixToMono(amplified, channels)); err != nil {
+			return nil, fmt.Errorf("error playing back audio: %w", err)
+		}
+	}
+	return in, nil
+}
+
+// processInput checks and reports on the audio, hashes it together with -input-file-2, tops it up with the
+// system RNG and saves its report, as requested by the flags.
+func (c *recordConfig) processInput(in *capturedAudio) error {
+	// The hash of no audio adds nothing, so fall back to the system RNG alone only if allowed.
+	if len(in.data) == 0 {
+		if !c.allowEmptyAudio {
+			return fmt.Errorf("%w: check the input device, or use -allow-empty-audio to rely on the system RNG alone", audio.ErrNoAudioCaptured)
+		}
+		fmt.Fprintln(os.Stderr, "Warning: no audio was captured, the mnemonic only depends on the system RNG")
+	}
+
+	// Report on the suitability of the audio as an entropy source.
+	if in.samples != nil {
+		printQualityReport(audio.AnalyzeQualityWithMains(in.samples, in.data, in.format.NumChannels, in.format.SampleRate, float64(c.mains)))
+	}
+
+	// Show the waveform, so that silence or a disconnected microphone is obvious.
+	if c.waveform && in.samples != nil {
+		mono := audio.DownmixToMono(in.samples, in.format.NumChannels)
+		fmt.Println(audio.RenderWaveform(mono, audio.WaveformWidth, audio.WaveformHeight))
+	}
+
+	if c.hashScope == hashScopeWAV {
+		// The header binds the format and length of the audio to the hash, though it adds no entropy.
+		c.debugPrint("Hashing the WAV file...\n")
+		wav, err := utils.EncodeWAV(in.saved, in.format)
+		if err != nil {
+			return fmt.Errorf("error encoding WAV file: %w", err)
+		}
+		in.hash = crypto.HashAudioDataWithContext(wav, in.deviceContext)
+	} else if !in.hashed {
+		c.debugPrint("Hashing recorded audio data...\n")
+		in.hash = crypto.HashAudioDataWithContext(in.data, in.deviceContext)
+	}
+
+	// Combine the audio of a second participant, hashed independently of the first one.
+	// The samples are only used to estimate its entropy, and are nil if its format cannot be decoded.
+	if c.inputFile2 != "" {
+		audioData2, format2, err := readAudioInput(c.inputFile2, 0, 0)
+		if err != nil {
+			return fmt.Errorf("error reading audio input: %w", err)
+		}
+		c.debugPrint("Read %d bytes of audio from %s\n", len(audioData2), c.inputFile2)
+		in.hash = crypto.CombineAudioHashes(in.hash, crypto.HashAudioData(audioData2))
+		if in.samples2, err = utils.DecodeSamples(audioData2, format2); err != nil {
+			c.debugPrint("Cannot analyze the second audio input: %v\n", err)
+		}
+	}
+
+	// Make up for too short audio with the system RNG if requested.
+	if c.topUp {
+		var err error
+		in.topUp, err = topUpEntropy(in.samples)
+		if err != nil {
+			return fmt.Errorf("error topping up entropy: %w", err)
+		}
+	}
+
+	// Save the audit report of the audio if requested.
+	if c.report {
+		if in.samples == nil {
+			return errors.New("-report requires an audio input that can be decoded")
+		}
+		fmt.Println("Saving report to file...")
+		report := newReport(in.samples, in.data, in.format, in.discardedBuffers, len(in.topUp), in.removedDC, in.hash, c.mains)
+		if err := utils.SaveReportToJSON(savedReportFilename, report); err != nil {
+			return fmt.Errorf("error saving report to file: %w", err)
+		}
+	}
+	return nil
+}
+
+// deviceCheckInterval returns the interval between checks of the input device, zero unless
+// -abort-on-device-change is set.
+func (c *recordConfig) deviceCheckInterval() time.Duration {
+	if !c.abortOnDevice {
+		return 0
+	}
+	return deviceCheckPeriod
+}
+
+// transformsHashedSamples reports whether the hashed samples differ from the captured or read ones.
+func (c *recordConfig) transformsHashedSamples() bool {
+	return c.downmix || c.decimate > 1 || c.removeDC
+}
+
+// removeDCOffset subtracts the DC offset of interleaved samples if -remove-dc is set, and returns the samples
+// with the offset that was removed.
+func (c *recordConfig) removeDCOffset(samples []float32, channels int) ([]float32, float64) {
+	if !c.removeDC {
+		return samples, 0
+	}
+	before := audio.DCOffset(samples)
+	samples = audio.RemoveDC(samples, channels)
+	fmt.Printf("DC offset: %.4f before removal, %.4f after\n", before, audio.DCOffset(samples))
+	return samples, before
+}
+
+// hashedSamples applies the downmixing and decimation to interleaved samples before they are hashed.
+func (c *recordConfig) hashedSamples(samples []float32, channels int) []float32 {
+	if c.downmix && channels > 1 {
+		samples = audio.DownmixToMono(samples, channels)
+		channels = 1
+	}
+	return audio.Decimate(samples, channels, c.decimate)
+}
+
+// readAudioInput reads audio data from a WAV file, or raw PCM from stdin when inputFile is "-".
+func readAudioInput(inputFile string, sampleRate, channels int) ([]byte, utils.WAVFormat, error) {
+	if inputFile != "-" {
+		return utils.LoadAudioDataFromFileWithFormat(inputFile)
+	}
+
+	// Raw PCM has no header, so the format must be given explicitly.
+	if sampleRate <= 0 || channels <= 0 {
+		return nil, utils.WAVFormat{}, errors.New("-sample-rate and -channels are required when reading PCM from stdin")
+	}
+
+	format := utils.WAVFormat{AudioFormat: utils.AudioFormatPCM, SampleRate: sampleRate, NumChannels: channels, BitsPerSample: 16}
+	data, err := utils.ReadPCM(os.Stdin, format)
+	if err != nil {
+		return nil, utils.WAVFormat{}, err
+	}
+	return data, format, nil
+}
+
+// defaultDeviceContext identifies the default input device, which records the audio.
+func defaultDeviceContext(sampleRate int) (crypto.DeviceContext, error) {
+	devices, err := audio.ListInputDevices()
+	if err != nil {
+		return crypto.DeviceContext{}, err
+	}
+	for _, device := range devices {
+		if device.Default {
+			return crypto.DeviceContext{Name: device.Name, Index: device.Index, SampleRate: sampleRate}, nil
+		}
+	}
+	return crypto.DeviceContext{}, errors.New("no default input device")
+}
+
+// inputChannels returns the channel count to record: -channels, or mono by default. If the default input device
+// supports fewer channels, it falls back to the device maximum with a warning, or fails with -strict.
+// If the device cannot be queried, the requested count is kept and opening the stream reports the problem.
+func (c *recordConfig) inputChannels() (int, error) {
+	channels := c.channels
+	if channels <= 1 {
+		return 1, nil
+	}
+	// miniaudio converts the channels of the device to the requested count itself.
+	if c.backend == audio.BackendMalgo {
+		return channels, nil
+	}
+	available, err := audio.DefaultInputChannels()
+	if err != nil {
+		return channels, nil
+	}
+	return fallbackChannels(channels, available, c.strict, os.Stderr)
+}
+
+// fallbackChannels returns the channel count to record when channels are requested from a device that supports
+// at most available: the requested count if the device supports it, otherwise the device maximum with a warning
+// written to warn, or an error if strict is set.
+func fallbackChannels(channels, available int, strict bool, warn io.Writer) (int, error) {
+	if available < 1 || available >= channels {
+		return channels, nil
+	}
+	if strict {
+		return 0, fmt.Errorf("%w: -channels %d, but the default input device supports at most %d", audio.ErrUnsupportedChannels, channels, available)
+	}
+	fmt.Fprintf(warn, "Warning: the default input device supports at most %d channels, recording %d instead of %d\n", available, available, channels)
+	return available, nil
+}
+
+// recordClips records the clips of -clips one after the other, each with opts, and returns them joined into a
+// single recording with the number of samples of each clip. Stop requests only end the current clip early.
+func (c *recordConfig) recordClips(stream audio.AudioStream, opts audio.RecordOptions) (*audio.Recording, []int, error) {
+	if c.clips == 1 {
+		recording, err := audio.RecordAudioWithOptions(stream, audio.CalculateVolume, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		return recording, []int{len(recording.Samples)}, nil
+	}
+
+	clips := make([]*audio.Recording, 0, c.clips)
+	lengths := make([]int, 0, c.clips)
+	for i := 1; i <= c.clips; i++ {
+		fmt.Printf("Recording clip %d of %d...\n", i, c.clips)
+		clip, err := audio.RecordAudioWithOptions(stream, audio.CalculateVolume, opts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("clip %d: %w", i, err)
+		}
+		clips = append(clips, clip)
+		lengths = append(lengths, len(clip.Samples))
+	}
+	return audio.ConcatRecordings(clips), lengths, nil
+}
+
+// saveClips saves the encoded audio data of consecutive clips, of the given numbers of samples, to numbered
+// WAV files.
+func saveClips(data []byte, clipLengths []int, format utils.WAVFormat) error {
+	fmt.Printf("Saving %d clips to files...\n", len(clipLengths))
+	bytesPerSample := format.BitsPerSample / 8
+	offset := 0
+	for i, length := range clipLengths {
+		end := offset + length*bytesPerSample
+		if err := utils.SaveAudioDataToFileWithFormat(fmt.Sprintf(savedClipFilename, i+1), data[offset:end], format); err != nil {
+			return fmt.Errorf("error saving clip %d to file: %w", i+1, err)
+		}
+		offset = end
+	}
+	return nil
+}
+
+// startTimingEntropy starts collecting timing entropy from stdin, and returns a function that stops the
+// collection and returns the entropy.
+func startTimingEntropy() func() ([]byte, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	type result struct {
+		entropy []byte
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		entropy, err := utils.CollectTimingEntropy(ctx)
+		done <- result{entropy, err}
+	}()
+	return func() ([]byte, error) {
+		cancel()
+		r := <-done
+		return r.entropy, r.err
+	}
+}
+
+// interruptRequests turns Ctrl-C into early stop requests for the recording, until the returned function is called.
+func interruptRequests() (<-chan struct{}, func()) {
+	stop := make(chan struct{}, 1)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		for range signals {
+			select {
+			case stop <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return stop, func() {
+		signal.Stop(signals)
+		close(signals)
+	}
+}
+
+// playBack plays the samples through the default output device.
+func playBack(samples []float32) error {
+	stream, cleanup, err := audio.NewConcreteOutputStream(buffersize)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	fmt.Println("Playing back the recording...")
+	_, err = audio.PlayAudio(stream, samples)
+	return err
+}
+
+// monitorLevels displays the live input levels until interrupted, without recording anything.
+func (c *recordConfig) monitorLevels() error {
+	channels, err := c.inputChannels()
+	if err != nil {
+		return err
+	}
+	stream, cleanup, err := audio.NewInputStream(c.backend, buffersize, channels, c.captureFormat, c.latency)
+	if err != nil {
+		return fmt.Errorf("error creating audio stream: %w", err)
+	}
+	defer cleanup()
+
+	onBuffer, closeStream, err := c.liveStream(channels)
+	if err != nil {
+		return err
+	}
+	defer closeStream()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return audio.MonitorLevels(ctx, stream, audio.CalculateVolume, audio.RecordOptions{Gain: float32(c.gain), Channels: channels, Refresh: c.refresh, BarCeiling: float32(c.barCeiling), LoopSleep: c.loopSleep, Smoothing: c.meterSmoothing, Color: c.colorEnabled(), OnBuffer: onBuffer})
+}
+
+// liveStream connects the UDP sink of -stream-to, and returns the buffer callback that feeds it and a function
+// that closes it. Without -stream-to, the callback is nil.
+func (c *recordConfig) liveStream(channels int) (func([]float32), func(), error) {
+	if c.streamTo == "" {
+		return nil, func() {}, nil
+	}
+	sink, err := audio.NewUDPSink(c.streamTo, channels, c.allowRemote)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error connecting live stream: %w", err)
+	}
+	fmt.Printf("Streaming live audio to %s (16-bit PCM, %d channels)\n", c.streamTo, channels)
+	closeSink := func() {
+		if err := sink.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error closing live stream: %v\n", err)
+		}
+	}
+	return sink.Send, closeSink, nil
+}
+
+// topUpEntropy returns the bytes of the system RNG that make up for the entropy the samples lack to reach
+// estimateTargetBits, or nil if they hold enough. Undecodable audio is not estimated and is fully topped up.
+func topUpEntropy(samples []float32) ([]byte, error) {
+	audioBits := audio.EstimateTotalEntropy(samples)
+	deficit := int(math.Ceil((estimateTargetBits - audioBits) / 8))
+	if deficit <= 0 {
+		return nil, nil
+	}
+	fmt.Printf("The audio holds about %.0f bits of entropy, below %d: adding %d bytes from the system RNG\n", audioBits, estimateTargetBits, deficit)
+	return crypto.RandomBytes(deficit)
+}
+
+// printQualityReport prints the audio quality report and its warnings.
+func printQualityReport(report audio.QualityReport) {
+	fmt.Printf("Audio quality: RMS %.4f, byte entropy %.2f bits/byte, spectral flatness %.3f, periodicity %.3f, DC offset %.4f, mains hum %.3f, SNR %.1f dB\n",
+		report.RMS, report.ShannonEntropy, report.SpectralFlatness, report.Periodicity, report.DCOffset, report.MainsHum, report.SNR)
+	for _, warning := range report.Warnings {
+		fmt.Printf("Warning: %s\n", warning)
+	}
+}
+
+// newReport collects the statistics of the audio for the -report file.
+func newReport(samples []float32, data []byte, format utils.WAVFormat, discardedBuffers, topUpBytes int, removedDC float64, audioHash [32]byte, mains int) utils.ReportJSON {
+	quality := audio.AnalyzeQualityWithMains(samples, data, format.NumChannels, format.SampleRate, float64(mains))
+	analysis := audio.Analyze(samples, data, audio.DefaultAnalysisThresholds)
+	frames := len(samples) / format.NumChannels
+	var snr *float64
+	if !math.IsInf(quality.SNR, 0) {
+		snr = &quality.SNR
+	}
+	return utils.ReportJSON{
+		SampleRate:       format.SampleRate,
+		Channels:         format.NumChannels,
+		Duration:         float64(frames) / float64(format.SampleRate),
+		DiscardedBuffers: discardedBuffers,
+		TopUpBytes:       topUpBytes,
+		RMS:              quality.RMS,
+		Peak:             analysis.Peak,
+		DCOffset:         analysis.DCOffset,
+		RemovedDCOffset:  removedDC,
+		ShannonEntropy:   analysis.ShannonEntropy,
+		MinEntropy:       analysis.MinEntropy,
+		SpectralFlatness: analysis.SpectralFlatness,
+		Periodicity:      quality.Periodicity,
+		MainsHum:         quality.MainsHum,
+		NoiseFloor:       quality.NoiseFloor,
+		SNR:              snr,
+		Warnings:         quality.Warnings,
+		AudioHash:        hex.EncodeToString(audioHash[:]),
+	}
+}
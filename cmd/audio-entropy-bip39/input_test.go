@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/audio"
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/crypto"
+)
+
+// withStdin replaces os.Stdin with a file holding data for the duration of the test.
+func withStdin(t *testing.T, data []byte) {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "stdin")
+	if err := os.WriteFile(filename, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin := os.Stdin
+	os.Stdin = file
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		file.Close()
+	})
+}
+
+func TestReadInputStdinPCM(t *testing.T) {
+	pcm := make([]byte, 4096)
+	for i := range pcm {
+		pcm[i] = byte(i * 7)
+	}
+	withStdin(t, pcm)
+
+	cfg := newTestConfig(t, "-input-file", "-", "-sample-rate", "8000", "-channels", "2")
+	in, err := cfg.readInput()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if in.format.SampleRate != 8000 || in.format.NumChannels != 2 || in.format.BitsPerSample != 16 {
+		t.Errorf("format = %+v, want 8000 Hz, 2 channels, 16 bits", in.format)
+	}
+	if err := cfg.processInput(in); err != nil {
+		t.Fatal(err)
+	}
+	if want := crypto.HashAudioData(pcm); in.hash != want {
+		t.Errorf("audio hash = %x, want the hash of the piped bytes %x", in.hash, want)
+	}
+}
+
+func TestReadInputStdinRequiresFormat(t *testing.T) {
+	withStdin(t, make([]byte, 16))
+	cfg := newTestConfig(t, "-input-file", "-")
+	if _, err := cfg.readInput(); err == nil {
+		t.Error("readInput of stdin without -sample-rate and -channels succeeded")
+	}
+}
+
+func TestFallbackChannels(t *testing.T) {
+	// A mono device asked for stereo falls back to mono with a warning.
+	var warn bytes.Buffer
+	if channels, err := fallbackChannels(2, 1, false, &warn); err != nil || channels != 1 {
+		t.Errorf("fallbackChannels(2, 1) = %d, %v, want 1", channels, err)
+	}
+	if !strings.Contains(warn.String(), "supports at most 1 channels, recording 1 instead of 2") {
+		t.Errorf("fallback warning = %q", warn.String())
+	}
+
+	warn.Reset()
+	if _, err := fallbackChannels(2, 1, true, &warn); !errors.Is(err, audio.ErrUnsupportedChannels) {
+		t.Errorf("fallbackChannels(2, 1) with -strict = %v, want ErrUnsupportedChannels", err)
+	}
+	for _, available := range []int{0, 2, 8} {
+		if channels, err := fallbackChannels(2, available, true, &warn); err != nil || channels != 2 {
+			t.Errorf("fallbackChannels(2, %d) = %d, %v, want 2", available, channels, err)
+		}
+	}
+	if warn.Len() != 0 {
+		t.Errorf("warnings without a fallback: %q", warn.String())
+	}
+}
@@ -1,100 +1,90 @@
 package main
 
 import (
-	"flag"
 	"fmt"
-	"log"
-
-	"github.com/gianlucamazza/audio-entropy-bip39/internal/audio"
-	"github.com/gianlucamazza/audio-entropy-bip39/internal/crypto"
-	"github.com/gianlucamazza/audio-entropy-bip39/internal/utils"
+	"os"
+	"strings"
 )
 
 const (
 	savedAudioDataFilename = "audio-data.wav"
 	savedMnemonicFilename  = "mnemonic.txt"
+	savedReportFilename    = "audio-data-report.json"
+	savedRawPCMFilename    = "audio-data.pcm"
+	savedParamsFilename    = "audio-data-params.json"
+	savedClipFilename      = "clip-%02d.wav"
 	debug                  = false
 	buffersize             = 512
-)
-
-func main() {
-	// Set the debug flag.
-	var debugMode bool
-	flag.BoolVar(&debugMode, "debug", debug, "Enable debug mode")
-	flag.Parse()
 
-	// Set the debug print function.
-	debugPrint := func(format string, args ...interface{}) {
-		if !debugMode {
-			fmt.Printf(format, args...)
-		}
-	}
-
-	// Initialize the audio stream.
-	stream, cleanup, err := audio.NewConcreteAudioStream(buffersize)
-	if err != nil {
-		log.Fatalf("Error creating audio stream: %v", err)
-	}
+	// defaultCommand is run when no subcommand is given, for backward compatibility.
+	defaultCommand = "record"
+)
 
-	defer cleanup()
+// command is a subcommand of the tool, with its own flag set.
+type command struct {
+	name        string
+	description string
+	run         func(args []string) error
+}
 
-	// Clear the screen before starting the audio recording if debug mode is enabled.
-	if !debugMode {
-		utils.ClearScreen()
-	}
+// commands lists the available subcommands.
+var commands = []command{
+	{name: "record", description: "Record audio and generate a mnemonic (default)", run: runRecord},
+	{name: "convert", description: "Convert a WAV file or raw PCM to another sample format", run: runConvert},
+	{name: "devices", description: "List the available audio input devices", run: runDevices},
+	{name: "diag", description: "Print diagnostics about the audio setup", run: runDiag},
+	{name: "decrypt", description: "Decrypt a mnemonic saved with -encrypted-out", run: runDecrypt},
+	{name: "verify", description: "Check a handwritten mnemonic against its verification word", run: runVerify},
+	{name: "selftest", description: "Run known-answer tests of the mnemonic generation", run: runSelftest},
+}
 
-	fmt.Println("Starting audio recording...")
-	audioData, err := audio.RecordAudio(stream, audio.CalculateVolume)
+func main() {
+	args := parseGlobalFlags(os.Args[1:])
+	cmd, args, err := parseCommand(args)
 	if err != nil {
-		log.Fatalf("Error recording audio: %v", err)
-	}
-
-	// Clear the screen after stopping the audio recording if debug mode is enabled.
-	if !debugMode {
-		utils.ClearScreen()
+		fmt.Fprintln(os.Stderr, err)
+		if !quietErrors {
+			printUsage()
+		}
+		os.Exit(exitUsage)
 	}
 
-	debugPrint("Generating cryptographic entropy...\n")
-	entropy, err := crypto.GenerateEntropy(256) // Assuming 256 bits for strong security.
-	if err != nil {
-		log.Fatalf("Error generating entropy: %v", err)
+	if err := cmd.run(args); err != nil {
+		exitWith(fmt.Errorf("%s: %w", cmd.name, err))
 	}
+}
 
-	debugPrint("Deriving cryptographic key...\n")
-	key, err := crypto.DeriveKey(entropy)
-	if err != nil {
-		log.Fatalf("Error deriving key: %v", err)
+// parseGlobalFlags consumes the flags given before the subcommand that apply to every command, currently only
+// -quiet-errors, and returns the remaining arguments.
+func parseGlobalFlags(args []string) []string {
+	for len(args) > 0 && (args[0] == "-quiet-errors" || args[0] == "--quiet-errors") {
+		quietErrors = true
+		args = args[1:]
 	}
+	return args
+}
 
-	// Print the generated entropy and derived key in hexadecimal.
-	debugPrint("Entropy: %x\n", entropy)
-	debugPrint("Key: %x\n", key)
-
-	debugPrint("Hashing recorded audio data...\n")
-	audioHash := crypto.HashAudioData(audioData)
-
-	debugPrint("Combining entropy with audio data hash and re-hashing...\n")
-	combinedDataHash := crypto.CombineAndHashData(entropy, audioHash[:])
-
-	debugPrint("Generating BIP-39 mnemonic from combined data hash...\n")
-	mnemonic, err := crypto.GenerateMnemonic(combinedDataHash[:])
-	if err != nil {
-		log.Fatalf("Error generating mnemonic: %v", err)
+// parseCommand selects the subcommand named by the first argument and returns it with its arguments.
+// Without a subcommand, or when the first argument is a flag, the default command is used.
+func parseCommand(args []string) (command, []string, error) {
+	name := defaultCommand
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
 
-	// Display the generated mnemonic.
-	fmt.Printf("Mnemonic: %s\n", mnemonic)
-
-	// Save audio data to file
-	fmt.Println("Saving audio data to file...")
-	if err := utils.SaveAudioDataToFile(savedAudioDataFilename, audioData); err != nil {
-		log.Fatalf("Error saving audio data to file: %v", err)
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, args, nil
+		}
 	}
+	return command{}, nil, fmt.Errorf("unknown command %q", name)
+}
 
-	// Save mnemonic to file.
-	fmt.Println("Saving mnemonic to file...")
-	if err := utils.SaveMnemonicToFile(savedMnemonicFilename, mnemonic); err != nil {
-		log.Fatalf("Error saving mnemonic to file: %v", err)
+// printUsage prints the list of subcommands.
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [-quiet-errors] [command] [flags]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.description)
 	}
-
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for the flags of a command.\n", os.Args[0])
 }
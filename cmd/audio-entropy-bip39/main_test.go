@@ -0,0 +1,61 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		args     []string
+		wantName string
+		wantArgs []string
+	}{
+		{args: nil, wantName: "record", wantArgs: nil},
+		{args: []string{"-debug", "-words", "12"}, wantName: "record", wantArgs: []string{"-debug", "-words", "12"}},
+		{args: []string{"record", "-words", "12"}, wantName: "record", wantArgs: []string{"-words", "12"}},
+		{args: []string{"convert", "-input-file", "in.wav"}, wantName: "convert", wantArgs: []string{"-input-file", "in.wav"}},
+		{args: []string{"devices"}, wantName: "devices", wantArgs: []string{}},
+		{args: []string{"diag"}, wantName: "diag", wantArgs: []string{}},
+		{args: []string{"decrypt", "out.enc"}, wantName: "decrypt", wantArgs: []string{"out.enc"}},
+		{args: []string{"verify", "-word", "zoo"}, wantName: "verify", wantArgs: []string{"-word", "zoo"}},
+		{args: []string{"selftest"}, wantName: "selftest", wantArgs: []string{}},
+	}
+	for _, tt := range tests {
+		cmd, args, err := parseCommand(tt.args)
+		if err != nil {
+			t.Errorf("parseCommand(%q): %v", tt.args, err)
+			continue
+		}
+		if cmd.name != tt.wantName {
+			t.Errorf("parseCommand(%q) = %q, want %q", tt.args, cmd.name, tt.wantName)
+		}
+		if len(args) != 0 || len(tt.wantArgs) != 0 {
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("parseCommand(%q) args = %q, want %q", tt.args, args, tt.wantArgs)
+			}
+		}
+	}
+}
+
+func TestParseCommandUnknown(t *testing.T) {
+	if _, _, err := parseCommand([]string{"bogus"}); err == nil {
+		t.Error("parseCommand(bogus) succeeded, want an error")
+	}
+}
+
+func TestCommandsHaveRunners(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, cmd := range commands {
+		if cmd.run == nil {
+			t.Errorf("command %q has no runner", cmd.name)
+		}
+		if seen[cmd.name] {
+			t.Errorf("command %q is listed twice", cmd.name)
+		}
+		seen[cmd.name] = true
+	}
+	if !seen[defaultCommand] {
+		t.Errorf("default command %q is not listed", defaultCommand)
+	}
+}
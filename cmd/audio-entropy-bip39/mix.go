@@ -0,0 +1,434 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/audio"
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/crypto"
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/utils"
+	"github.com/gianlucamazza/audio-entropy-bip39/pkg/aeb"
+)
+
+// validateMix checks the flags of the mix stage, which derives the mnemonics from the audio hash and the
+// other sources of entropy.
+func (c *recordConfig) validateMix() error {
+	if c.hkdfSalt != hkdfSaltNone && c.hkdfSalt != hkdfSaltAudio {
+		return fmt.Errorf("invalid -hkdf-salt %q: must be %q or %q", c.hkdfSalt, hkdfSaltNone, hkdfSaltAudio)
+	}
+	if c.useDerivedKey && c.hkdfSalt != hkdfSaltAudio {
+		// Without the audio salt, the derived key would not depend on the audio at all.
+		return fmt.Errorf("-use-derived-key requires -hkdf-salt %s", hkdfSaltAudio)
+	}
+	if c.keyFormat != "" {
+		if err := crypto.ValidateKeyFormat(c.keyFormat); err != nil {
+			return err
+		}
+		if !c.useDerivedKey {
+			return errors.New("-key-format requires -use-derived-key")
+		}
+	}
+	if c.password < 0 || c.password > crypto.MaxPasswordLength {
+		return fmt.Errorf("invalid -password %d: must be 0 (off) or between 1 and %d", c.password, crypto.MaxPasswordLength)
+	}
+	if err := crypto.ValidatePasswordAlphabet(c.passwordAlphabet); err != nil {
+		return err
+	}
+	if err := crypto.ValidateSchemeVersion(c.schemeVersion); err != nil {
+		return err
+	}
+	if strings.ContainsRune(c.personalization, 0) {
+		return errors.New("invalid -personalize: must not contain NUL characters")
+	}
+	if c.personalization != "" && (c.brainSong || c.split != "") {
+		return errors.New("-personalize cannot be combined with -brain-song or -split, which do not use the scheme tag")
+	}
+	if c.brainSong && (c.useDerivedKey || c.extraEntropy != "" || c.timingEntropy || c.topUp) {
+		return errors.New("-brain-song cannot be combined with -use-derived-key, -extra-entropy, -timing-entropy or -topup")
+	}
+	if c.brainSongRounds < 1 {
+		return fmt.Errorf("invalid -brain-song-iterations %d: must be at least 1", c.brainSongRounds)
+	}
+	if c.hashRounds < 1 {
+		return fmt.Errorf("invalid -hash-rounds %d: must be at least 1", c.hashRounds)
+	}
+	if c.order != orderRNGFirst && c.order != orderAudioFirst {
+		return fmt.Errorf("invalid -order %q: must be %q or %q", c.order, orderRNGFirst, orderAudioFirst)
+	}
+	if c.order != orderRNGFirst && (c.useDerivedKey || c.split != "" || c.brainSong) {
+		return errors.New("-order cannot be combined with -use-derived-key, -split or -brain-song, which do not hash the combined data")
+	}
+	if c.extraEntropyBytes <= 0 {
+		return fmt.Errorf("invalid -extra-entropy-bytes %d: must be positive", c.extraEntropyBytes)
+	}
+	if _, ok := mnemonicSchemes[c.seedType]; !ok {
+		return fmt.Errorf("invalid -seed-type %q: must be %q or %q", c.seedType, seedTypeBIP39, seedTypeElectrum)
+	}
+	if c.words < 12 || c.words > 24 || c.words%3 != 0 {
+		return fmt.Errorf("invalid -words %d: must be 12, 15, 18, 21 or 24", c.words)
+	}
+	if err := crypto.ValidateTruncateMode(c.truncateMode); err != nil {
+		return err
+	}
+	if c.seedType == seedTypeElectrum && (c.words != 24 || c.truncateMode != crypto.TruncateModeTruncate) {
+		return errors.New("-seed-type electrum cannot be combined with -words or -truncate-mode, as Electrum seeds always have 132 bits of entropy")
+	}
+	if c.count < 1 {
+		return fmt.Errorf("invalid -count %d: must be at least 1", c.count)
+	}
+	if c.split != "" {
+		if err := c.parseSplit(); err != nil {
+			return err
+		}
+	}
+	if c.entropyPassphrase && os.Getenv(entropyPassphraseEnv) == "" {
+		return fmt.Errorf("-entropy-passphrase requires a passphrase in $%s", entropyPassphraseEnv)
+	}
+	if c.entropyPassphrase && c.split != "" {
+		return errors.New("-entropy-passphrase cannot be combined with -split, which would mix the shares again")
+	}
+	if c.allowEmptyAudio && (c.brainSong || c.split != "") {
+		return errors.New("-allow-empty-audio cannot be combined with -brain-song or -split, which need the audio")
+	}
+	if c.consistencyCheck && (c.useDerivedKey || c.split != "" || c.brainSong || c.extraEntropy != "" || c.timingEntropy || c.topUp || c.entropyPassphrase || c.seedType != seedTypeBIP39 || c.password > 0 || c.count > 1) {
+		return errors.New("-consistency-check cannot be combined with -use-derived-key, -split, -brain-song, -extra-entropy, -timing-entropy, -topup, -entropy-passphrase, -seed-type, -password or -count, which the library does not implement")
+	}
+	if c.rngRetries < 0 {
+		return fmt.Errorf("invalid -rng-retries %d: must not be negative", c.rngRetries)
+	}
+	return nil
+}
+
+// parseSplit parses -split into the bits of each source, and checks that they add up to the entropy of -words
+// and that the rest of the configuration keeps the shares apart.
+func (c *recordConfig) parseSplit() error {
+	rng, audioBits, ok := strings.Cut(c.split, ":")
+	if !ok {
+		return fmt.Errorf("invalid -split %q: must be RNG:AUDIO bits, e.g. 128:128", c.split)
+	}
+	var err error
+	if c.splitRNGBits, err = strconv.Atoi(rng); err != nil {
+		return fmt.Errorf("invalid -split %q: %w", c.split, err)
+	}
+	if c.splitAudioBits, err = strconv.Atoi(audioBits); err != nil {
+		return fmt.Errorf("invalid -split %q: %w", c.split, err)
+	}
+	if c.splitRNGBits <= 0 || c.splitAudioBits <= 0 || c.splitRNGBits%8 != 0 || c.splitAudioBits%8 != 0 {
+		return fmt.Errorf("invalid -split %q: both shares must be positive multiples of 8 bits", c.split)
+	}
+	if target := c.words / 3 * 32; c.splitRNGBits+c.splitAudioBits != target {
+		return fmt.Errorf("invalid -split %q: the shares must add up to the %d bits of a %d-word mnemonic", c.split, target, c.words)
+	}
+
+	// Anything hashing the input again would mix the shares back together.
+	if c.seedType != seedTypeBIP39 || c.useDerivedKey || c.brainSong || c.hashRounds > 1 || c.count > 1 || c.truncateMode != crypto.TruncateModeTruncate {
+		return errors.New("-split cannot be combined with -seed-type electrum, -use-derived-key, -brain-song, -hash-rounds, -count or -truncate-mode hkdf")
+	}
+	return nil
+}
+
+// scheme returns the mnemonic scheme of -seed-type, with the length of -words for BIP-39 mnemonics.
+func (c *recordConfig) scheme() crypto.MnemonicScheme {
+	if c.seedType == seedTypeBIP39 {
+		return crypto.BIP39Scheme{Bits: c.mnemonicBits(), TruncateMode: c.truncateMode}
+	}
+	return mnemonicSchemes[c.seedType]
+}
+
+// mnemonicBits returns the entropy of the mnemonics of -seed-type and -words.
+func (c *recordConfig) mnemonicBits() int {
+	if c.seedType == seedTypeElectrum {
+		return crypto.ElectrumEntropyBits
+	}
+	// Every 3 words encode 32 bits of entropy and 1 checksum bit.
+	return c.words / 3 * 32
+}
+
+// secretBits returns the entropy of the output: of the mnemonics, or of the -password password, capped by the
+// 256 bits of entropy it is derived from.
+func (c *recordConfig) secretBits() int {
+	if c.password > 0 {
+		if bits := crypto.PasswordBits(c.password, c.passwordAlphabet); bits < rngEntropyBits {
+			return bits
+		}
+		return rngEntropyBits
+	}
+	return c.mnemonicBits()
+}
+
+// deriveMnemonicInput derives the data the mnemonics are generated from: from the features of the audio with
+// -brain-song, or by mixing the audio hash with generated entropy otherwise, with the entropy passphrase folded
+// in if requested.
+func (c *recordConfig) deriveMnemonicInput(in *capturedAudio) ([]byte, error) {
+	var mnemonicInput []byte
+	stopSpinner := c.startSpinner("Deriving the mnemonic...")
+	defer stopSpinner()
+	if c.brainSong {
+		// The mnemonic only depends on the quantized shape of the audio, so that it can be reproduced.
+		if in.samples == nil {
+			return nil, errors.New("-brain-song requires an audio input that can be decoded")
+		}
+		c.debugPrint("Deriving entropy from audio features...\n")
+		features := audio.ExtractFeatures(audio.DownmixToMono(in.samples, in.format.NumChannels), audio.FeatureWindows, audio.FeatureLevels)
+		mnemonicInput = crypto.DeriveEntropyFromFeatures(features, c.brainSongRounds)
+		stopSpinner()
+	} else {
+		var err error
+		mnemonicInput, err = c.mixEntropy(in.hash, append(in.timingEntropy, in.topUp...))
+		if err != nil {
+			return nil, err
+		}
+		stopSpinner()
+		fmt.Printf("Entropy: %s.\n", c.entropyAccount(in.samples, in.samples2, in.timingEntropy, in.topUp))
+		fmt.Println(crypto.BruteForceEstimate(c.secretBits()))
+	}
+
+	// Fold the memorized passphrase into the mnemonic input if requested.
+	if c.entropyPassphrase {
+		c.debugPrint("Folding the entropy passphrase into the mnemonic input...\n")
+		var err error
+		mnemonicInput, err = crypto.ApplyEntropyPassphrase(mnemonicInput, os.Getenv(entropyPassphraseEnv))
+		if err != nil {
+			return nil, fmt.Errorf("error applying entropy passphrase: %w", err)
+		}
+	}
+	return mnemonicInput, nil
+}
+
+// generateSecrets generates the mnemonics, or the -password password, from the mnemonic input, and prints the
+// derived key of -key-format. A single mnemonic is generated directly from the input, several from independent
+// derived keys.
+func (c *recordConfig) generateSecrets(mnemonicInput []byte) (mnemonics []string, password string, err error) {
+	// With -use-derived-key, the mnemonic input is the derived key.
+	if c.keyFormat != "" {
+		key, err := crypto.EncodeKey(mnemonicInput, c.keyFormat)
+		if err != nil {
+			return nil, "", err
+		}
+		fmt.Printf("Derived key:\n%s\n", strings.TrimSuffix(key, "\n"))
+	}
+
+	scheme := c.scheme()
+	if c.password > 0 {
+		return nil, crypto.BytesToPassword(mnemonicInput, c.password, c.passwordAlphabet), nil
+	}
+	if c.count > 1 {
+		mnemonics, err = crypto.GenerateMnemonicsWithScheme(scheme, mnemonicInput, c.count)
+		if err != nil {
+			return nil, "", fmt.Errorf("error generating mnemonics: %w", err)
+		}
+		return mnemonics, "", nil
+	}
+	mnemonic, err := scheme.Generate(mnemonicInput)
+	if err != nil {
+		return nil, "", fmt.Errorf("error generating mnemonic: %w", err)
+	}
+	return []string{mnemonic}, "", nil
+}
+
+// mixEntropy generates entropy, mixes it with the audio hash, any extra entropy and any supplementary entropy
+// collected during the run (timing entropy and top-up), and returns the data the mnemonic is generated from.
+func (c *recordConfig) mixEntropy(audioHash [32]byte, supplement []byte) ([]byte, error) {
+	// Fail closed if the system random number generator looks broken.
+	if c.checkRNG {
+		c.debugPrint("Checking system entropy...\n")
+		if err := crypto.CheckSystemEntropy(); err != nil {
+			return nil, fmt.Errorf("error checking system entropy: %w", err)
+		}
+	}
+
+	c.debugPrint("Generating cryptographic entropy...\n")
+	entropy, err := crypto.GenerateEntropyFrom(c.rng, rngEntropyBits, c.rngRetries) // Assuming 256 bits for strong security.
+	if err != nil {
+		return nil, fmt.Errorf("error generating entropy: %w", err)
+	}
+	defer lockSecret(entropy)()
+
+	// Print the generated entropy in hexadecimal.
+	c.debugPrint("Entropy: %s\n", c.secretHex(entropy))
+
+	// Read the extra entropy, mixed in alongside the generated entropy and the audio.
+	var extraEntropy []byte
+	if c.extraEntropy != "" {
+		c.debugPrint("Reading extra entropy from %s...\n", c.extraEntropy)
+		extraEntropy, err = utils.ReadEntropyFromFile(c.extraEntropy, c.extraEntropyBytes)
+		if err != nil {
+			return nil, fmt.Errorf("error reading extra entropy: %w", err)
+		}
+	}
+	if supplement != nil {
+		extraEntropy = append(extraEntropy, supplement...)
+	}
+
+	// The scheme tag separates the outputs of different scheme versions, and of different personalizations,
+	// for identical inputs.
+	schemeTag := crypto.PersonalizeTag(crypto.SchemeTag(c.schemeVersion), c.personalization)
+
+	// The mnemonic is generated either from the hash of the entropy combined with the audio hash (the default),
+	// or from a key derived with HKDF from the entropy, salted with the audio hash.
+	var mnemonicInput []byte
+	if c.split != "" {
+		c.debugPrint("Composing %d bits of entropy and %d bits of audio data hash...\n", c.splitRNGBits, c.splitAudioBits)
+		keyMaterial := entropy
+		if extraEntropy != nil {
+			keyMaterial = append(append([]byte{}, entropy...), extraEntropy...)
+		}
+		mnemonicInput, err = crypto.SplitEntropy(keyMaterial, audioHash[:], c.splitRNGBits, c.splitAudioBits)
+		if err != nil {
+			return nil, fmt.Errorf("error splitting entropy: %w", err)
+		}
+	} else if c.useDerivedKey {
+		c.debugPrint("Deriving cryptographic key salted with the audio data hash...\n")
+		keyMaterial := entropy
+		if extraEntropy != nil {
+			keyMaterial = append(append([]byte{}, entropy...), extraEntropy...)
+		}
+		key, err := crypto.DeriveKeyWithParams(keyMaterial, audioHash[:], schemeTag)
+		if err != nil {
+			return nil, fmt.Errorf("error deriving key: %w", err)
+		}
+		c.debugPrint("Key: %s\n", c.secretHex(key))
+
+		c.debugPrint("Generating BIP-39 mnemonic from derived key...\n")
+		mnemonicInput = key
+	} else {
+		c.debugPrint("Combining entropy with audio data hash and re-hashing...\n")
+		first, second := entropy, audioHash[:]
+		if c.order == orderAudioFirst {
+			first, second = second, first
+		}
+		combinedDataHash := crypto.CombineAndHashData(schemeTag, first, second, extraEntropy)
+		if c.hashRounds > 1 {
+			// The first round is the combining hash itself.
+			combinedDataHash = crypto.IterateHash(combinedDataHash[:], c.hashRounds-1)
+		}
+
+		c.debugPrint("Generating BIP-39 mnemonic from combined data hash...\n")
+		mnemonicInput = combinedDataHash[:]
+	}
+
+	// Check that the library generates the same mnemonic from the same entropy and audio if requested.
+	if c.consistencyCheck {
+		if err := c.checkConsistency(entropy, audioHash, mnemonicInput); err != nil {
+			return nil, err
+		}
+	}
+
+	return mnemonicInput, nil
+}
+
+// checkConsistency generates the mnemonic of the mnemonic input, and compares it with the mnemonic the aeb
+// library generates from the same entropy and audio hash with the same settings.
+func (c *recordConfig) checkConsistency(entropy []byte, audioHash [32]byte, mnemonicInput []byte) error {
+	c.debugPrint("Checking the mnemonic against the aeb library...\n")
+	mnemonic, err := c.scheme().Generate(mnemonicInput)
+	if err != nil {
+		return fmt.Errorf("error generating mnemonic: %w", err)
+	}
+	generator := &aeb.Generator{
+		Rand:            bytes.NewReader(entropy),
+		SchemeVersion:   c.schemeVersion,
+		Personalization: c.personalization,
+		HashRounds:      c.hashRounds,
+		Order:           c.order,
+		Words:           c.words,
+		TruncateMode:    c.truncateMode,
+	}
+	expected, err := generator.GenerateFromHash(audioHash)
+	if err != nil {
+		return fmt.Errorf("error generating mnemonic with the aeb library: %w", err)
+	}
+	if mnemonic != expected {
+		return errors.New("consistency check failed: the aeb library generates a different mnemonic from the same entropy and audio")
+	}
+	return nil
+}
+
+// memoryLockWarning prints the warning of lockSecret once.
+var memoryLockWarning sync.Once
+
+// lockSecret locks a secret into RAM, warning once if it cannot be locked, and returns the function that wipes
+// and unlocks it when it is no longer needed.
+func lockSecret(secret []byte) func() {
+	unlock, err := crypto.LockMemory(secret)
+	if err != nil {
+		memoryLockWarning.Do(func() {
+			fmt.Fprintf(os.Stderr, "Warning: secrets may be swapped to disk: %v\n", err)
+		})
+	}
+	return func() {
+		crypto.Wipe(secret)
+		unlock()
+	}
+}
+
+// entropySource is a source of entropy mixed into the mnemonic, and the bits it contributed. The bits of
+// estimated sources are measured from their content, sources whose quality cannot be measured are counted at
+// their size, as an upper bound, and negative bits are unknown.
+type entropySource struct {
+	name       string
+	bits       float64
+	estimated  bool
+	upperBound bool
+}
+
+// entropyAccount lists the estimated contribution of each source of entropy of a mnemonic.
+type entropyAccount []entropySource
+
+// String formats the account as e.g. "RNG 256b, audio ~140b effective".
+func (a entropyAccount) String() string {
+	parts := make([]string, len(a))
+	for i, source := range a {
+		switch {
+		case source.bits < 0:
+			parts[i] = source.name + " unknown"
+		case source.upperBound:
+			parts[i] = fmt.Sprintf("%s <=%.0fb", source.name, source.bits)
+		case source.estimated:
+			parts[i] = fmt.Sprintf("%s ~%.0fb effective", source.name, source.bits)
+		default:
+			parts[i] = fmt.Sprintf("%s %.0fb", source.name, source.bits)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// entropyAccount estimates the bits each source contributed to the mnemonic: the system RNG always contributes
+// its full size, each audio input the min-entropy of its samples (see EstimateTotalEntropy) capped by the size
+// of the audio hash, and the top-up its full size. Extra entropy files and timing entropy cannot be measured.
+// Audio inputs whose samples are nil cannot be decoded, and their contribution is unknown.
+func (c *recordConfig) entropyAccount(samples, samples2 []float32, timingEntropy, topUp []byte) entropyAccount {
+	// With -split, each source only contributes its share.
+	rngBits, audioBits := rngEntropyBits, audioHashBits
+	if c.split != "" {
+		rngBits, audioBits = c.splitRNGBits, c.splitAudioBits
+	}
+	account := entropyAccount{{name: "RNG", bits: float64(rngBits)}, audioEntropySource("audio", samples, audioBits)}
+	if c.inputFile2 != "" {
+		account = append(account, audioEntropySource("audio 2", samples2, audioBits))
+	}
+	if c.extraEntropy != "" {
+		account = append(account, entropySource{name: "extra", bits: float64(8 * c.extraEntropyBytes), upperBound: true})
+	}
+	if timingEntropy != nil {
+		account = append(account, entropySource{name: "timing", bits: float64(8 * len(timingEntropy)), upperBound: true})
+	}
+	if topUp != nil {
+		account = append(account, entropySource{name: "top-up", bits: float64(8 * len(topUp))})
+	}
+	return account
+}
+
+// audioEntropySource estimates the entropy of audio samples, capped by the bits the audio hash contributes.
+func audioEntropySource(name string, samples []float32, maxBits int) entropySource {
+	if samples == nil {
+		return entropySource{name: name, bits: -1}
+	}
+	return entropySource{name: name, bits: math.Min(audio.EstimateTotalEntropy(samples), float64(maxBits)), estimated: true}
+}
@@ -0,0 +1,493 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	mathrand "math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/crypto"
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/utils"
+	"github.com/gianlucamazza/audio-entropy-bip39/pkg/aeb"
+)
+
+// fixedEntropy is the generated entropy of the tests, in place of the system RNG.
+var fixedEntropy = bytes.Repeat([]byte{0x5a}, rngEntropyBits/8)
+
+// newMixConfig parses the record flags of args into a config that draws fixedEntropy instead of the system RNG.
+func newMixConfig(t *testing.T, args ...string) *recordConfig {
+	t.Helper()
+	cfg := newTestConfig(t, append([]string{"-check-rng=false"}, args...)...)
+	cfg.rng = bytes.NewReader(fixedEntropy)
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// mix runs mixEntropy of a config of args on an audio hash.
+func mix(t *testing.T, audioHash [32]byte, args ...string) []byte {
+	t.Helper()
+	input, err := newMixConfig(t, args...).mixEntropy(audioHash, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input
+}
+
+func TestMixEntropyAudioSalt(t *testing.T) {
+	hash1 := crypto.HashAudioData([]byte("first recording"))
+	hash2 := crypto.HashAudioData([]byte("second recording"))
+	args := []string{"-use-derived-key", "-hkdf-salt", "audio"}
+
+	key1 := mix(t, hash1, args...)
+	if !bytes.Equal(key1, mix(t, hash1, args...)) {
+		t.Error("the derived key changes with fixed RNG entropy and audio")
+	}
+	if bytes.Equal(key1, mix(t, hash2, args...)) {
+		t.Error("the derived key does not change with the audio hash")
+	}
+
+	want, err := crypto.DeriveKeyWithParams(fixedEntropy, hash1[:], crypto.SchemeTag(crypto.SchemeVersion))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key1, want) {
+		t.Errorf("derived key = %x, want the HKDF of the entropy salted with the audio hash %x", key1, want)
+	}
+}
+
+func TestMixEntropyPersonalization(t *testing.T) {
+	hash := crypto.HashAudioData([]byte("recording"))
+	for _, args := range [][]string{nil, {"-use-derived-key", "-hkdf-salt", "audio"}} {
+		plain := mix(t, hash, args...)
+		if !bytes.Equal(plain, mix(t, hash, append(args, "-personalize", "")...)) {
+			t.Errorf("an empty -personalize changes the mnemonic input of %q", args)
+		}
+		app1 := mix(t, hash, append(args, "-personalize", "app-one")...)
+		app2 := mix(t, hash, append(args, "-personalize", "app-two")...)
+		if bytes.Equal(app1, app2) || bytes.Equal(app1, plain) {
+			t.Errorf("different -personalize strings give the same mnemonic input of %q", args)
+		}
+	}
+}
+
+func TestMixEntropyOrder(t *testing.T) {
+	hash := crypto.HashAudioData([]byte("recording"))
+	tag := crypto.SchemeTag(crypto.SchemeVersion)
+
+	// rng-first, the default, is the order of the combined hash before the option existed.
+	rngFirst := mix(t, hash, "-order", "rng-first")
+	if want := crypto.CombineAndHashData(tag, fixedEntropy, hash[:], nil); !bytes.Equal(rngFirst, want[:]) {
+		t.Errorf("rng-first combined hash = %x, want %x", rngFirst, want)
+	}
+	if !bytes.Equal(mix(t, hash), rngFirst) {
+		t.Error("the default order is not rng-first")
+	}
+
+	audioFirst := mix(t, hash, "-order", "audio-first")
+	if want := crypto.CombineAndHashData(tag, hash[:], fixedEntropy, nil); !bytes.Equal(audioFirst, want[:]) {
+		t.Errorf("audio-first combined hash = %x, want %x", audioFirst, want)
+	}
+	if bytes.Equal(rngFirst, audioFirst) {
+		t.Error("the two orders give the same combined hash")
+	}
+
+	for _, args := range [][]string{{"-order", "rng-last"}, {"-order", "audio-first", "-use-derived-key", "-hkdf-salt", "audio"}} {
+		if err := newTestConfig(t, args...).validateMix(); err == nil || !strings.Contains(err.Error(), "-order") {
+			t.Errorf("validateMix %q = %v, want an -order error", args, err)
+		}
+	}
+}
+
+func TestLockSecret(t *testing.T) {
+	secret := bytes.Repeat([]byte{0xa5}, 32)
+	release := lockSecret(secret)
+	if !bytes.Equal(secret, bytes.Repeat([]byte{0xa5}, 32)) {
+		t.Fatal("lockSecret modified the secret")
+	}
+	release()
+	if !bytes.Equal(secret, make([]byte, 32)) {
+		t.Errorf("secret after release = %x, want zeros", secret)
+	}
+}
+
+func TestMixEntropyPaths(t *testing.T) {
+	audioHash := crypto.HashAudioData([]byte("recording"))
+	tag := crypto.SchemeTag(crypto.SchemeVersion)
+
+	// By default the mnemonic comes from the hash of the entropy combined with the audio hash.
+	combined := crypto.CombineAndHashData(tag, fixedEntropy, audioHash[:], nil)
+	if got := mix(t, audioHash); !bytes.Equal(got, combined[:]) {
+		t.Errorf("default mnemonic input = %x, want the combined data hash %x", got, combined)
+	}
+
+	// With -use-derived-key it comes from the HKDF key instead.
+	key, err := crypto.DeriveKeyWithParams(fixedEntropy, audioHash[:], tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mix(t, audioHash, "-use-derived-key", "-hkdf-salt", "audio"); !bytes.Equal(got, key) {
+		t.Errorf("-use-derived-key mnemonic input = %x, want the derived key %x", got, key)
+	}
+	if bytes.Equal(key, combined[:]) {
+		t.Error("the derived key equals the combined data hash")
+	}
+}
+
+func TestMixEntropyExtraEntropy(t *testing.T) {
+	audioHash := crypto.HashAudioData([]byte("recording"))
+	extra := bytes.Repeat([]byte{0xc3}, 32)
+	filename := filepath.Join(t.TempDir(), "hwrng")
+	if err := os.WriteFile(filename, extra, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	withExtra := mix(t, audioHash, "-extra-entropy", filename)
+	if bytes.Equal(withExtra, mix(t, audioHash)) {
+		t.Error("the extra entropy does not change the combined data hash")
+	}
+	want := crypto.CombineAndHashData(crypto.SchemeTag(crypto.SchemeVersion), fixedEntropy, audioHash[:], extra)
+	if !bytes.Equal(withExtra, want[:]) {
+		t.Errorf("combined data hash = %x, want %x", withExtra, want)
+	}
+
+	// A file shorter than -extra-entropy-bytes is an error rather than a weaker mix.
+	cfg := newMixConfig(t, "-extra-entropy", filename, "-extra-entropy-bytes", "64")
+	if _, err := cfg.mixEntropy(audioHash, nil); !errors.Is(err, utils.ErrShortEntropyRead) {
+		t.Errorf("mixEntropy with a short extra entropy file = %v, want ErrShortEntropyRead", err)
+	}
+}
+
+func TestMixEntropyHashRounds(t *testing.T) {
+	audioHash := crypto.HashAudioData([]byte("recording"))
+	combined := crypto.CombineAndHashData(crypto.SchemeTag(crypto.SchemeVersion), fixedEntropy, audioHash[:], nil)
+	if got := mix(t, audioHash, "-hash-rounds", "1"); !bytes.Equal(got, combined[:]) {
+		t.Errorf("-hash-rounds 1 = %x, want the combined data hash %x", got, combined)
+	}
+	// The combining hash is the first of the rounds.
+	want := crypto.IterateHash(combined[:], 2)
+	if got := mix(t, audioHash, "-hash-rounds", "3"); !bytes.Equal(got, want[:]) {
+		t.Errorf("-hash-rounds 3 = %x, want %x", got, want)
+	}
+}
+
+// hummedTune returns mono samples of a tune whose loudness changes every 1000 samples, in the middle of the
+// feature quantization levels, scaled by level and with a small offset added to every sample.
+func hummedTune(level, offset float32) []float32 {
+	samples := make([]float32, 32*1000)
+	for i := range samples {
+		sign := float32(1)
+		if i%2 == 1 {
+			sign = -1
+		}
+		samples[i] = sign*level*(float32(i/1000%8)+0.5)/7.5 + offset
+	}
+	return samples
+}
+
+func TestBrainSongMnemonic(t *testing.T) {
+	mnemonic := func(samples []float32) string {
+		t.Helper()
+		cfg := newMixConfig(t, "-brain-song", "-brain-song-iterations", "1000")
+		input, err := cfg.deriveMnemonicInput(&capturedAudio{samples: samples, format: utils.DefaultWAVFormat})
+		if err != nil {
+			t.Fatal(err)
+		}
+		mnemonics, _, err := cfg.generateSecrets(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return mnemonics[0]
+	}
+
+	// A quieter recording of the same tune, with a slight offset, quantizes to the same features.
+	tune := mnemonic(hummedTune(0.8, 0))
+	if again := mnemonic(hummedTune(0.5, 0.001)); again != tune {
+		t.Errorf("two recordings of the same tune give the mnemonics %q and %q", tune, again)
+	}
+	if other := mnemonic(hummedTune(0.8, 0)[1000:]); other == tune {
+		t.Error("a different tune gives the same mnemonic")
+	}
+}
+
+func TestSecondInputFile(t *testing.T) {
+	chdirTemp(t)
+	writeSeededNoiseWAV(t, "a.wav", 1)
+	writeSeededNoiseWAV(t, "b.wav", 2)
+
+	// generateFrom returns the mnemonic generated from the input files with the fixed entropy.
+	generateFrom := func(args ...string) string {
+		t.Helper()
+		cfg := newMixConfig(t, append([]string{"-stdout=false", "-mnemonic-out", "mnemonic.txt"}, args...)...)
+		if err := cfg.generate(); err != nil {
+			t.Fatal(err)
+		}
+		mnemonic, err := utils.LoadMnemonicFromFile("mnemonic.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return mnemonic
+	}
+
+	// The audio hashes are combined in sorted order, so the order of the files does not matter.
+	ab := generateFrom("-input-file", "a.wav", "-input-file-2", "b.wav")
+	ba := generateFrom("-input-file", "b.wav", "-input-file-2", "a.wav")
+	if ab != ba {
+		t.Errorf("swapping the input files changed the mnemonic from %q to %q", ab, ba)
+	}
+	if only := generateFrom("-input-file", "a.wav"); only == ab {
+		t.Error("the second input file does not change the mnemonic")
+	}
+}
+
+func TestDebugOutputMasksSecrets(t *testing.T) {
+	audioHash := crypto.HashAudioData([]byte("recording"))
+	entropyHex := hex.EncodeToString(fixedEntropy)
+
+	output := captureStdout(t, func() { mix(t, audioHash, "-debug") })
+	if strings.Contains(output, entropyHex) {
+		t.Errorf("debug output shows the entropy without -i-understand-the-risk:\n%s", output)
+	}
+	if !strings.Contains(output, "Entropy: "+strings.Repeat("*", len(entropyHex))) {
+		t.Errorf("debug output does not show the masked entropy:\n%s", output)
+	}
+
+	output = captureStdout(t, func() { mix(t, audioHash, "-debug", "-i-understand-the-risk") })
+	if !strings.Contains(output, "Entropy: "+entropyHex) {
+		t.Errorf("debug output with -i-understand-the-risk does not show the entropy:\n%s", output)
+	}
+}
+
+// paramsArgs returns the record flags that derive a mnemonic again with the parameters of a -save-params file.
+func paramsArgs(t *testing.T, params utils.ParamsJSON) []string {
+	t.Helper()
+	if !params.Reproducible || params.Mixer != "brain-song" {
+		t.Fatalf("parameters of the %q mixer are not reproducible", params.Mixer)
+	}
+	args := []string{
+		"-brain-song", "-brain-song-iterations", strconv.Itoa(params.BrainSongIterations),
+		"-scheme-version", strconv.Itoa(params.Scheme), "-seed-type", params.SeedType,
+		"-words", strconv.Itoa(params.Words), "-truncate-mode", params.TruncateMode,
+		"-hash-rounds", strconv.Itoa(params.HashRounds), "-decimate", strconv.Itoa(params.Decimate),
+		"-downmix=" + strconv.FormatBool(params.Downmix), "-input-file", params.InputFile,
+	}
+	if params.Personalization != "" {
+		args = append(args, "-personalize", params.Personalization)
+	}
+	return args
+}
+
+func TestSaveParamsReproducesMnemonic(t *testing.T) {
+	chdirTemp(t)
+	if err := utils.SaveAudioDataToFile("tune.wav", utils.Float32ToByteSlice(hummedTune(0.8, 0))); err != nil {
+		t.Fatal(err)
+	}
+	run := func(args ...string) string {
+		t.Helper()
+		cfg := newTestConfig(t, append([]string{"-stdout=false", "-mnemonic-out", "mnemonic.txt"}, args...)...)
+		if err := cfg.validate(); err != nil {
+			t.Fatal(err)
+		}
+		if err := cfg.generate(); err != nil {
+			t.Fatal(err)
+		}
+		mnemonic, err := utils.LoadMnemonicFromFile("mnemonic.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return mnemonic
+	}
+	mnemonic := run("-input-file", "tune.wav", "-brain-song", "-brain-song-iterations", "1000", "-words", "12", "-save-params")
+
+	contents, err := os.ReadFile(savedParamsFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(contents), mnemonic) {
+		t.Error("the parameters file contains the mnemonic")
+	}
+	var params utils.ParamsJSON
+	if err := json.Unmarshal(contents, &params); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(params.InputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash := sha256.Sum256(data); hex.EncodeToString(hash[:]) != params.InputFileHash {
+		t.Errorf("input file hash = %s, want %x", params.InputFileHash, hash)
+	}
+
+	// The parameters alone derive the same mnemonic again.
+	if again := run(paramsArgs(t, params)...); again != mnemonic {
+		t.Errorf("mnemonic from the saved parameters = %q, want %q", again, mnemonic)
+	}
+}
+
+func TestEntropyAccount(t *testing.T) {
+	// Near-silent audio: the faintest hiss of the lowest bit.
+	quiet := make([]float32, 44100)
+	for i := range quiet {
+		quiet[i] = float32(i%2) / 32767
+	}
+	noise := make([]float32, 44100)
+	r := mathrand.New(mathrand.NewSource(3))
+	for i := range noise {
+		noise[i] = float32(1.8*r.Float64() - 0.9)
+	}
+
+	cfg := newMixConfig(t)
+	account := cfg.entropyAccount(quiet, nil, nil, nil)
+	if len(account) != 2 || account[0].name != "RNG" || account[0].bits != rngEntropyBits {
+		t.Fatalf("account = %q, want the full RNG and the audio", account)
+	}
+	if audioBits := account[1].bits; audioBits < 0 || audioBits > 8 {
+		t.Errorf("near-silent audio contributes %v bits, want about 0", audioBits)
+	}
+	if loud := cfg.entropyAccount(noise, nil, nil, nil)[1].bits; loud != audioHashBits {
+		t.Errorf("a second of noise contributes %v bits, want the %d bits of the audio hash", loud, audioHashBits)
+	}
+	if got, want := cfg.entropyAccount(noise, nil, nil, nil).String(), "RNG 256b, audio ~256b effective"; got != want {
+		t.Errorf("account = %q, want %q", got, want)
+	}
+
+	// Undecodable audio, timing entropy and a top-up are accounted for as such.
+	got := cfg.entropyAccount(nil, nil, make([]byte, 4), make([]byte, 10)).String()
+	if want := "RNG 256b, audio unknown, timing <=32b, top-up 80b"; got != want {
+		t.Errorf("account = %q, want %q", got, want)
+	}
+}
+
+// deriveMnemonic derives the first mnemonic of a config of args from an audio hash, with rngByte repeated as the
+// generated entropy.
+func deriveMnemonic(t *testing.T, audioHash [32]byte, rngByte byte, args ...string) string {
+	t.Helper()
+	cfg := newMixConfig(t, args...)
+	cfg.rng = bytes.NewReader(bytes.Repeat([]byte{rngByte}, rngEntropyBits/8))
+	input, err := cfg.deriveMnemonicInput(&capturedAudio{hash: audioHash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mnemonics, _, err := cfg.generateSecrets(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mnemonics[0]
+}
+
+func TestSplitMnemonic(t *testing.T) {
+	audioHash := crypto.HashAudioData([]byte("recording"))
+	mnemonic := deriveMnemonic(t, audioHash, 0x5a, "-split", "128:128")
+	if words := len(strings.Fields(mnemonic)); words != 24 {
+		t.Errorf("128:128 split gave %d words, want 24", words)
+	}
+	split, err := crypto.SplitEntropy(fixedEntropy, audioHash[:], 128, 128)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := crypto.GenerateMnemonic(split); mnemonic != want {
+		t.Errorf("128:128 split mnemonic = %q, want the mnemonic of SplitEntropy %q", mnemonic, want)
+	}
+
+	// Each source changes its half of the entropy.
+	if other := deriveMnemonic(t, audioHash, 0xa5, "-split", "128:128"); other == mnemonic {
+		t.Error("changing the RNG entropy does not change the split mnemonic")
+	}
+	if other := deriveMnemonic(t, crypto.HashAudioData([]byte("other")), 0x5a, "-split", "128:128"); other == mnemonic {
+		t.Error("changing the audio does not change the split mnemonic")
+	}
+}
+
+func TestEntropyPassphrase(t *testing.T) {
+	audioHash := crypto.HashAudioData([]byte("recording"))
+	withPassphrase := func(passphrase string) string {
+		t.Helper()
+		t.Setenv(entropyPassphraseEnv, passphrase)
+		return deriveMnemonic(t, audioHash, 0x5a, "-entropy-passphrase")
+	}
+
+	// The entropy passphrase changes the mnemonic itself.
+	first, second := withPassphrase("correct horse"), withPassphrase("battery staple")
+	if first == second {
+		t.Error("changing the entropy passphrase does not change the mnemonic")
+	}
+	if again := withPassphrase("correct horse"); again != first {
+		t.Errorf("the same entropy passphrase gives %q and %q", first, again)
+	}
+	if plain := deriveMnemonic(t, audioHash, 0x5a); plain == first {
+		t.Error("the entropy passphrase does not change the mnemonic")
+	}
+
+	// The BIP-39 passphrase only changes the seed a wallet derives from the same mnemonic.
+	if bytes.Equal(crypto.DeriveSeed(first, ""), crypto.DeriveSeed(first, "correct horse")) {
+		t.Error("the BIP-39 passphrase does not change the seed")
+	}
+	if err := crypto.ValidateMnemonic(first); err != nil {
+		t.Errorf("mnemonic with an entropy passphrase: %v", err)
+	}
+}
+
+func TestConsistencyWithLibrary(t *testing.T) {
+	chdirTemp(t)
+	data := writeNoiseWAV(t, "input.wav")
+	tests := []struct {
+		args      []string
+		configure func(g *aeb.Generator)
+	}{
+		{nil, func(g *aeb.Generator) {}},
+		{[]string{"-words", "12"}, func(g *aeb.Generator) { g.Words = 12 }},
+		{[]string{"-words", "18", "-truncate-mode", "hkdf"}, func(g *aeb.Generator) { g.Words, g.TruncateMode = 18, aeb.TruncateModeHKDF }},
+		{[]string{"-order", "audio-first"}, func(g *aeb.Generator) { g.Order = aeb.OrderAudioFirst }},
+		{[]string{"-hash-rounds", "3"}, func(g *aeb.Generator) { g.HashRounds = 3 }},
+		{[]string{"-personalize", "my-app"}, func(g *aeb.Generator) { g.Personalization = "my-app" }},
+		{[]string{"-scheme-version", "0"}, func(g *aeb.Generator) { g.SchemeVersion = 0 }},
+	}
+	for _, tt := range tests {
+		args := append([]string{"-input-file", "input.wav", "-stdout=false", "-mnemonic-out", "mnemonic.txt", "-consistency-check"}, tt.args...)
+		if err := newMixConfig(t, args...).generate(); err != nil {
+			t.Fatalf("generate() %q: %v", tt.args, err)
+		}
+		mnemonic, err := utils.LoadMnemonicFromFile("mnemonic.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		generator := aeb.NewGenerator()
+		generator.Rand = bytes.NewReader(fixedEntropy)
+		tt.configure(generator)
+		want, err := generator.Generate(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mnemonic != want {
+			t.Errorf("CLI mnemonic with %q = %q, library mnemonic = %q", tt.args, mnemonic, want)
+		}
+	}
+
+	// A mnemonic input the library does not reproduce fails the check.
+	hash := crypto.HashAudioData(data)
+	if err := newMixConfig(t, "-consistency-check").checkConsistency(fixedEntropy, hash, make([]byte, 32)); err == nil {
+		t.Error("checkConsistency of a wrong mnemonic input succeeded")
+	}
+
+	for _, args := range [][]string{
+		{"-use-derived-key", "-hkdf-salt", "audio"},
+		{"-brain-song"},
+		{"-count", "2"},
+		{"-password", "20"},
+		{"-seed-type", "electrum"},
+	} {
+		cfg := newTestConfig(t, append(args, "-consistency-check")...)
+		if err := cfg.validateMix(); err == nil || !strings.Contains(err.Error(), "-consistency-check") {
+			t.Errorf("validateMix %q with -consistency-check = %v, want an error", args, err)
+		}
+	}
+}
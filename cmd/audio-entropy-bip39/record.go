@@ -0,0 +1,631 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/audio"
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/crypto"
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/utils"
+)
+
+const (
+	// Probe length and entropy target of -estimate.
+	probeDuration      = time.Second
+	estimateTargetBits = 256
+
+	// Interval between checks of the input device of -abort-on-device-change.
+	deviceCheckPeriod = time.Second
+
+	// Bits of entropy generated by the system RNG, and size of the audio hash, which caps the entropy of the audio.
+	rngEntropyBits = 256
+	audioHashBits  = 256
+
+	// Accepted values of the -seed-type flag.
+	seedTypeBIP39    = "bip39"
+	seedTypeElectrum = "electrum"
+
+	// Accepted values of the -hkdf-salt flag.
+	hkdfSaltNone  = "none"
+	hkdfSaltAudio = "audio"
+
+	// Accepted values of the -bit-depth flag.
+	bitDepth16      = "16"
+	bitDepth32Float = "32f"
+
+	// Accepted values of the -hash-scope flag.
+	hashScopePCM = "pcm"
+	hashScopeWAV = "wav"
+
+	// Accepted values of the -endianness flag.
+	endiannessLittle = "little"
+	endiannessBig    = "big"
+
+	// Accepted values of the -order flag.
+	orderRNGFirst   = "rng-first"
+	orderAudioFirst = "audio-first"
+)
+
+// recordingFormats maps the -bit-depth flag values to the format of the saved recording.
+var recordingFormats = map[string]utils.WAVFormat{
+	bitDepth16:      utils.DefaultWAVFormat,
+	bitDepth32Float: utils.FloatWAVFormat,
+}
+
+// byteOrders maps the -endianness flag values to the byte order of the saved samples.
+var byteOrders = map[string]binary.ByteOrder{
+	endiannessLittle: binary.LittleEndian,
+	endiannessBig:    binary.BigEndian,
+}
+
+// mnemonicSchemes maps the accepted values of the -seed-type flag to their scheme.
+var mnemonicSchemes = map[string]crypto.MnemonicScheme{
+	seedTypeBIP39:    crypto.BIP39Scheme{},
+	seedTypeElectrum: crypto.ElectrumScheme{},
+}
+
+// recordConfig holds the flags of the record command.
+type recordConfig struct {
+	debugMode          bool
+	showSecrets        bool
+	verifySave         bool
+	inputFile          string
+	inputFile2         string
+	sampleRate         int
+	channels           int
+	hkdfSalt           string
+	gain               float64
+	gainAffectsEntropy bool
+	bitDepth           string
+	endianness         string
+	hashScope          string
+	dither             bool
+	inspectFile        string
+	listWordlists      bool
+	analyzeFile        string
+	thresholds         audio.AnalysisThresholds
+	decimate           int
+	useDerivedKey      bool
+	entropyPassphrase  bool
+	password           int
+	passwordAlphabet   string
+	keyFormat          string
+	extraEntropy       string
+	timingEntropy      bool
+	topUp              bool
+	extraEntropyBytes  int
+	schemeVersion      int
+	personalization    string
+	playback           bool
+	hashRounds         int
+	order              string
+	consistencyCheck   bool
+	split              string
+	splitRNGBits       int
+	splitAudioBits     int
+	seedQR             bool
+	showChecksum       bool
+	verificationWord   bool
+	walletID           bool
+	entropyOut         bool
+	masterKey          bool
+	showAddresses      int
+	network            string
+	showVersion        bool
+	downmix            bool
+	removeDC           bool
+	swapChannels       bool
+	checkRNG           bool
+	strict             bool
+	rngRetries         int
+	csvOut             string
+	count              int
+	seedType           string
+	words              int
+	truncateMode       string
+	audioHashOnly      bool
+	tempAudio          bool
+	deleteAudio        bool
+	tempAudioPath      string
+	compress           bool
+	noClear            bool
+	noColor            bool
+	backend            string
+	captureFormat      string
+	latency            string
+	overflowPolicy     string
+	maxOverflowRatio   float64
+	maxRepeatedBuffers int
+	abortOnDevice      bool
+	bindDevice         bool
+	report             bool
+	saveParams         bool
+	minDuration        time.Duration
+	estimate           bool
+	monitor            bool
+	stdout             bool
+	onePerLine         bool
+	mnemonicOut        string
+	jsonOut            string
+	encryptedOut       string
+	qrOut              string
+	seedFileOut        string
+	allowSymlink       bool
+	warmup             int
+	stopOnSilence      time.Duration
+	allowEmptyAudio    bool
+	streamTo           string
+	allowRemote        bool
+	silenceThreshold   float64
+	clips              int
+	saveClips          bool
+	appendTo           string
+	refresh            time.Duration
+	loopSleep          time.Duration
+	barCeiling         float64
+	meterSmoothing     float64
+	waveform           bool
+	mains              int
+	prompt             string
+	brainSong          bool
+	brainSongRounds    int
+
+	// rng is the source of the generated entropy, crypto/rand.Reader outside of tests.
+	rng io.Reader
+}
+
+// registerFlags defines the record flags on fs.
+func (c *recordConfig) registerFlags(fs *flag.FlagSet) {
+	// Set the debug flag.
+	fs.BoolVar(&c.debugMode, "debug", debug, "Enable debug mode")
+	fs.BoolVar(&c.showSecrets, "i-understand-the-risk", false, "Show the entropy and keys in the debug output instead of masking them")
+
+	// Set the save verification flag.
+	fs.BoolVar(&c.verifySave, "verify-save", false, "Re-read the saved files and abort if they do not match")
+
+	// Set the audio input flags.
+	fs.StringVar(&c.inputFile, "input-file", "", "Read audio from a WAV file, or raw 16-bit little-endian PCM from stdin with \"-\", instead of recording")
+	fs.StringVar(&c.inputFile2, "input-file-2", "", "Also mix in the audio of a second WAV file, e.g. recorded by another participant")
+	fs.IntVar(&c.sampleRate, "sample-rate", 0, "Sample rate of the raw PCM read from stdin (required with -input-file -)")
+	fs.IntVar(&c.channels, "channels", 0, "Channel count of the recording (mono by default), or of the raw PCM read from stdin (required with -input-file -)")
+	fs.BoolVar(&c.strict, "strict", false, "Fail instead of recording fewer channels when the input device does not support -channels")
+	fs.BoolVar(&c.swapChannels, "swap-channels", false, "Swap the left and right channels of a stereo recording in the saved file")
+	fs.BoolVar(&c.removeDC, "remove-dc", false, "Subtract the DC offset of each channel from the audio before hashing and saving it")
+	fs.BoolVar(&c.downmix, "downmix", false, "Average the channels of multi-channel audio into mono before hashing it")
+
+	// Set the system entropy check flag.
+	fs.BoolVar(&c.checkRNG, "check-rng", true, "Abort if the system random number generator fails a sanity check")
+
+	// Set the RNG retries flag.
+	fs.IntVar(&c.rngRetries, "rng-retries", crypto.DefaultEntropyRetries, "Retry a failed read of the system random number generator this many times, with backoff, before aborting")
+
+	// Set the brain-song flags.
+	fs.BoolVar(&c.brainSong, "brain-song", false, "Derive the mnemonic deterministically from coarse audio features, without random entropy (see README)")
+	fs.IntVar(&c.brainSongRounds, "brain-song-iterations", 210000, "PBKDF2 iteration count of -brain-song")
+
+	// Set the HKDF salt flag.
+	fs.StringVar(&c.hkdfSalt, "hkdf-salt", hkdfSaltNone, "Salt used when deriving the key: \"none\" or \"audio\" (the audio hash)")
+
+	// Set the recording gain flags.
+	fs.Float64Var(&c.gain, "gain", 1, "Software gain applied to recorded samples for the volume bar and the saved audio")
+	fs.BoolVar(&c.gainAffectsEntropy, "gain-affects-entropy", false, "Hash the amplified samples instead of the raw ones")
+
+	// Set the append flag.
+	fs.StringVar(&c.appendTo, "append-to", "", "Append the recording to this partial WAV file and use the combined audio")
+
+	// Set the display refresh flag.
+	fs.DurationVar(&c.refresh, "refresh", 50*time.Millisecond, "Minimum interval between two repaints of the volume bar")
+
+	// Set the loop sleep flag.
+	fs.DurationVar(&c.loopSleep, "loop-sleep", 0, "Pause before each read of the recording loop, for backends whose reads do not block")
+
+	// Set the volume bar ceiling flag.
+	fs.Float64Var(&c.barCeiling, "bar-ceiling", 1, "Volume (RMS) that fills the volume bar; lower it for quiet microphones")
+
+	// Set the meter smoothing flag.
+	fs.Float64Var(&c.meterSmoothing, "meter-smoothing", 0.5, "Smoothing factor of the volume bar, from 0 (none) to below 1")
+
+	// Set the prompt flag.
+	fs.StringVar(&c.prompt, "prompt", audio.PromptSpeak, "Instruction shown when recording: a preset (\""+audio.PromptSpeak+"\", \""+audio.PromptAmbient+"\", \""+audio.PromptTap+"\", \""+audio.PromptMusic+"\") or custom text")
+
+	// Set the waveform flag.
+	fs.BoolVar(&c.waveform, "waveform", false, "Print an ASCII preview of the waveform after recording")
+
+	// Set the mains frequency flag.
+	fs.IntVar(&c.mains, "mains", audio.Mains50Hz, "Frequency of the mains hum looked for by the quality report, 50 or 60 Hz")
+
+	// Set the estimate flag.
+	fs.BoolVar(&c.estimate, "estimate", false, "Record a short probe first and print how long to record to collect 256 bits of entropy")
+
+	// Set the monitor flag.
+	fs.BoolVar(&c.monitor, "monitor", false, "Show the live input levels until Ctrl-C, without recording, then exit")
+
+	// Set the live stream flags.
+	fs.StringVar(&c.streamTo, "stream-to", "", "Also send the live audio as 16-bit PCM over UDP to host:port, for monitoring (see README)")
+	fs.BoolVar(&c.allowRemote, "allow-remote", false, "Allow -stream-to addresses that are not on the loopback interface")
+
+	// Set the report flag.
+	fs.BoolVar(&c.report, "report", false, "Save the quality report and audio hash of the recording, without the mnemonic, to "+savedReportFilename)
+
+	// Set the parameters flag.
+	fs.BoolVar(&c.saveParams, "save-params", false, "Save the derivation parameters, without the mnemonic or random entropy, to "+savedParamsFilename)
+
+	// Set the backend flag.
+	fs.StringVar(&c.backend, "backend", audio.BackendPortAudio, "Audio library used to record: \""+audio.BackendPortAudio+"\" or \""+audio.BackendMalgo+"\" (miniaudio)")
+
+	// Set the capture format flag.
+	fs.StringVar(&c.captureFormat, "capture-format", audio.CaptureFloat32, "Native sample format requested from the audio driver: \""+audio.CaptureFloat32+"\" or \""+audio.CaptureInt16+"\"")
+	fs.StringVar(&c.latency, "latency", audio.LatencyHigh, "Suggested input latency: \""+audio.LatencyLow+"\", \""+audio.LatencyNormal+"\" or \""+audio.LatencyHigh+"\" (see README)")
+
+	// Set the overflow policy flag.
+	fs.StringVar(&c.overflowPolicy, "overflow-policy", audio.OverflowKeep, "What to do with buffers read after an input overflow: \""+audio.OverflowKeep+"\", \""+audio.OverflowDiscard+"\" or \""+audio.OverflowRetry+"\"")
+	fs.Float64Var(&c.maxOverflowRatio, "max-overflow-ratio", 0, "Abort if more than this fraction of reads overflow, e.g. 0.1 (0 disables the check)")
+
+	// Set the device change flag.
+	fs.BoolVar(&c.abortOnDevice, "abort-on-device-change", false, "Abort if the default input device changes during the recording, e.g. when headphones are unplugged")
+
+	// Set the stuck device flag.
+	fs.IntVar(&c.maxRepeatedBuffers, "max-repeated-buffers", 0, "Abort if the device returns the same buffer more than this many times in a row, as a frozen device does (0, the default, disables the check)")
+
+	// Set the device binding flag.
+	fs.BoolVar(&c.bindDevice, "bind-device", false, "Prefix the audio hash with the name, index and sample rate of the recording device")
+
+	// Set the minimum duration flag.
+	fs.DurationVar(&c.minDuration, "min-duration", 5*time.Second, "Length of audio to record before Ctrl-C can stop the recording early")
+
+	// Set the silence stop flags.
+	fs.DurationVar(&c.stopOnSilence, "stop-on-silence", 0, "Stop the recording after this much trailing silence following the first sound, e.g. 2s (0 disables)")
+	fs.Float64Var(&c.silenceThreshold, "silence-threshold", audio.DefaultSilenceThreshold, "Volume (RMS) below which -stop-on-silence considers the audio silent")
+
+	// Set the empty audio flag.
+	fs.BoolVar(&c.allowEmptyAudio, "allow-empty-audio", false, "Generate the mnemonic from the system RNG alone, with a warning, if no audio is captured")
+
+	// Set the warmup flag.
+	fs.IntVar(&c.warmup, "warmup", 0, "Number of buffers to read and discard after starting the recording")
+
+	// Set the clip flags.
+	fs.IntVar(&c.clips, "clips", 1, "Number of clips to record one after the other and join into a single recording")
+	fs.BoolVar(&c.saveClips, "save-clips", false, "Also save each recorded clip to its own numbered WAV file, clip-01.wav, clip-02.wav, ...")
+
+	// Set the bit depth flag.
+	fs.StringVar(&c.bitDepth, "bit-depth", bitDepth16, "Sample format of the saved recording: \"16\" (PCM) or \"32f\" (IEEE float)")
+
+	// Set the endianness flag.
+	fs.StringVar(&c.endianness, "endianness", endiannessLittle, "Byte order of the saved samples: \"little\" (WAV) or \"big\" (raw PCM to "+savedRawPCMFilename+")")
+
+	// Set the hash scope flag.
+	fs.StringVar(&c.hashScope, "hash-scope", hashScopePCM, "Data hashed into the entropy: \"pcm\" (the samples) or \"wav\" (the saved WAV file, header included)")
+
+	// Set the dither flag.
+	fs.BoolVar(&c.dither, "dither", false, "Apply TPDF dither when quantizing the saved recording to 16 bits")
+
+	// Set the inspection flag.
+	fs.StringVar(&c.inspectFile, "inspect", "", "Print the properties of a WAV file and exit")
+
+	// Set the wordlist listing flag.
+	fs.BoolVar(&c.listWordlists, "list-wordlists", false, "List the embedded BIP-39 wordlists, check their integrity and exit")
+
+	// Set the analysis flags.
+	fs.StringVar(&c.analyzeFile, "analyze", "", "Print an entropy quality analysis of a WAV file and exit, failing if it is below the thresholds")
+	fs.Float64Var(&c.thresholds.MinShannonEntropy, "analyze-min-shannon", audio.DefaultAnalysisThresholds.MinShannonEntropy, "Minimum byte entropy of -analyze, in bits per byte")
+	fs.Float64Var(&c.thresholds.MinMinEntropy, "analyze-min-entropy", audio.DefaultAnalysisThresholds.MinMinEntropy, "Minimum byte min-entropy of -analyze, in bits per byte")
+	fs.Float64Var(&c.thresholds.MinSpectralFlatness, "analyze-min-flatness", audio.DefaultAnalysisThresholds.MinSpectralFlatness, "Minimum spectral flatness of -analyze")
+	fs.Float64Var(&c.thresholds.MaxDCOffset, "analyze-max-dc", audio.DefaultAnalysisThresholds.MaxDCOffset, "Maximum absolute DC offset of -analyze")
+
+	// Set the version flag.
+	fs.BoolVar(&c.showVersion, "version", false, "Print the version and build information and exit")
+
+	// Set the decimation flag.
+	fs.IntVar(&c.decimate, "decimate", 1, "Keep only every Nth frame of the audio before hashing it")
+
+	// Set the mnemonic source flag.
+	fs.BoolVar(&c.useDerivedKey, "use-derived-key", false, "Generate the mnemonic from the HKDF-derived key instead of the combined hash (requires -hkdf-salt audio)")
+	fs.StringVar(&c.keyFormat, "key-format", "", "Also print the HKDF-derived key of -use-derived-key as \""+crypto.KeyFormatHex+"\", \""+crypto.KeyFormatPEM+"\" or \""+crypto.KeyFormatJWK+"\"")
+
+	// Set the password flags.
+	fs.IntVar(&c.password, "password", 0, "Print a random password of this many characters instead of a mnemonic (see README)")
+	fs.StringVar(&c.passwordAlphabet, "password-alphabet", crypto.Base58Alphabet, "Characters of the -password password")
+
+	// Set the extra entropy flags.
+	fs.StringVar(&c.extraEntropy, "extra-entropy", "", "File or device (e.g. /dev/hwrng) to read additional entropy from")
+	fs.IntVar(&c.extraEntropyBytes, "extra-entropy-bytes", 32, "Number of bytes to read from -extra-entropy")
+	fs.BoolVar(&c.topUp, "topup", false, "Make up for audio holding less than 256 bits of entropy with bytes of the system RNG")
+	fs.BoolVar(&c.timingEntropy, "timing-entropy", false, "Also mix in the timing jitter of random typing on stdin during the recording")
+
+	// Set the scheme version flag.
+	fs.IntVar(&c.schemeVersion, "scheme-version", crypto.SchemeVersion, "Version of the mixing and derivation scheme (0 is the legacy untagged scheme)")
+
+	// Set the personalization flag.
+	fs.StringVar(&c.personalization, "personalize", "", "Personalize the mnemonic for an application, so that the same inputs produce different mnemonics for different applications")
+
+	// Set the playback flag.
+	fs.BoolVar(&c.playback, "playback", false, "Play the recorded audio back through the default output device")
+
+	// Set the hash rounds flag.
+	fs.IntVar(&c.hashRounds, "hash-rounds", 1, "Number of SHA-256 rounds applied to the combined data")
+
+	// Set the combined data order flag.
+	fs.StringVar(&c.order, "order", orderRNGFirst, "Order of the generated entropy and the audio hash in the combined data: \""+orderRNGFirst+"\" or \""+orderAudioFirst+"\"")
+
+	// Set the consistency check flag.
+	fs.BoolVar(&c.consistencyCheck, "consistency-check", false, "Also generate the mnemonic with the aeb library from the same entropy and audio, and abort if they differ")
+
+	// Set the entropy passphrase flag.
+	fs.BoolVar(&c.entropyPassphrase, "entropy-passphrase", false, "Fold the passphrase in $"+entropyPassphraseEnv+" into the entropy, so that the mnemonic depends on it")
+
+	// Set the entropy split flag.
+	fs.StringVar(&c.split, "split", "", "Compose the mnemonic entropy of RNG and audio bits, e.g. \"128:128\", instead of mixing them")
+
+	// Set the screen clearing flag.
+	fs.BoolVar(&c.noColor, "no-color", false, "Do not color the volume bar (implied by NO_COLOR or when the output is not a terminal)")
+	fs.BoolVar(&c.noClear, "no-clear", false, "Do not clear the screen before and after recording (implied when the output is not a terminal)")
+
+	// Set the compression flag.
+	fs.BoolVar(&c.compress, "compress", false, "Save the audio gzip-compressed, to "+savedAudioDataFilename+".gz")
+
+	// Set the audio hash flag.
+	fs.BoolVar(&c.audioHashOnly, "audio-hash-only", false, "Print the SHA-256 hash of the audio instead of saving the audio file")
+
+	// Set the temporary audio flags.
+	fs.BoolVar(&c.tempAudio, "temp-audio", false, "Save the audio to a private file in the temporary directory instead of the working directory")
+	fs.BoolVar(&c.deleteAudio, "delete-audio", false, "Delete the temporary audio file of -temp-audio on exit")
+
+	// Set the seed type flag.
+	fs.StringVar(&c.seedType, "seed-type", seedTypeBIP39, "Kind of phrase to generate: \""+seedTypeBIP39+"\" or \""+seedTypeElectrum+"\" (Electrum segwit seed)")
+
+	// Set the mnemonic length flags.
+	fs.IntVar(&c.words, "words", 24, "Number of words of the BIP-39 mnemonic: 12, 15, 18, 21 or 24")
+	fs.StringVar(&c.truncateMode, "truncate-mode", crypto.TruncateModeTruncate, "How shorter mnemonics take their entropy from the mixed 256 bits: \""+crypto.TruncateModeTruncate+"\" or \""+crypto.TruncateModeHKDF+"\"")
+
+	// Set the mnemonic count flag.
+	fs.IntVar(&c.count, "count", 1, "Number of independent mnemonics to derive from the recording")
+
+	// Set the output flags.
+	fs.BoolVar(&c.stdout, "stdout", true, "Print the mnemonic")
+	fs.BoolVar(&c.onePerLine, "one-per-line", false, "Print the mnemonic words one per line, without numbering")
+	fs.StringVar(&c.mnemonicOut, "mnemonic-out", savedMnemonicFilename, "File to save the mnemonic to, or \"\" not to save it")
+	fs.StringVar(&c.csvOut, "csv-out", "", "Also save the mnemonic words with their positions and wordlist indices to a CSV file")
+	fs.StringVar(&c.jsonOut, "json-out", "", "Also save the mnemonic, its words and wordlist indices to a JSON file")
+	fs.StringVar(&c.encryptedOut, "encrypted-out", "", "Also save the mnemonic encrypted with the passphrase in $"+passphraseEnv)
+	fs.StringVar(&c.qrOut, "qr-out", "", "Also save the mnemonic as a SeedQR code to a PNG file")
+	fs.StringVar(&c.seedFileOut, "export-seed-file", "", "Also save the 64-byte BIP-39 seed of the mnemonic to a binary seed file (see README)")
+	fs.BoolVar(&c.allowSymlink, "allow-symlink", false, "Write the mnemonic files even if they or their directories are symlinks")
+
+	// Set the SeedQR flag.
+	fs.BoolVar(&c.seedQR, "seedqr", false, "Also print the mnemonic in the SeedQR numeric format")
+
+	// Set the checksum flag.
+	fs.BoolVar(&c.showChecksum, "show-checksum", false, "Also print the BIP-39 checksum bits of the mnemonic")
+
+	// Set the entropy output flag.
+	fs.BoolVar(&c.entropyOut, "entropy-out", false, "Also print the BIP-39 entropy of the mnemonic in hex, to cross-check it with other tools")
+
+	// Set the master key flags.
+	fs.BoolVar(&c.masterKey, "master-key", false, "Also print the BIP-32 master private key of the mnemonic")
+	fs.StringVar(&c.network, "network", crypto.NetworkMainnet, "Network of the -master-key version bytes and -show-addresses addresses: \""+crypto.NetworkMainnet+"\" (xprv, bc1) or \""+crypto.NetworkTestnet+"\" (tprv, tb1)")
+
+	// Set the addresses flag.
+	fs.IntVar(&c.showAddresses, "show-addresses", 0, "Also print the first N BIP-84 (native segwit) receive addresses of the mnemonic")
+
+	// Set the verification word flag.
+	fs.BoolVar(&c.verificationWord, "verification-word", false, "Also print a word derived from the hash of the mnemonic, to check a handwritten copy with the verify command")
+
+	// Set the wallet ID flag.
+	fs.BoolVar(&c.walletID, "wallet-id", false, "Also print a short fingerprint of the BIP-39 seed to label backups")
+}
+
+// validate checks the flag values that cannot be checked by the flag package, stage by stage.
+func (c *recordConfig) validate() error {
+	if err := c.validateInput(); err != nil {
+		return err
+	}
+	if err := c.validateMix(); err != nil {
+		return err
+	}
+	return c.validateOutput()
+}
+
+// debugPrint prints the formatted debug output in debug mode.
+func (c *recordConfig) debugPrint(format string, args ...interface{}) {
+	if c.debugMode {
+		fmt.Printf(format, args...)
+	}
+}
+
+// clearScreen clears the terminal, unless debug mode or -no-clear is set or the output is not a terminal,
+// so that the scrollback is kept when it matters.
+func (c *recordConfig) clearScreen() {
+	if c.shouldClear(os.Stdout) {
+		utils.ClearScreen()
+	}
+}
+
+// shouldClear reports whether clearScreen clears the output: only a terminal, outside debug mode and without
+// -no-clear.
+func (c *recordConfig) shouldClear(out interface{ Stat() (os.FileInfo, error) }) bool {
+	return !c.debugMode && !c.noClear && utils.IsTerminal(out)
+}
+
+// startSpinner shows a spinner with the label on stderr while slow work runs, and returns the function that stops
+// it. Nothing is shown unless shouldSpin allows it.
+func (c *recordConfig) startSpinner(label string) func() {
+	if !c.shouldSpin(os.Stderr) {
+		return func() {}
+	}
+	return utils.StartSpinner(os.Stderr, label, utils.SpinnerInterval)
+}
+
+// shouldSpin reports whether a spinner is shown on the output: only a terminal, outside debug mode, whose
+// output would interleave with it.
+func (c *recordConfig) shouldSpin(out interface{ Stat() (os.FileInfo, error) }) bool {
+	return !c.debugMode && utils.IsTerminal(out)
+}
+
+// secretHex formats a secret value for the debug output in hex, masked unless -i-understand-the-risk is set,
+// so that a screenshot of the debug output does not leak it.
+func (c *recordConfig) secretHex(secret []byte) string {
+	if c.showSecrets {
+		return hex.EncodeToString(secret)
+	}
+	return strings.Repeat("*", hex.EncodedLen(len(secret))) + " (masked, see -i-understand-the-risk)"
+}
+
+// colorEnabled reports whether the standard output may be colored (see shouldColor).
+func (c *recordConfig) colorEnabled() bool {
+	return c.shouldColor(os.Stdout)
+}
+
+// shouldColor reports whether the output may be colored: not with -no-color, when the NO_COLOR environment
+// variable is set (see no-color.org), or when the output is not a terminal, e.g. when redirected to a file.
+func (c *recordConfig) shouldColor(out interface{ Stat() (os.FileInfo, error) }) bool {
+	return !c.noColor && os.Getenv("NO_COLOR") == "" && utils.IsTerminal(out)
+}
+
+// runRecord records audio, or reads it from an input, and generates a mnemonic from it, in three stages: the
+// input stage (input.go) obtains and hashes the audio, the mix stage (mix.go) derives the mnemonics from it, and
+// the output stage (sinks.go) displays and saves them.
+func runRecord(args []string) error {
+	cfg := recordConfig{rng: rand.Reader}
+	fs := newFlagSet("record")
+	cfg.registerFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := cfg.validate(); err != nil {
+		return usageError{err}
+	}
+
+	// Print the version and exit if requested.
+	if cfg.showVersion {
+		printVersion()
+		return nil
+	}
+
+	// Inspect the WAV file and exit if requested.
+	if cfg.inspectFile != "" {
+		return inspectWAV(cfg.inspectFile)
+	}
+
+	// List the wordlists and exit if requested.
+	if cfg.listWordlists {
+		return listWordlists()
+	}
+
+	// Analyze the WAV file and exit if requested.
+	if cfg.analyzeFile != "" {
+		return analyzeWAV(cfg.analyzeFile, cfg.thresholds)
+	}
+
+	// Monitor the input levels and exit if requested.
+	if cfg.monitor {
+		return cfg.monitorLevels()
+	}
+
+	return cfg.generate()
+}
+
+// generate runs the input, mix and output stages of the record command.
+func (c *recordConfig) generate() error {
+	// Obtain the audio data, either from an input or by recording it.
+	var in *capturedAudio
+	var err error
+	if c.inputFile != "" {
+		in, err = c.readInput()
+	} else {
+		in, err = c.captureAudio()
+	}
+	if err != nil {
+		return err
+	}
+	if err := c.processInput(in); err != nil {
+		return err
+	}
+
+	mnemonicInput, err := c.deriveMnemonicInput(in)
+	if err != nil {
+		return err
+	}
+	// Keep the mnemonic input out of swap, and wipe it on return.
+	defer lockSecret(mnemonicInput)()
+
+	mnemonics, password, err := c.generateSecrets(mnemonicInput)
+	if err != nil {
+		return err
+	}
+	return c.writeOutputs(in, mnemonics, password)
+}
+
+// inspectWAV prints the properties of a WAV file.
+func inspectWAV(filename string) error {
+	info, err := utils.InspectWAV(filename)
+	if err != nil {
+		return fmt.Errorf("error inspecting %s: %w", filename, err)
+	}
+
+	encoding := "PCM"
+	if info.AudioFormat == utils.AudioFormatIEEEFloat {
+		encoding = "IEEE float"
+	}
+	fmt.Printf("File: %s\n", filename)
+	fmt.Printf("Sample rate: %d Hz\n", info.SampleRate)
+	fmt.Printf("Channels: %d\n", info.NumChannels)
+	fmt.Printf("Bit depth: %d (%s)\n", info.BitsPerSample, encoding)
+	fmt.Printf("Samples: %d\n", info.NumSamples)
+	fmt.Printf("Duration: %s\n", info.Duration)
+
+	return nil
+}
+
+// listWordlists prints the embedded wordlists and their word counts, and returns an error if any of them
+// fails its integrity check.
+func listWordlists() error {
+	var invalid int
+	for _, wordlist := range crypto.Wordlists {
+		status := "ok"
+		if err := wordlist.Check(); err != nil {
+			status = err.Error()
+			invalid++
+		}
+		fmt.Printf("%s: %d words, %s\n", wordlist.Language, len(wordlist.Words), status)
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%w: %d of %d wordlists failed the integrity check", crypto.ErrInvalidWordlist, invalid, len(crypto.Wordlists))
+	}
+	return nil
+}
+
+// analyzeWAV prints the quality analysis of a WAV file and returns an error if it fails the thresholds.
+func analyzeWAV(filename string, thresholds audio.AnalysisThresholds) error {
+	data, format, err := utils.LoadAudioDataFromFileWithFormat(filename)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", filename, err)
+	}
+	samples, err := utils.DecodeSamples(data, format)
+	if err != nil {
+		return fmt.Errorf("error decoding %s: %w", filename, err)
+	}
+
+	analysis := audio.Analyze(samples, data, thresholds)
+	fmt.Printf("File: %s\n", filename)
+	fmt.Printf("Byte entropy: %.2f bits/byte\n", analysis.ShannonEntropy)
+	fmt.Printf("Min-entropy: %.2f bits/byte\n", analysis.MinEntropy)
+	fmt.Printf("Spectral flatness: %.3f\n", analysis.SpectralFlatness)
+	fmt.Printf("DC offset: %.4f\n", analysis.DCOffset)
+	fmt.Printf("Peak: %.4f\n", analysis.Peak)
+
+	if !analysis.Passed() {
+		for _, failure := range analysis.Failures {
+			fmt.Printf("Fail: %s\n", failure)
+		}
+		return fmt.Errorf("%s failed the quality analysis", filename)
+	}
+	fmt.Println("Verdict: pass")
+	return nil
+}
@@ -0,0 +1,517 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	mathrand "math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/audio"
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/crypto"
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/utils"
+	"github.com/tyler-smith/go-bip39"
+)
+
+// newTestConfig parses the record flags of args into a config, as runRecord does.
+func newTestConfig(t *testing.T, args ...string) *recordConfig {
+	t.Helper()
+	cfg := &recordConfig{rng: rand.Reader}
+	fs := flag.NewFlagSet("record", flag.ContinueOnError)
+	cfg.registerFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("parsing %q: %v", args, err)
+	}
+	return cfg
+}
+
+// chdirTemp changes the working directory to a temporary directory for the duration of the test, so that the
+// files saved by the record command are removed afterwards.
+func chdirTemp(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Error(err)
+		}
+	})
+	return dir
+}
+
+// writeNoiseWAV saves a second of white noise to a 16-bit mono WAV file and returns its audio data.
+func writeNoiseWAV(t *testing.T, filename string) []byte {
+	t.Helper()
+	return writeSeededNoiseWAV(t, filename, 1)
+}
+
+// writeSeededNoiseWAV is writeNoiseWAV with the noise of another seed.
+func writeSeededNoiseWAV(t *testing.T, filename string, seed int64) []byte {
+	t.Helper()
+	r := mathrand.New(mathrand.NewSource(seed))
+	noise := make([]float32, 44100)
+	for i := range noise {
+		noise[i] = float32(1.8*r.Float64() - 0.9)
+	}
+	data := utils.Float32ToByteSlice(noise)
+	if err := utils.SaveAudioDataToFile(filename, data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestValidateDefaults(t *testing.T) {
+	if err := newTestConfig(t).validate(); err != nil {
+		t.Errorf("validate() with the default flags: %v", err)
+	}
+}
+
+func TestValidateStages(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		validate func(c *recordConfig) error
+		want     string
+	}{
+		{"input", []string{"-decimate", "0"}, (*recordConfig).validateInput, "-decimate"},
+		{"input", []string{"-append-to", "a.wav", "-input-file", "b.wav"}, (*recordConfig).validateInput, "-append-to"},
+		{"input", []string{"-mains", "55"}, (*recordConfig).validateInput, "-mains"},
+		{"input", []string{"-latency", "medium"}, (*recordConfig).validateInput, "latency"},
+		{"input", []string{"-backend", "alsa"}, (*recordConfig).validateInput, "backend"},
+		{"input", []string{"-stream-to", "127.0.0.1:9000", "-input-file", "a.wav"}, (*recordConfig).validateInput, "-stream-to"},
+		{"input", []string{"-allow-remote"}, (*recordConfig).validateInput, "-allow-remote"},
+		{"input", []string{"-hash-scope", "wav", "-gain", "2"}, (*recordConfig).validateInput, "-hash-scope wav"},
+		{"input", []string{"-hash-scope", "wav", "-dither"}, (*recordConfig).validateInput, "-hash-scope wav"},
+		{"input", []string{"-hash-scope", "wav", "-channels", "2", "-swap-channels"}, (*recordConfig).validateInput, "-hash-scope wav"},
+		{"mix", []string{"-hash-rounds", "0"}, (*recordConfig).validateMix, "-hash-rounds"},
+		{"mix", []string{"-words", "13"}, (*recordConfig).validateMix, "-words"},
+		{"mix", []string{"-password", "-1"}, (*recordConfig).validateMix, "0 (off) or between 1 and"},
+		{"mix", []string{"-password", "1025"}, (*recordConfig).validateMix, "-password"},
+		{"output", []string{"-delete-audio"}, (*recordConfig).validateOutput, "-delete-audio"},
+		{"output", []string{"-show-addresses", "101"}, (*recordConfig).validateOutput, "-show-addresses"},
+	}
+	for _, tt := range tests {
+		cfg := newTestConfig(t, tt.args...)
+		err := tt.validate(cfg)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("validate %s %q = %v, want an error about %s", tt.name, tt.args, err, tt.want)
+		}
+		if err := cfg.validate(); err == nil {
+			t.Errorf("validate() %q succeeded, want the %s stage error", tt.args, tt.name)
+		}
+	}
+}
+
+func TestAnalyzeWAV(t *testing.T) {
+	dir := t.TempDir()
+	noiseFile := filepath.Join(dir, "noise.wav")
+	writeNoiseWAV(t, noiseFile)
+	if err := analyzeWAV(noiseFile, audio.DefaultAnalysisThresholds); err != nil {
+		t.Errorf("analyzeWAV of noise: %v", err)
+	}
+
+	silentFile := filepath.Join(dir, "silence.wav")
+	if err := utils.SaveAudioDataToFile(silentFile, make([]byte, 2<<14)); err != nil {
+		t.Fatal(err)
+	}
+	if err := analyzeWAV(silentFile, audio.DefaultAnalysisThresholds); err == nil {
+		t.Error("analyzeWAV of silence passed")
+	}
+}
+
+func TestEmptyAudio(t *testing.T) {
+	chdirTemp(t)
+	if err := utils.SaveAudioDataToFile("empty.wav", nil); err != nil {
+		t.Fatal(err)
+	}
+	args := []string{"-input-file", "empty.wav", "-stdout=false", "-mnemonic-out", "", "-json-out", "mnemonic.json"}
+
+	cfg := newTestConfig(t, args...)
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.generate(); !errors.Is(err, audio.ErrNoAudioCaptured) {
+		t.Fatalf("generate() without audio = %v, want ErrNoAudioCaptured", err)
+	}
+	if _, err := os.Stat("mnemonic.json"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("a mnemonic was saved without audio (%v)", err)
+	}
+
+	cfg = newTestConfig(t, append(args, "-allow-empty-audio")...)
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.generate(); err != nil {
+		t.Fatalf("generate() without audio under -allow-empty-audio: %v", err)
+	}
+	contents, err := os.ReadFile("mnemonic.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var document utils.MnemonicJSON
+	if err := json.Unmarshal(contents, &document); err != nil {
+		t.Fatal(err)
+	}
+	if !bip39.IsMnemonicValid(document.Mnemonic) {
+		t.Errorf("mnemonic from the system RNG alone %q is not valid", document.Mnemonic)
+	}
+}
+
+func TestAudioHashOnly(t *testing.T) {
+	chdirTemp(t)
+	data := writeNoiseWAV(t, "input.wav")
+	cfg := newTestConfig(t, "-input-file", "input.wav", "-audio-hash-only", "-stdout=false", "-mnemonic-out", "", "-json-out", "mnemonic.json")
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.generate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(cfg.audioFilename()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("-audio-hash-only saved %s (%v)", cfg.audioFilename(), err)
+	}
+	contents, err := os.ReadFile("mnemonic.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var document utils.MnemonicJSON
+	if err := json.Unmarshal(contents, &document); err != nil {
+		t.Fatal(err)
+	}
+	hash := crypto.HashAudioData(data)
+	if want := hex.EncodeToString(hash[:]); document.AudioHash != want {
+		t.Errorf("JSON audio hash = %s, want the hash of the input audio %s", document.AudioHash, want)
+	}
+}
+
+func TestReport(t *testing.T) {
+	chdirTemp(t)
+	data := writeNoiseWAV(t, "input.wav")
+	cfg := newTestConfig(t, "-input-file", "input.wav", "-report", "-stdout=false", "-mnemonic-out", "mnemonic.txt")
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.generate(); err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := os.ReadFile(savedReportFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(contents, &fields); err != nil {
+		t.Fatalf("report is not JSON: %v", err)
+	}
+	for _, field := range []string{"sample_rate", "channels", "duration_seconds", "discarded_buffers", "rms", "peak",
+		"shannon_entropy", "min_entropy", "spectral_flatness", "audio_hash"} {
+		if _, ok := fields[field]; !ok {
+			t.Errorf("report has no %q field", field)
+		}
+	}
+
+	var report utils.ReportJSON
+	if err := json.Unmarshal(contents, &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.SampleRate != 44100 || report.Channels != 1 || report.Duration != 1 {
+		t.Errorf("report of %d Hz, %d channels and %v s, want the 44100 Hz, 1 channel and 1 s of the input", report.SampleRate, report.Channels, report.Duration)
+	}
+	hash := crypto.HashAudioData(data)
+	if want := hex.EncodeToString(hash[:]); report.AudioHash != want {
+		t.Errorf("report audio hash = %s, want %s", report.AudioHash, want)
+	}
+
+	// The report never holds the mnemonic.
+	mnemonic, err := utils.LoadMnemonicFromFile("mnemonic.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fields["mnemonic"]; ok || strings.Contains(string(contents), mnemonic) {
+		t.Error("report contains the mnemonic")
+	}
+}
+
+func TestHashScope(t *testing.T) {
+	chdirTemp(t)
+	data := writeNoiseWAV(t, "input.wav")
+	audioHash := func(scope string) string {
+		t.Helper()
+		cfg := newTestConfig(t, "-input-file", "input.wav", "-hash-scope", scope, "-stdout=false", "-mnemonic-out", "", "-json-out", "mnemonic.json")
+		if err := cfg.validate(); err != nil {
+			t.Fatal(err)
+		}
+		if err := cfg.generate(); err != nil {
+			t.Fatal(err)
+		}
+		contents, err := os.ReadFile("mnemonic.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var document utils.MnemonicJSON
+		if err := json.Unmarshal(contents, &document); err != nil {
+			t.Fatal(err)
+		}
+		return document.AudioHash
+	}
+
+	pcm := audioHash(hashScopePCM)
+	if hash := crypto.HashAudioData(data); pcm != hex.EncodeToString(hash[:]) {
+		t.Errorf("pcm scope hash = %s, want the hash of the samples %x", pcm, hash)
+	}
+	wav := audioHash(hashScopeWAV)
+	saved, err := os.ReadFile(savedAudioDataFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash := crypto.HashAudioData(saved); wav != hex.EncodeToString(hash[:]) {
+		t.Errorf("wav scope hash = %s, want the hash of the written file %x", wav, hash)
+	}
+	if pcm == wav {
+		t.Error("the pcm and wav scopes give the same hash")
+	}
+}
+
+func TestRemoveDCReport(t *testing.T) {
+	chdirTemp(t)
+	noise := make([]float32, 44100)
+	r := mathrand.New(mathrand.NewSource(2))
+	for i := range noise {
+		noise[i] = float32(0.8*r.Float64()-0.4) + 0.25
+	}
+	if err := utils.SaveAudioDataToFile("input.wav", utils.Float32ToByteSlice(noise)); err != nil {
+		t.Fatal(err)
+	}
+	cfg := newTestConfig(t, "-input-file", "input.wav", "-remove-dc", "-report", "-stdout=false", "-mnemonic-out", "")
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.generate(); err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := os.ReadFile(savedReportFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report utils.ReportJSON
+	if err := json.Unmarshal(contents, &report); err != nil {
+		t.Fatal(err)
+	}
+	// The report shows the offset before and after its removal.
+	if math.Abs(report.RemovedDCOffset-0.25) > 0.01 || math.Abs(report.DCOffset) > 1e-4 {
+		t.Errorf("report DC offset is %.4f before removal and %.4f after, want about 0.25 and 0", report.RemovedDCOffset, report.DCOffset)
+	}
+}
+
+func TestTopUpReport(t *testing.T) {
+	chdirTemp(t)
+	// A few samples of audio hold far less than 256 bits of entropy.
+	data := utils.Float32ToByteSlice([]float32{0.1, -0.3, 0.7, 0.2, -0.9, 0.4, -0.1, 0.6})
+	if err := utils.SaveAudioDataToFile("input.wav", data); err != nil {
+		t.Fatal(err)
+	}
+	samples, err := utils.DecodeSamples(data, utils.WAVFormat{AudioFormat: utils.AudioFormatPCM, BitsPerSample: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deficit := int(math.Ceil((estimateTargetBits - audio.EstimateTotalEntropy(samples)) / 8))
+	if deficit <= 0 {
+		t.Fatalf("the test audio holds %v bits, want a deficit", audio.EstimateTotalEntropy(samples))
+	}
+
+	cfg := newTestConfig(t, "-input-file", "input.wav", "-topup", "-report", "-stdout=false", "-mnemonic-out", "")
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.generate(); err != nil {
+		t.Fatal(err)
+	}
+	contents, err := os.ReadFile(savedReportFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report utils.ReportJSON
+	if err := json.Unmarshal(contents, &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.TopUpBytes != deficit {
+		t.Errorf("report records %d top-up bytes, want the deficit of %d", report.TopUpBytes, deficit)
+	}
+}
+
+// fakeTerminal is an output whose Stat reports a character device, like a terminal.
+type fakeTerminal struct{}
+
+func (fakeTerminal) Stat() (os.FileInfo, error) {
+	return terminalInfo{}, nil
+}
+
+// terminalInfo is the os.FileInfo of fakeTerminal; only its mode is used.
+type terminalInfo struct {
+	os.FileInfo
+}
+
+func (terminalInfo) Mode() os.FileMode {
+	return os.ModeDevice | os.ModeCharDevice | 0620
+}
+
+func TestShouldClear(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "output.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	tests := []struct {
+		args []string
+		out  interface{ Stat() (os.FileInfo, error) }
+		want bool
+	}{
+		{nil, fakeTerminal{}, true},
+		{[]string{"-no-clear"}, fakeTerminal{}, false},
+		{[]string{"-debug"}, fakeTerminal{}, false},
+		// A redirected output is never cleared.
+		{nil, file, false},
+	}
+	for _, tt := range tests {
+		if got := newTestConfig(t, tt.args...).shouldClear(tt.out); got != tt.want {
+			t.Errorf("shouldClear(%T) with %q = %v, want %v", tt.out, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestShouldSpin(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "output.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if !newTestConfig(t).shouldSpin(fakeTerminal{}) {
+		t.Error("no spinner on a terminal")
+	}
+	if newTestConfig(t, "-debug").shouldSpin(fakeTerminal{}) {
+		t.Error("spinner in debug mode")
+	}
+	if newTestConfig(t).shouldSpin(file) {
+		t.Error("spinner on a redirected output")
+	}
+}
+
+func TestShouldColor(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "output.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	tests := []struct {
+		args    []string
+		noColor string
+		out     interface{ Stat() (os.FileInfo, error) }
+		want    bool
+	}{
+		{nil, "", fakeTerminal{}, true},
+		{[]string{"-no-color"}, "", fakeTerminal{}, false},
+		{nil, "1", fakeTerminal{}, false},
+		// A redirected output is never colored.
+		{nil, "", file, false},
+	}
+	for _, tt := range tests {
+		t.Setenv("NO_COLOR", tt.noColor)
+		if got := newTestConfig(t, tt.args...).shouldColor(tt.out); got != tt.want {
+			t.Errorf("shouldColor(%T) with %q and NO_COLOR=%q = %v, want %v", tt.out, tt.args, tt.noColor, got, tt.want)
+		}
+	}
+}
+
+func TestSaveClips(t *testing.T) {
+	chdirTemp(t)
+	// Three clips of different lengths, as recorded with -clips 3 -save-clips.
+	clipLengths := []int{4410, 8820, 2205}
+	samples := make([]float32, 4410+8820+2205)
+	for i := range samples {
+		samples[i] = float32(i%200-100) / 100
+	}
+	data := utils.Float32ToByteSlice(samples)
+	if err := saveClips(data, clipLengths, utils.DefaultWAVFormat); err != nil {
+		t.Fatal(err)
+	}
+
+	offset := 0
+	for i, length := range clipLengths {
+		name := fmt.Sprintf(savedClipFilename, i+1)
+		clip, err := utils.LoadAudioDataFromFile(name)
+		if err != nil {
+			t.Errorf("clip %d: %v", i+1, err)
+			continue
+		}
+		if want := data[offset : offset+2*length]; !bytes.Equal(clip, want) {
+			t.Errorf("%s holds %d bytes, want the %d bytes of clip %d", name, len(clip), len(want), i+1)
+		}
+		offset += 2 * length
+	}
+	if _, err := os.Stat(fmt.Sprintf(savedClipFilename, len(clipLengths)+1)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("a fourth clip file was saved (%v)", err)
+	}
+}
+
+func TestTempAudio(t *testing.T) {
+	chdirTemp(t)
+	writeNoiseWAV(t, "input.wav")
+	tempDir := t.TempDir()
+	t.Setenv("TMPDIR", tempDir)
+	generate := func(args ...string) []string {
+		t.Helper()
+		cfg := newTestConfig(t, append([]string{"-input-file", "input.wav", "-temp-audio", "-stdout=false", "-mnemonic-out", ""}, args...)...)
+		if err := cfg.validate(); err != nil {
+			t.Fatal(err)
+		}
+		if err := cfg.generate(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(savedAudioDataFilename); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("-temp-audio saved %s in the working directory (%v)", savedAudioDataFilename, err)
+		}
+		matches, err := filepath.Glob(filepath.Join(tempDir, "audio-data-*.wav"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return matches
+	}
+
+	kept := generate()
+	if len(kept) != 1 {
+		t.Fatalf("-temp-audio left %q in the temporary directory, want one audio file", kept)
+	}
+	info, err := os.Stat(kept[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 || info.Size() <= 44 {
+		t.Errorf("temporary audio file has permissions %v and %d bytes, want 0600 and the audio", perm, info.Size())
+	}
+	if err := os.Remove(kept[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if deleted := generate("-delete-audio"); len(deleted) != 0 {
+		t.Errorf("-delete-audio left %q in the temporary directory", deleted)
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/crypto"
+)
+
+// runSelftest runs the known-answer tests of the mnemonic generation.
+func runSelftest(args []string) error {
+	fs := newFlagSet("selftest")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if err := crypto.SelfTest(); err != nil {
+		return err
+	}
+	fmt.Println("Self-test passed")
+
+	return nil
+}
@@ -0,0 +1,502 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/crypto"
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/qr"
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/utils"
+)
+
+const (
+	// passphraseEnv is the environment variable holding the passphrase of -encrypted-out and decrypt.
+	passphraseEnv = "AEB_PASSPHRASE"
+	// entropyPassphraseEnv is the environment variable holding the passphrase of -entropy-passphrase.
+	entropyPassphraseEnv = "AEB_ENTROPY_PASSPHRASE"
+
+	qrScale = 8 // Pixels per module of the -qr-out image
+)
+
+// sink writes a generated mnemonic to one destination.
+type sink struct {
+	name  string
+	write func(mnemonic string) error
+}
+
+// mnemonicNumber returns the 1-based number of the ith mnemonic with -count, or 0 for a single mnemonic.
+func (c *recordConfig) mnemonicNumber(i int) int {
+	if c.count > 1 {
+		return i + 1
+	}
+	return 0
+}
+
+// numberedFilename inserts the number of a mnemonic before the extension of filename, e.g. mnemonic-2.txt.
+// Number 0 leaves filename unchanged.
+func numberedFilename(filename string, number int) string {
+	if filename == "" || number == 0 {
+		return filename
+	}
+	ext := filepath.Ext(filename)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(filename, ext), number, ext)
+}
+
+// sinks returns the sinks enabled by the flags, in the order they are written, for the mnemonic with the
+// given number (see mnemonicNumber) generated from audio with the given hash.
+func (c *recordConfig) sinks(number int, audioHash [32]byte) []sink {
+	var sinks []sink
+	if c.stdout {
+		sinks = append(sinks, sink{name: "stdout", write: func(mnemonic string) error {
+			return c.printMnemonic(mnemonic, number)
+		}})
+	}
+	if name := numberedFilename(c.mnemonicOut, number); name != "" {
+		sinks = append(sinks, c.fileSink(name, func(mnemonic string) error {
+			fmt.Println("Saving mnemonic to file...")
+			return utils.SaveSecretToFile(name, []byte(mnemonic))
+		}))
+	}
+	if name := numberedFilename(c.csvOut, number); name != "" {
+		sinks = append(sinks, c.fileSink(name, func(mnemonic string) error {
+			fmt.Println("Saving mnemonic to CSV file...")
+			indices, err := crypto.MnemonicWordIndices(mnemonic)
+			if err != nil {
+				return fmt.Errorf("error looking up mnemonic words: %w", err)
+			}
+			return utils.SaveMnemonicToCSV(name, mnemonic, indices)
+		}))
+	}
+	if name := numberedFilename(c.jsonOut, number); name != "" {
+		sinks = append(sinks, c.fileSink(name, func(mnemonic string) error {
+			fmt.Println("Saving mnemonic to JSON file...")
+			indices, err := crypto.MnemonicWordIndices(mnemonic)
+			if err != nil {
+				return fmt.Errorf("error looking up mnemonic words: %w", err)
+			}
+			return utils.SaveMnemonicToJSON(name, utils.MnemonicJSON{
+				Scheme:    c.schemeVersion,
+				Mnemonic:  mnemonic,
+				Words:     strings.Fields(mnemonic),
+				Indices:   indices,
+				AudioHash: hex.EncodeToString(audioHash[:]),
+			})
+		}))
+	}
+	if name := numberedFilename(c.encryptedOut, number); name != "" {
+		sinks = append(sinks, c.fileSink(name, func(mnemonic string) error {
+			fmt.Println("Saving encrypted mnemonic to file...")
+			blob, err := crypto.EncryptWithPassphrase([]byte(mnemonic), []byte(os.Getenv(passphraseEnv)))
+			if err != nil {
+				return fmt.Errorf("error encrypting mnemonic: %w", err)
+			}
+			return utils.SaveSecretToFile(name, blob)
+		}))
+	}
+	if name := numberedFilename(c.qrOut, number); name != "" {
+		sinks = append(sinks, c.fileSink(name, func(mnemonic string) error {
+			fmt.Println("Saving SeedQR code to PNG file...")
+			digits, err := crypto.MnemonicToSeedQRDigits(mnemonic)
+			if err != nil {
+				return fmt.Errorf("error encoding SeedQR: %w", err)
+			}
+			code, err := qr.Encode(digits)
+			if err != nil {
+				return fmt.Errorf("error encoding QR code: %w", err)
+			}
+			return utils.SaveImageToPNG(name, code.Image(qrScale))
+		}))
+	}
+	if name := numberedFilename(c.seedFileOut, number); name != "" {
+		sinks = append(sinks, c.fileSink(name, func(mnemonic string) error {
+			fmt.Println("Saving seed to file...")
+			seed := crypto.DeriveSeed(mnemonic, "")
+			defer lockSecret(seed)()
+			data, err := crypto.EncodeSeedFile(seed)
+			if err != nil {
+				return fmt.Errorf("error encoding seed: %w", err)
+			}
+			return utils.SaveSecretToFileAtomically(name, data)
+		}))
+	}
+	return sinks
+}
+
+// fileSink returns the sink that writes the mnemonic to a file with write, after refusing a symlinked file or
+// directory on its path unless -allow-symlink is set.
+func (c *recordConfig) fileSink(name string, write func(mnemonic string) error) sink {
+	return sink{name: name, write: func(mnemonic string) error {
+		if !c.allowSymlink {
+			if err := utils.CheckNotSymlink(name); err != nil {
+				return fmt.Errorf("%w (pass -allow-symlink to write through it)", err)
+			}
+		}
+		return write(mnemonic)
+	}}
+}
+
+// writeSinks writes the mnemonic to every sink, and returns the errors of all the sinks that failed.
+func writeSinks(sinks []sink, mnemonic string) error {
+	var errs []error
+	for _, s := range sinks {
+		if err := s.write(mnemonic); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// formatWords joins the words of a mnemonic with the separator, e.g. a newline to print one word per line.
+func formatWords(mnemonic, separator string) string {
+	return strings.Join(strings.Fields(mnemonic), separator)
+}
+
+// printMnemonic displays the mnemonic with its number, and the scheme that produced it before the first one,
+// with the SeedQR digits, checksum bits, entropy, master key and wallet ID if requested.
+func (c *recordConfig) printMnemonic(mnemonic string, number int) error {
+	if number <= 1 {
+		fmt.Printf("Scheme: v%d\n", c.schemeVersion)
+		if c.personalization != "" {
+			fmt.Printf("Personalization: %s\n", c.personalization)
+		}
+		if c.seedType != seedTypeBIP39 {
+			fmt.Printf("Seed type: %s\n", c.seedType)
+		}
+	}
+	separator := " "
+	if c.onePerLine {
+		separator = "\n"
+	}
+	if number == 0 {
+		fmt.Printf("Mnemonic:%s%s\n", separator, formatWords(mnemonic, separator))
+	} else {
+		fmt.Printf("Mnemonic %d:%s%s\n", number, separator, formatWords(mnemonic, separator))
+	}
+
+	if c.seedQR {
+		digits, err := crypto.MnemonicToSeedQRDigits(mnemonic)
+		if err != nil {
+			return fmt.Errorf("error encoding SeedQR: %w", err)
+		}
+		fmt.Printf("SeedQR: %s\n", digits)
+	}
+
+	if c.showChecksum {
+		if err := printChecksum(mnemonic); err != nil {
+			return fmt.Errorf("generated mnemonic: %w", err)
+		}
+	}
+
+	if c.verificationWord {
+		word, err := crypto.VerificationWord(mnemonic)
+		if err != nil {
+			return fmt.Errorf("error computing verification word: %w", err)
+		}
+		fmt.Printf("Verification word: %s\n", word)
+	}
+
+	if c.entropyOut {
+		entropy, err := crypto.MnemonicEntropy(mnemonic)
+		if err != nil {
+			return fmt.Errorf("error decoding entropy: %w", err)
+		}
+		fmt.Printf("Entropy: %x\n", entropy)
+	}
+
+	if c.masterKey {
+		seed := crypto.DeriveSeed(mnemonic, "")
+		defer lockSecret(seed)()
+		key, err := crypto.DeriveMasterKey(seed, c.network)
+		if err != nil {
+			return fmt.Errorf("error deriving master key: %w", err)
+		}
+		fmt.Printf("Master key: %s\n", key)
+	}
+
+	if c.showAddresses > 0 {
+		seed := crypto.DeriveSeed(mnemonic, "")
+		defer lockSecret(seed)()
+		addresses, err := crypto.DeriveBIP84Addresses(seed, c.network, c.showAddresses)
+		if err != nil {
+			return fmt.Errorf("error deriving addresses: %w", err)
+		}
+		for i, address := range addresses {
+			fmt.Printf("Address %s: %s\n", crypto.BIP84Path(c.network, i), address)
+		}
+	}
+
+	if c.walletID {
+		fmt.Printf("Wallet ID: %s\n", crypto.MnemonicFingerprint(mnemonic))
+	}
+
+	return nil
+}
+
+// validateOutput checks the flags of the output stage, which saves the audio and displays and saves the
+// mnemonics.
+func (c *recordConfig) validateOutput() error {
+	if c.password > 0 && (c.seedType != seedTypeBIP39 || c.words != 24 || c.count > 1 || c.csvOut != "" || c.jsonOut != "" || c.encryptedOut != "" || c.qrOut != "" || c.seedFileOut != "" || c.seedQR || c.showChecksum || c.verificationWord || c.walletID || c.entropyOut || c.masterKey || c.showAddresses > 0 || c.verifySave) {
+		return errors.New("-password cannot be combined with -seed-type, -words, -count, -csv-out, -json-out, -encrypted-out, -qr-out, -export-seed-file, -seedqr, -show-checksum, -verification-word, -wallet-id, -entropy-out, -master-key, -show-addresses or -verify-save, which apply to mnemonics")
+	}
+	if c.seedType == seedTypeElectrum && (c.csvOut != "" || c.jsonOut != "" || c.qrOut != "" || c.seedFileOut != "" || c.seedQR || c.showChecksum || c.walletID || c.entropyOut || c.masterKey || c.showAddresses > 0) {
+		return errors.New("-seed-type electrum cannot be combined with -csv-out, -json-out, -qr-out, -export-seed-file, -seedqr, -show-checksum, -wallet-id, -entropy-out, -master-key or -show-addresses, which are specific to BIP-39")
+	}
+	if err := crypto.ValidateNetwork(c.network); err != nil {
+		return err
+	}
+	if c.showAddresses < 0 || c.showAddresses > crypto.MaxAddresses {
+		return fmt.Errorf("invalid -show-addresses %d: must be between 0 and %d", c.showAddresses, crypto.MaxAddresses)
+	}
+	if c.encryptedOut != "" && os.Getenv(passphraseEnv) == "" {
+		return fmt.Errorf("-encrypted-out requires a passphrase in $%s", passphraseEnv)
+	}
+	if c.tempAudio && c.audioHashOnly {
+		return errors.New("-temp-audio cannot be combined with -audio-hash-only, which does not save the audio")
+	}
+	if c.deleteAudio && !c.tempAudio {
+		return errors.New("-delete-audio requires -temp-audio")
+	}
+	if c.audioHashOnly && c.appendTo != "" {
+		return errors.New("-audio-hash-only cannot be combined with -append-to, which saves the audio")
+	}
+	if c.saveClips && c.endianness == endiannessBig {
+		return errors.New("-save-clips cannot be combined with -endianness big, as WAV files are little-endian")
+	}
+	if c.hashScope == hashScopeWAV && c.endianness == endiannessBig {
+		return errors.New("-hash-scope wav cannot be combined with -endianness big, which saves raw PCM")
+	}
+	if c.endianness == endiannessBig && (c.inputFile != "" || c.appendTo != "" || c.dither || c.compress || c.verifySave) {
+		return errors.New("-endianness big cannot be combined with -input-file, -append-to, -dither, -compress or -verify-save, which use WAV files")
+	}
+	return nil
+}
+
+// audioFilename returns the name of the file the audio is saved to.
+func (c *recordConfig) audioFilename() string {
+	if c.tempAudioPath != "" {
+		return c.tempAudioPath
+	}
+	if c.endianness == endiannessBig {
+		return savedRawPCMFilename
+	}
+	if c.compress {
+		return savedAudioDataFilename + ".gz"
+	}
+	return savedAudioDataFilename
+}
+
+// writeOutputs saves the derivation parameters and the audio, and displays and saves the mnemonics, or prints
+// the -password password, then verifies the saved files if requested.
+func (c *recordConfig) writeOutputs(in *capturedAudio, mnemonics []string, password string) error {
+	// Record how the mnemonic was derived if requested.
+	if c.saveParams {
+		params, err := c.params(in.format, in.hash)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Saving derivation parameters to file...")
+		if err := utils.SaveParamsToJSON(savedParamsFilename, params); err != nil {
+			return fmt.Errorf("error saving derivation parameters to file: %w", err)
+		}
+	}
+
+	// Save the audio to a private temporary file, removed on exit if requested.
+	if c.tempAudio {
+		path, err := createTempFile(c.audioFilename())
+		if err != nil {
+			return fmt.Errorf("error creating temporary audio file: %w", err)
+		}
+		c.tempAudioPath = path
+		fmt.Printf("Temporary audio file: %s\n", path)
+		if c.deleteAudio {
+			defer func() {
+				if err := os.Remove(path); err != nil {
+					fmt.Fprintf(os.Stderr, "Error deleting temporary audio file: %v\n", err)
+				}
+			}()
+		}
+	}
+
+	if err := c.saveAudio(in); err != nil {
+		return err
+	}
+
+	if password != "" {
+		fmt.Printf("Password: %s\n", password)
+	}
+
+	// Display and save the mnemonics, trying every sink even if one fails.
+	var errs []error
+	for i, mnemonic := range mnemonics {
+		if err := writeSinks(c.sinks(c.mnemonicNumber(i), in.hash), mnemonic); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("error writing mnemonic: %w", err)
+	}
+
+	// Verify the saved files if requested.
+	if c.verifySave {
+		fmt.Println("Verifying saved files...")
+		for i, mnemonic := range mnemonics {
+			audioFile := c.audioFilename()
+			if c.audioHashOnly {
+				audioFile = ""
+			}
+			mnemonicFile := numberedFilename(c.mnemonicOut, c.mnemonicNumber(i))
+			if err := verifySavedFiles(audioFile, in.saved, mnemonicFile, mnemonic, c.scheme()); err != nil {
+				return fmt.Errorf("error verifying saved files: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// saveAudio saves the audio in the format of the flags, or with -audio-hash-only prints its hash and wipes it
+// from memory instead.
+func (c *recordConfig) saveAudio(in *capturedAudio) error {
+	switch {
+	case c.audioHashOnly:
+		// Keep only the hash of the audio for auditing, and wipe the audio from memory.
+		fmt.Printf("Audio hash: %x\n", in.hash)
+		for _, buffer := range [][]byte{in.data, in.saved} {
+			for i := range buffer {
+				buffer[i] = 0
+			}
+		}
+		for i := range in.samples {
+			in.samples[i] = 0
+		}
+	case c.endianness == endiannessBig:
+		// WAV files are little-endian, so big-endian samples are saved as raw PCM.
+		fmt.Println("Saving raw big-endian audio data to file...")
+		if err := utils.SaveRawPCMToFile(c.audioFilename(), in.saved); err != nil {
+			return fmt.Errorf("error saving audio data to file: %w", err)
+		}
+	case c.compress:
+		// Save compressed audio data to file
+		fmt.Println("Saving compressed audio data to file...")
+		if err := utils.SaveCompressedAudioDataToFile(c.audioFilename(), in.saved, in.format); err != nil {
+			return fmt.Errorf("error saving audio data to file: %w", err)
+		}
+	default:
+		// Save audio data to file
+		fmt.Println("Saving audio data to file...")
+		if err := utils.SaveAudioDataToFileWithFormat(c.audioFilename(), in.saved, in.format); err != nil {
+			return fmt.Errorf("error saving audio data to file: %w", err)
+		}
+	}
+	return nil
+}
+
+// createTempFile creates an empty file, readable and writable only by the user, in the temporary directory,
+// with a random name built from the given one, e.g. "audio-data-123456.wav" for "audio-data.wav".
+func createTempFile(name string) (string, error) {
+	base := filepath.Base(name)
+	pattern := base + "-*"
+	if i := strings.Index(base, "."); i >= 0 {
+		pattern = base[:i] + "-*" + base[i:]
+	}
+
+	file, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", err
+	}
+	if err := file.Chmod(0600); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// params collects the derivation parameters for the -save-params file.
+func (c *recordConfig) params(format utils.WAVFormat, audioHash [32]byte) (utils.ParamsJSON, error) {
+	params := utils.ParamsJSON{
+		Scheme:       c.schemeVersion,
+		SeedType:     c.seedType,
+		Hash:         "sha256",
+		Mixer:        "combined-hash",
+		HashRounds:   c.hashRounds,
+		Count:        c.count,
+		SampleRate:   format.SampleRate,
+		Channels:     format.NumChannels,
+		BitDepth:     strconv.Itoa(format.BitsPerSample),
+		Downmix:      c.downmix,
+		Decimate:     c.decimate,
+		AudioHash:    hex.EncodeToString(audioHash[:]),
+		Reproducible: c.brainSong,
+	}
+	if format.AudioFormat == utils.AudioFormatIEEEFloat {
+		params.BitDepth = bitDepth32Float
+	}
+	if c.password > 0 {
+		params.PasswordLength, params.PasswordAlphabet = c.password, c.passwordAlphabet
+	} else if c.seedType == seedTypeBIP39 {
+		params.Words, params.TruncateMode = c.words, c.truncateMode
+	}
+	switch {
+	case c.brainSong:
+		params.Mixer = "brain-song"
+		params.BrainSongIterations = c.brainSongRounds
+	case c.useDerivedKey:
+		params.Mixer = "hkdf"
+	case c.split != "":
+		params.Mixer = "split"
+		params.Split = c.split
+	}
+	params.EntropyPassphrase = c.entropyPassphrase
+	params.Personalization = c.personalization
+	if params.Mixer == "combined-hash" {
+		params.Order = c.order
+	}
+
+	// Raw PCM read from stdin cannot be hashed again.
+	if c.inputFile != "" && c.inputFile != "-" {
+		data, err := os.ReadFile(c.inputFile)
+		if err != nil {
+			return utils.ParamsJSON{}, fmt.Errorf("error hashing %s: %w", c.inputFile, err)
+		}
+		hash := sha256.Sum256(data)
+		params.InputFile = c.inputFile
+		params.InputFileHash = hex.EncodeToString(hash[:])
+	}
+	return params, nil
+}
+
+// verifySavedFiles reads back the saved audio data and mnemonic and checks them against the in-memory values.
+// The audio data or the mnemonic is not checked when it was not saved to a file.
+func verifySavedFiles(audioFile string, audioData []byte, mnemonicFile, mnemonic string, scheme crypto.MnemonicScheme) error {
+	if audioFile != "" {
+		if err := utils.VerifyAudioDataFile(audioFile, audioData); err != nil {
+			return fmt.Errorf("audio data file %s: %w", audioFile, err)
+		}
+	}
+	if mnemonicFile == "" {
+		return nil
+	}
+
+	savedMnemonic, err := utils.LoadMnemonicFromFile(mnemonicFile)
+	if err != nil {
+		return fmt.Errorf("mnemonic file %s: %w", mnemonicFile, err)
+	}
+	if err := scheme.Validate(savedMnemonic); err != nil {
+		return fmt.Errorf("mnemonic file %s: %w", mnemonicFile, err)
+	}
+	if savedMnemonic != mnemonic {
+		return fmt.Errorf("mnemonic file %s: %w", mnemonicFile, utils.ErrMnemonicMismatch)
+	}
+
+	return nil
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/crypto"
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/utils"
+	"github.com/tyler-smith/go-bip39"
+)
+
+// testMnemonic is the BIP-39 mnemonic of 128 zero bits.
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func TestVerifySavedFiles(t *testing.T) {
+	dir := t.TempDir()
+	audioFile := filepath.Join(dir, "audio.wav")
+	mnemonicFile := filepath.Join(dir, "mnemonic.txt")
+	data := utils.Float32ToByteSlice([]float32{0.1, -0.2, 0.3, -0.4})
+	if err := utils.SaveAudioDataToFile(audioFile, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.SaveMnemonicToFile(mnemonicFile, testMnemonic); err != nil {
+		t.Fatal(err)
+	}
+	scheme := crypto.BIP39Scheme{Bits: 128}
+	if err := verifySavedFiles(audioFile, data, mnemonicFile, testMnemonic, scheme); err != nil {
+		t.Fatalf("verifySavedFiles of intact files: %v", err)
+	}
+
+	// A different valid mnemonic is caught by the comparison.
+	other := "legal winner thank year wave sausage worth useful legal winner thank yellow"
+	if err := utils.SaveMnemonicToFile(mnemonicFile, other); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifySavedFiles(audioFile, data, mnemonicFile, testMnemonic, scheme); !errors.Is(err, utils.ErrMnemonicMismatch) {
+		t.Errorf("verifySavedFiles of a replaced mnemonic = %v, want ErrMnemonicMismatch", err)
+	}
+
+	// A corrupted word is caught by the validation.
+	if err := utils.SaveMnemonicToFile(mnemonicFile, testMnemonic[:len(testMnemonic)-1]+"x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifySavedFiles(audioFile, data, mnemonicFile, testMnemonic, scheme); err == nil {
+		t.Error("verifySavedFiles of a corrupted mnemonic succeeded")
+	}
+
+	// A corrupted audio file is caught before the mnemonic is read.
+	if err := utils.SaveMnemonicToFile(mnemonicFile, testMnemonic); err != nil {
+		t.Fatal(err)
+	}
+	contents, err := os.ReadFile(audioFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents[len(contents)-1] ^= 0xff
+	if err := os.WriteFile(audioFile, contents, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifySavedFiles(audioFile, data, mnemonicFile, testMnemonic, scheme); !errors.Is(err, utils.ErrAudioDataMismatch) {
+		t.Errorf("verifySavedFiles of a corrupted audio file = %v, want ErrAudioDataMismatch", err)
+	}
+}
+
+func TestCSVSink(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "mnemonic.csv")
+	cfg := newTestConfig(t, "-stdout=false", "-mnemonic-out", "", "-csv-out", filename)
+	mnemonic := "legal winner thank year wave sausage worth useful legal winner thank yellow"
+	if err := writeSinks(cfg.sinks(0, [32]byte{}), mnemonic); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	words := strings.Fields(mnemonic)
+	if len(rows) != 1+len(words) {
+		t.Fatalf("CSV has %d rows, want a header and %d words", len(rows), len(words))
+	}
+	for i, row := range rows[1:] {
+		index, ok := bip39.GetWordIndex(words[i])
+		if !ok {
+			t.Fatalf("%q is not in the wordlist", words[i])
+		}
+		want := []string{strconv.Itoa(i + 1), words[i], strconv.Itoa(index)}
+		if !reflect.DeepEqual(row, want) {
+			t.Errorf("CSV row %d = %q, want %q", i+1, row, want)
+		}
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("CSV file permissions = %v, want 0600", perm)
+	}
+}
+
+func TestThreeSinks(t *testing.T) {
+	dir := t.TempDir()
+	mnemonicFile := filepath.Join(dir, "mnemonic.txt")
+	jsonFile := filepath.Join(dir, "mnemonic.json")
+	qrFile := filepath.Join(dir, "mnemonic.png")
+	cfg := newTestConfig(t, "-stdout=false", "-mnemonic-out", mnemonicFile, "-json-out", jsonFile, "-qr-out", qrFile)
+	sinks := cfg.sinks(0, [32]byte{})
+	if len(sinks) != 3 {
+		t.Fatalf("%d sinks enabled, want 3", len(sinks))
+	}
+	if err := writeSinks(sinks, testMnemonic); err != nil {
+		t.Fatal(err)
+	}
+
+	// All three outputs are private files.
+	for _, name := range []string{mnemonicFile, jsonFile, qrFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Errorf("output %s: %v", name, err)
+			continue
+		}
+		if perm := info.Mode().Perm(); perm != 0600 {
+			t.Errorf("%s permissions = %v, want 0600", name, perm)
+		}
+	}
+
+	if mnemonic, err := utils.LoadMnemonicFromFile(mnemonicFile); err != nil || mnemonic != testMnemonic {
+		t.Errorf("saved mnemonic = %q (%v), want %q", mnemonic, err, testMnemonic)
+	}
+	var document utils.MnemonicJSON
+	if contents, err := os.ReadFile(jsonFile); err != nil {
+		t.Error(err)
+	} else if err := json.Unmarshal(contents, &document); err != nil || document.Mnemonic != testMnemonic {
+		t.Errorf("JSON mnemonic = %q (%v), want %q", document.Mnemonic, err, testMnemonic)
+	}
+	if file, err := os.Open(qrFile); err != nil {
+		t.Error(err)
+	} else {
+		defer file.Close()
+		if _, err := png.Decode(file); err != nil {
+			t.Errorf("QR code PNG: %v", err)
+		}
+	}
+}
+
+// captureStdout returns what f prints to the standard output.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan string)
+	go func() {
+		contents, _ := io.ReadAll(r)
+		output <- string(contents)
+	}()
+	f()
+	w.Close()
+	return <-output
+}
+
+func TestEntropyOut(t *testing.T) {
+	mnemonics := []string{
+		testMnemonic,
+		"legal winner thank year wave sausage worth useful legal winner thank yellow",
+		"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo vote",
+	}
+	cfg := newTestConfig(t, "-entropy-out")
+	for _, mnemonic := range mnemonics {
+		var err error
+		output := captureStdout(t, func() { err = cfg.printMnemonic(mnemonic, 0) })
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The printed hex is the entropy other tools turn into the same mnemonic.
+		var hexEntropy string
+		for _, line := range strings.Split(output, "\n") {
+			if strings.HasPrefix(line, "Entropy: ") {
+				hexEntropy = strings.TrimPrefix(line, "Entropy: ")
+			}
+		}
+		entropy, err := hex.DecodeString(hexEntropy)
+		if err != nil {
+			t.Fatalf("printed entropy %q: %v\n%s", hexEntropy, err, output)
+		}
+		if got, err := bip39.NewMnemonic(entropy); err != nil || got != mnemonic {
+			t.Errorf("mnemonic of the printed entropy %s = %q (%v), want %q", hexEntropy, got, err, mnemonic)
+		}
+	}
+}
+
+func TestShowChecksum(t *testing.T) {
+	var err error
+	output := captureStdout(t, func() { err = newTestConfig(t, "-show-checksum").printMnemonic(testMnemonic, 0) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Checksum: expected 0011, embedded 0011\n"; !strings.Contains(output, want) {
+		t.Errorf("-show-checksum printed %q, want %q", output, want)
+	}
+}
+
+func TestOnePerLine(t *testing.T) {
+	if lines := strings.Split(formatWords(testMnemonic, "\n"), "\n"); len(lines) != 12 {
+		t.Errorf("formatWords of a 12-word phrase gave %d lines, want 12", len(lines))
+	}
+
+	var err error
+	output := captureStdout(t, func() { err = newTestConfig(t, "-one-per-line").printMnemonic(testMnemonic, 0) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, words, found := strings.Cut(output, "Mnemonic:\n")
+	if !found {
+		t.Fatalf("output without a mnemonic header:\n%s", output)
+	}
+	lines := strings.Split(strings.TrimSuffix(words, "\n"), "\n")
+	if len(lines) != 12 {
+		t.Fatalf("-one-per-line printed %d lines, want 12:\n%s", len(lines), words)
+	}
+	for i, word := range strings.Fields(testMnemonic) {
+		if lines[i] != word {
+			t.Errorf("line %d = %q, want %q", i+1, lines[i], word)
+		}
+	}
+}
+
+func TestSeedFileSink(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "wallet.seed")
+	cfg := newTestConfig(t, "-stdout=false", "-mnemonic-out", "", "-export-seed-file", filename)
+	if err := writeSinks(cfg.sinks(0, [32]byte{}), testMnemonic); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed, err := crypto.DecodeSeedFile(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := crypto.DeriveSeed(testMnemonic, ""); !bytes.Equal(seed, want) {
+		t.Errorf("seed file holds %x, want the seed %x", seed, want)
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("seed file permissions = %v, want 0600", perm)
+	}
+}
+
+func TestSymlinkedOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on Windows")
+	}
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(dir, "elsewhere")
+	if err := os.Mkdir(target, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, filepath.Join(dir, "out")); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "out", "mnemonic.txt")
+
+	cfg := newTestConfig(t, "-stdout=false", "-mnemonic-out", filename)
+	if err := writeSinks(cfg.sinks(0, [32]byte{}), testMnemonic); !errors.Is(err, utils.ErrSymlink) {
+		t.Fatalf("writing through a symlinked directory = %v, want ErrSymlink", err)
+	}
+	if _, err := os.Stat(filepath.Join(target, "mnemonic.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the mnemonic was written through the symlink (%v)", err)
+	}
+
+	cfg = newTestConfig(t, "-stdout=false", "-mnemonic-out", filename, "-allow-symlink")
+	if err := writeSinks(cfg.sinks(0, [32]byte{}), testMnemonic); err != nil {
+		t.Fatalf("writing through a symlinked directory with -allow-symlink: %v", err)
+	}
+	if mnemonic, err := utils.LoadMnemonicFromFile(filepath.Join(target, "mnemonic.txt")); err != nil || mnemonic != testMnemonic {
+		t.Errorf("mnemonic written through the symlink = %q (%v), want %q", mnemonic, err, testMnemonic)
+	}
+}
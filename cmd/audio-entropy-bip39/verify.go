@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/crypto"
+)
+
+// runVerify reads a mnemonic from stdin, prints its verification word, and compares it with the expected one.
+func runVerify(args []string) error {
+	var expected string
+	var checksum bool
+	fs := newFlagSet("verify")
+	fs.StringVar(&expected, "word", "", "Verification word printed with the mnemonic by -verification-word")
+	fs.BoolVar(&checksum, "checksum", false, "Also print the BIP-39 checksum bits of the mnemonic, and fail if they do not match the last word")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// The mnemonic is read from stdin rather than the arguments, which end up in the shell history.
+	fmt.Fprintln(os.Stderr, "Enter the mnemonic:")
+	scanner := bufio.NewScanner(os.Stdin)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("error reading mnemonic: %w", err)
+		}
+		return errors.New("no mnemonic on stdin")
+	}
+	mnemonic := scanner.Text()
+
+	word, err := crypto.VerificationWord(mnemonic)
+	if err != nil {
+		return fmt.Errorf("error computing verification word: %w", err)
+	}
+	fmt.Printf("Verification word: %s\n", word)
+	if expected != "" && word != expected {
+		return fmt.Errorf("verification word %q does not match %q: a word is missing, misspelled or out of order", word, expected)
+	}
+	if checksum {
+		return printChecksum(mnemonic)
+	}
+	return nil
+}
+
+// printChecksum prints the BIP-39 checksum bits computed from the entropy of the mnemonic next to the ones
+// embedded in its last word, and returns an error if they differ.
+func printChecksum(mnemonic string) error {
+	expected, actual, err := crypto.MnemonicChecksum(mnemonic)
+	if err != nil {
+		return fmt.Errorf("error computing checksum: %w", err)
+	}
+	fmt.Printf("Checksum: expected %s, embedded %s\n", expected, actual)
+	if expected != actual {
+		return fmt.Errorf("checksum %s does not match the bits %s of the last word: a word is wrong", expected, actual)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/crypto"
+)
+
+func TestRunVerify(t *testing.T) {
+	word, err := crypto.VerificationWord(testMnemonic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withStdin(t, []byte(testMnemonic+"\n"))
+	output := captureStdout(t, func() { err = runVerify([]string{"-word", word}) })
+	if err != nil {
+		t.Errorf("runVerify with the matching word: %v", err)
+	}
+	if want := "Verification word: " + word + "\n"; output != want {
+		t.Errorf("runVerify printed %q, want %q", output, want)
+	}
+
+	// A transcription with a word missing is caught.
+	withStdin(t, []byte(strings.TrimSuffix(testMnemonic, " about")+"\n"))
+	captureStdout(t, func() { err = runVerify([]string{"-word", word}) })
+	if err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("runVerify of an incomplete copy = %v, want a mismatch", err)
+	}
+
+	// -checksum prints the expected and embedded checksum bits, and fails if they differ.
+	withStdin(t, []byte(testMnemonic+"\n"))
+	output = captureStdout(t, func() { err = runVerify([]string{"-checksum"}) })
+	if err != nil || !strings.Contains(output, "Checksum: expected 0011, embedded 0011\n") {
+		t.Errorf("runVerify -checksum printed %q (%v), want the matching checksum bits", output, err)
+	}
+	withStdin(t, []byte(strings.TrimSuffix(testMnemonic, "about")+"abandon\n"))
+	output = captureStdout(t, func() { err = runVerify([]string{"-checksum"}) })
+	if err == nil || !strings.Contains(output, "Checksum: expected 0011, embedded 0000\n") {
+		t.Errorf("runVerify -checksum of a corrupted mnemonic printed %q (%v), want the mismatching checksum bits", output, err)
+	}
+
+	withStdin(t, nil)
+	if err := runVerify(nil); err == nil {
+		t.Error("runVerify without a mnemonic succeeded")
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	runtimedebug "runtime/debug"
+
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/audio"
+)
+
+// Build metadata, injected at build time with -ldflags "-X main.version=... -X main.commit=... -X main.buildDate=...".
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+// reportedModules are the dependencies whose versions are reported by -version.
+var reportedModules = []string{
+	"github.com/gordonklaus/portaudio",
+	"github.com/tyler-smith/go-bip39",
+	"golang.org/x/crypto",
+}
+
+// BuildInfo describes the build of the tool and the versions of the dependencies it was built against.
+type BuildInfo struct {
+	Version      string
+	Commit       string
+	BuildDate    string
+	GoVersion    string
+	Dependencies map[string]string // Module path to version, for the reported modules
+}
+
+// readBuildInfo returns the build information, with dependency versions from the embedded module information.
+func readBuildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:      version,
+		Commit:       commit,
+		BuildDate:    buildDate,
+		Dependencies: make(map[string]string),
+	}
+
+	buildInfo, ok := runtimedebug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.GoVersion = buildInfo.GoVersion
+	for _, dep := range buildInfo.Deps {
+		// Report the replacement, if any, as that is what was actually built.
+		depVersion := dep.Version
+		if dep.Replace != nil {
+			depVersion = dep.Replace.Path
+			if dep.Replace.Version != "" {
+				depVersion = dep.Replace.Version
+			}
+		}
+		info.Dependencies[dep.Path] = depVersion
+	}
+
+	return info
+}
+
+// printVersion prints the build information.
+func printVersion() {
+	info := readBuildInfo()
+	fmt.Printf("Version: %s\n", info.Version)
+	fmt.Printf("Commit: %s\n", info.Commit)
+	fmt.Printf("Build date: %s\n", info.BuildDate)
+	if info.GoVersion != "" {
+		fmt.Printf("Go: %s\n", info.GoVersion)
+	}
+	for _, path := range reportedModules {
+		if v, ok := info.Dependencies[path]; ok {
+			fmt.Printf("%s: %s\n", path, v)
+		}
+	}
+	fmt.Printf("PortAudio library: %s\n", audio.PortAudioVersion())
+}
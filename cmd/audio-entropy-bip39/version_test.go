@@ -0,0 +1,24 @@
+package main
+
+import (
+	runtimedebug "runtime/debug"
+	"testing"
+)
+
+func TestReadBuildInfo(t *testing.T) {
+	info := readBuildInfo()
+	if info.Version != version || info.Commit != commit || info.BuildDate != buildDate {
+		t.Errorf("readBuildInfo = %+v, want the injected version %s, commit %s and build date %s", info, version, commit, buildDate)
+	}
+	if _, ok := runtimedebug.ReadBuildInfo(); !ok {
+		t.Skip("no build information in the test binary")
+	}
+	if info.GoVersion == "" {
+		t.Error("readBuildInfo reports no Go version")
+	}
+	for _, path := range []string{"github.com/tyler-smith/go-bip39", "golang.org/x/crypto"} {
+		if info.Dependencies[path] == "" {
+			t.Errorf("readBuildInfo reports no version of %s", path)
+		}
+	}
+}
@@ -7,3 +7,12 @@ require (
 	github.com/tyler-smith/go-bip39 v1.1.0
 	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
 )
+
+require (
+	github.com/btcsuite/btcd/btcec/v2 v2.3.4
+	github.com/btcsuite/btcd/btcutil v1.1.6
+	github.com/gen2brain/malgo v0.11.24
+	golang.org/x/sys v0.15.0
+)
+
+require github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1 // indirect
@@ -3,10 +3,11 @@
 package audio
 
 import (
+	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"github.com/gianlucamazza/audio-entropy-bip39/internal/utils"
-	"github.com/gordonklaus/portaudio"
 	"log"
 	"math"
 	"strings"
@@ -21,100 +22,250 @@ const (
 )
 
 // AudioStream is an interface that represents an audio stream.
+// Buffer returns the samples filled by the last call to Read; implementations other than
+// ConcreteAudioStream (e.g. test doubles) can use it to inject data or fail reads on demand.
 type AudioStream interface {
 	Read() error
 	Start() error
 	Stop() error
 	Close() error
+	Buffer() []float32
 }
 
-// ConcreteAudioStream is a concrete implementation of the AudioStream interface.
-type ConcreteAudioStream struct {
-	stream *portaudio.Stream
-	buffer []float32
+// Native sample formats a stream can capture in.
+const (
+	CaptureFloat32 = "float32"
+	CaptureInt16   = "int16"
+)
+
+// ErrUnsupportedCaptureFormat indicates a capture format other than CaptureFloat32 and CaptureInt16.
+var ErrUnsupportedCaptureFormat = errors.New("unsupported capture format")
+
+// ValidateCaptureFormat checks that the capture format is supported.
+func ValidateCaptureFormat(format string) error {
+	if format != CaptureFloat32 && format != CaptureInt16 {
+		return fmt.Errorf("%w %q: must be %q or %q", ErrUnsupportedCaptureFormat, format, CaptureFloat32, CaptureInt16)
+	}
+	return nil
 }
 
-// NewConcreteAudioStream creates a new ConcreteAudioStream.
-func NewConcreteAudioStream(bufferSize int) (*ConcreteAudioStream, func(), error) {
-	// Initialize PortAudio once during the program lifecycle.
-	err := portaudio.Initialize()
-	if err != nil {
-		return nil, nil, fmt.Errorf("error initializing PortAudio: %w", err)
+// Latency presets of a stream, from the default low and high input latencies the device reports.
+const (
+	LatencyLow    = "low"    // The default low latency, for fast machines: smaller host buffers, less delay
+	LatencyNormal = "normal" // Halfway between the default low and high latencies
+	LatencyHigh   = "high"   // The default high latency, for slow or busy machines: the most robust against overflows
+)
+
+// ErrUnknownLatency indicates a latency preset other than LatencyLow, LatencyNormal and LatencyHigh.
+var ErrUnknownLatency = errors.New("unknown latency preset")
+
+// ValidateLatency checks that the latency preset is supported.
+func ValidateLatency(preset string) error {
+	_, err := ResolveLatency(preset, 0, 0)
+	return err
+}
+
+// ResolveLatency returns the suggested latency of a preset, given the default low and high input latencies
+// of the device.
+func ResolveLatency(preset string, low, high time.Duration) (time.Duration, error) {
+	switch preset {
+	case LatencyLow:
+		return low, nil
+	case LatencyNormal:
+		return low + (high-low)/2, nil
+	case LatencyHigh:
+		return high, nil
 	}
+	return 0, fmt.Errorf("%w %q: must be %q, %q or %q", ErrUnknownLatency, preset, LatencyLow, LatencyNormal, LatencyHigh)
+}
+
+// Check at compile time that the built-in streams implement AudioStream and DeviceIdentifier.
+var (
+	_ AudioStream      = (*ConcreteAudioStream)(nil)
+	_ DeviceIdentifier = (*ConcreteAudioStream)(nil)
+	_ AudioStream      = (*MalgoAudioStream)(nil)
+	_ DeviceIdentifier = (*MalgoAudioStream)(nil)
+)
+
+// DeviceIdentifier is implemented by streams whose backend can report the identity of the input device they
+// capture from, so that a device switch during a recording can be detected (see RecordOptions).
+type DeviceIdentifier interface {
+	DeviceID() (string, error)
+}
 
-	// Buffer for incoming audio.
-	input := make([]float32, bufferSize)
+// ErrDeviceChanged indicates that the input device changed during the recording, e.g. when headphones
+// were unplugged, so that the audio is a splice of two microphones.
+var ErrDeviceChanged = errors.New("input device changed")
 
-	// Updated stream creation to accommodate input processing.
-	stream, err := portaudio.OpenDefaultStream(1, 0, sampleRate, bufferSize, &input)
-	if err != nil {
-		portaudio.Terminate() // It's important to terminate after a failed initialization.
-		return nil, nil, fmt.Errorf("error opening default stream: %w", err)
+// ErrUnsupportedChannels indicates that the input device cannot record the requested number of channels.
+var ErrUnsupportedChannels = errors.New("unsupported channel count")
+
+// Recording backends of NewInputStream.
+const (
+	BackendPortAudio = "portaudio" // PortAudio, the default
+	BackendMalgo     = "malgo"     // miniaudio through malgo, for systems without the PortAudio library
+)
+
+// ErrUnknownBackend indicates a recording backend other than BackendPortAudio and BackendMalgo.
+var ErrUnknownBackend = errors.New("unknown audio backend")
+
+// ValidateBackend checks that the recording backend is supported.
+func ValidateBackend(backend string) error {
+	if _, ok := inputBackends[backend]; !ok {
+		return fmt.Errorf("%w %q: must be %q or %q", ErrUnknownBackend, backend, BackendPortAudio, BackendMalgo)
 	}
+	return nil
+}
 
-	// Create a cleanup function.
-	cleanup := func() {
-		err := stream.Close()
+// inputBackends maps the recording backends to the constructors of their input streams.
+var inputBackends = map[string]func(bufferSize, channels int, format, latency string) (AudioStream, func(), error){
+	BackendPortAudio: func(bufferSize, channels int, format, latency string) (AudioStream, func(), error) {
+		stream, cleanup, err := NewConcreteAudioStreamWithLatency(bufferSize, channels, format, latency)
 		if err != nil {
-			log.Printf("Error closing the stream: %v", err)
+			return nil, nil, err
 		}
-		err = portaudio.Terminate()
+		return stream, cleanup, nil
+	},
+	BackendMalgo: func(bufferSize, channels int, format, latency string) (AudioStream, func(), error) {
+		stream, cleanup, err := NewMalgoAudioStream(bufferSize, channels, format, latency)
 		if err != nil {
-			log.Printf("Error terminating PortAudio: %v", err)
+			return nil, nil, err
 		}
-	}
+		return stream, cleanup, nil
+	},
+}
 
-	return &ConcreteAudioStream{stream: stream, buffer: input}, cleanup, nil
+// NewInputStream creates an input stream of the given backend recording the given number of channels in the
+// given native capture format, with the suggested latency of the given preset.
+func NewInputStream(backend string, bufferSize, channels int, format, latency string) (AudioStream, func(), error) {
+	if err := ValidateBackend(backend); err != nil {
+		return nil, nil, err
+	}
+	return inputBackends[backend](bufferSize, channels, format, latency)
 }
 
-// Read from the audio stream into the buffer.
-// Read fills the buffer with audio data.
-func (cas *ConcreteAudioStream) Read() error {
-	err := cas.stream.Read()
-	if err != nil {
-		if err != portaudio.InputOverflowed {
-			return fmt.Errorf("error reading from audio stream: %w", err)
+// streamControlTimeout bounds how long Start and Stop wait for the PortAudio device.
+var streamControlTimeout = 5 * time.Second
+
+var (
+	// ErrAudioUnavailable indicates that the binary was built without audio support (the noaudio build tag).
+	ErrAudioUnavailable = errors.New("audio support is not available in this build")
+	// ErrNoInputDevice indicates that there is no default audio input device to record from.
+	ErrNoInputDevice = errors.New("no audio input device")
+	// ErrAudioStartTimeout indicates that the audio device did not start in time.
+	ErrAudioStartTimeout = errors.New("timed out starting audio stream")
+	// ErrAudioStopTimeout indicates that the audio device did not stop in time.
+	ErrAudioStopTimeout = errors.New("timed out stopping audio stream")
+	// ErrAudioReadTimeout indicates that the audio device delivered no audio in time.
+	ErrAudioReadTimeout = errors.New("timed out reading audio stream")
+)
+
+// callWithTimeout runs fn and returns its error wrapped with context, or timeoutErr if fn does not return
+// within timeout. A hung call is left running in the background, since PortAudio calls cannot be interrupted.
+func callWithTimeout(fn func() error, timeout time.Duration, timeoutErr error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Buffered so the goroutine can finish even after a timeout.
+	result := make(chan error, 1)
+	go func() {
+		result <- fn()
+	}()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			return fmt.Errorf("PortAudio error: %w", err)
 		}
-		log.Printf("Input overflow occurred: %v", err)
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%w after %v", timeoutErr, timeout)
 	}
-	return nil
 }
 
-// Close the audio stream.
-func (cas *ConcreteAudioStream) Close() error {
-	if cas.stream != nil {
-		err := cas.stream.Close()
+// OutputStream is an interface that represents an audio output stream.
+// Write plays the samples currently held in Buffer.
+type OutputStream interface {
+	Write() error
+	Start() error
+	Stop() error
+	Close() error
+	Buffer() []float32
+}
+
+// PlayAudio plays the samples on the output stream and returns the number of frames written.
+// The last buffer is padded with silence.
+func PlayAudio(stream OutputStream, samples []float32) (int, error) {
+	if err := stream.Start(); err != nil {
+		return 0, fmt.Errorf("error starting output stream: %w", err)
+	}
+	defer func() {
+		err := stream.Stop()
 		if err != nil {
-			return fmt.Errorf("failed to close audio stream: %w", err)
+			log.Printf("Error stopping output stream: %v", err)
 		}
+	}()
+
+	buffer := stream.Buffer()
+	if len(buffer) == 0 {
+		return 0, ErrInvalidBuffer
 	}
-	return nil
-}
 
-// Start starts the audio stream.
-func (cas *ConcreteAudioStream) Start() error {
-	return cas.stream.Start()
+	frames := 0
+	for offset := 0; offset < len(samples); offset += len(buffer) {
+		n := copy(buffer, samples[offset:])
+		for i := n; i < len(buffer); i++ {
+			buffer[i] = 0
+		}
+		if err := stream.Write(); err != nil {
+			return frames, err
+		}
+		frames += len(buffer)
+	}
+
+	return frames, nil
 }
 
-// Stop stops the audio stream.
-func (cas *ConcreteAudioStream) Stop() error {
-	return cas.stream.Stop()
+// DeviceInfo describes an audio input device.
+type DeviceInfo struct {
+	Index             int // Index of the device among all the PortAudio devices
+	Name              string
+	HostAPI           string
+	MaxInputChannels  int
+	DefaultSampleRate float64
+	Default           bool
 }
 
 // VolumeBar represents a volume bar.
 type VolumeBar struct {
 	BarCount int
+	// Ceiling is the volume that fills the bar, so that quiet microphones can fill it too.
+	// Zero means 1, the largest RMS.
+	Ceiling float32
+	// Color draws the bar in green, yellow, or red as it fills up, with ANSI escape codes.
+	Color bool
 }
 
+// ANSI escape codes of the colored volume bar.
+const (
+	ansiGreen  = "\033[32m"
+	ansiYellow = "\033[33m"
+	ansiRed    = "\033[31m"
+	ansiReset  = "\033[0m"
+)
+
 // NewVolumeBar creates a new VolumeBar.
 func NewVolumeBar() *VolumeBar {
 	return &VolumeBar{BarCount: maxBarCount}
 }
 
-// Update updates the volume bar.
+// Update updates the volume bar, mapping volumes from 0 to the ceiling onto the whole bar.
 func (vb *VolumeBar) Update(volume float32) {
-	const maxVolume = 1.0
-	volume = volume / maxVolume
+	ceiling := vb.Ceiling
+	if ceiling <= 0 {
+		ceiling = 1
+	}
+	volume = volume / ceiling
 
 	vb.BarCount = int(volume * float32(maxBarCount))
 
@@ -125,18 +276,548 @@ func (vb *VolumeBar) Update(volume float32) {
 	}
 }
 
-// Draw draws the volume bar.
+// Draw draws the volume bar, colored by how full it is if Color is set.
 func (vb *VolumeBar) Draw() string {
 	bar := strings.Repeat("#", vb.BarCount)
+	if vb.Color && vb.BarCount > 0 {
+		color := ansiGreen
+		switch {
+		case vb.BarCount >= maxBarCount*9/10:
+			color = ansiRed
+		case vb.BarCount >= maxBarCount*6/10:
+			color = ansiYellow
+		}
+		bar = color + bar + ansiReset
+	}
 	return fmt.Sprintf("[%s%s]", bar, strings.Repeat(" ", maxBarCount-vb.BarCount))
 }
 
+// SlidingRMS smooths the RMS of consecutive buffers with an exponential moving average, so that a meter
+// moves gradually instead of jumping with every buffer.
+type SlidingRMS struct {
+	smoothing float64
+	level     float64
+}
+
+// NewSlidingRMS creates a SlidingRMS starting at 0. The smoothing factor, from 0 (no smoothing) to below 1,
+// is the weight of the previous level in each update.
+func NewSlidingRMS(smoothing float64) *SlidingRMS {
+	return &SlidingRMS{smoothing: smoothing}
+}
+
+// Update adds the RMS of a buffer and returns the smoothed level.
+func (s *SlidingRMS) Update(rms float32) float32 {
+	s.level = s.smoothing*s.level + (1-s.smoothing)*float64(rms)
+	return float32(s.level)
+}
+
+// MultiChannelVolume returns the RMS of each channel of interleaved samples.
+// A trailing partial frame is ignored.
+func MultiChannelVolume(interleaved []float32, channels int) []float32 {
+	if channels < 1 {
+		return nil
+	}
+
+	sumSquares := make([]float64, channels)
+	frames := len(interleaved) / channels
+	for i := 0; i < frames*channels; i++ {
+		sample := float64(interleaved[i])
+		sumSquares[i%channels] += sample * sample
+	}
+
+	volumes := make([]float32, channels)
+	if frames == 0 {
+		return volumes
+	}
+	for c := range volumes {
+		volumes[c] = float32(math.Sqrt(sumSquares[c] / float64(frames)))
+	}
+	return volumes
+}
+
+// channelLabel returns the label of a channel: L and R for stereo, the 1-based channel number otherwise.
+func channelLabel(channel, channels int) string {
+	if channels == 2 {
+		return [2]string{"L", "R"}[channel]
+	}
+	return fmt.Sprintf("%d", channel+1)
+}
+
+// DrawChannelBars draws one labeled volume bar per channel, one per line, filled at the given ceiling
+// and colored if requested.
+func DrawChannelBars(volumes []float32, ceiling float32, color bool) string {
+	lines := make([]string, len(volumes))
+	for c, volume := range volumes {
+		volumeBar := NewVolumeBar()
+		volumeBar.Ceiling = ceiling
+		volumeBar.Color = color
+		volumeBar.Update(volume)
+		lines[c] = fmt.Sprintf("%s %s", channelLabel(c, len(volumes)), volumeBar.Draw())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// repaintThrottle limits how often the volume display is repainted, independently of the read rate.
+type repaintThrottle struct {
+	interval  time.Duration
+	lastPaint time.Time
+}
+
+// ready reports whether a repaint is due at now, and if so records it as the last repaint.
+// A zero interval never suppresses a repaint.
+func (t *repaintThrottle) ready(now time.Time) bool {
+	if !t.lastPaint.IsZero() && now.Sub(t.lastPaint) < t.interval {
+		return false
+	}
+	t.lastPaint = now
+	return true
+}
+
+// ApplyGain returns a copy of samples multiplied by gain and clamped to [-1, 1] to avoid clipping.
+func ApplyGain(samples []float32, gain float32) []float32 {
+	amplified := make([]float32, len(samples))
+	for i, sample := range samples {
+		sample *= gain
+		if sample > 1 {
+			sample = 1
+		} else if sample < -1 {
+			sample = -1
+		}
+		amplified[i] = sample
+	}
+	return amplified
+}
+
+// SanitizeSamples returns a copy of samples with NaN and infinite values replaced by silence,
+// along with the number of samples that were replaced.
+func SanitizeSamples(samples []float32) (clean []float32, dropped int) {
+	clean = make([]float32, len(samples))
+	for i, sample := range samples {
+		if math.IsNaN(float64(sample)) || math.IsInf(float64(sample), 0) {
+			dropped++
+			continue
+		}
+		clean[i] = sample
+	}
+	return clean, dropped
+}
+
+// SwapChannels returns a copy of interleaved stereo samples with the left and right channels exchanged.
+// A trailing partial frame is kept as is.
+func SwapChannels(interleaved []float32) []float32 {
+	swapped := make([]float32, len(interleaved))
+	copy(swapped, interleaved)
+	for i := 0; i+1 < len(swapped); i += 2 {
+		swapped[i], swapped[i+1] = swapped[i+1], swapped[i]
+	}
+	return swapped
+}
+
+// DownmixToMono averages the channels of interleaved samples into a single channel.
+// A trailing partial frame is ignored.
+func DownmixToMono(interleaved []float32, channels int) []float32 {
+	if channels <= 1 {
+		return interleaved
+	}
+
+	mono := make([]float32, len(interleaved)/channels)
+	for i := range mono {
+		var sum float32
+		for _, sample := range interleaved[i*channels : (i+1)*channels] {
+			sum += sample
+		}
+		mono[i] = sum / float32(channels)
+	}
+	return mono
+}
+
+// Decimate keeps every factor-th frame of interleaved samples with the given channel count.
+// It removes the correlation between adjacent samples of oversampled audio; it does not add entropy.
+func Decimate(samples []float32, channels, factor int) []float32 {
+	if factor <= 1 || channels < 1 {
+		return samples
+	}
+
+	step := channels * factor
+	decimated := make([]float32, 0, (len(samples)/step+1)*channels)
+	for frame := 0; frame+channels <= len(samples); frame += step {
+		decimated = append(decimated, samples[frame:frame+channels]...)
+	}
+	return decimated
+}
+
+// RecordOptions configures RecordAudioWithOptions.
+type RecordOptions struct {
+	// Gain is applied to the samples before measuring the volume. Zero means unity gain.
+	Gain float32
+	// Channels is the number of interleaved channels of the stream. Zero means mono.
+	Channels int
+	// Warmup is the number of buffers read and discarded after starting the stream, to drop
+	// driver startup transients and silence.
+	Warmup int
+	// Refresh is the minimum interval between two repaints of the volume display.
+	// Zero repaints after every buffer.
+	Refresh time.Duration
+	// Duration is the length of the recording. Zero means the default of 15 seconds.
+	Duration time.Duration
+	// Stop requests an early end of the recording, e.g. on Ctrl-C. Nil disables early stops.
+	Stop <-chan struct{}
+	// MinDuration is the length of audio to capture before early stop requests are honored.
+	MinDuration time.Duration
+	// OverflowPolicy is what to do with a buffer read with ErrInputOverflowed. Empty means OverflowKeep.
+	OverflowPolicy string
+	// BarCeiling is the volume that fills the volume bar. Zero means 1, the largest RMS.
+	BarCeiling float32
+	// MaxOverflowRatio is the largest fraction of reads that may overflow before the recording is
+	// rejected with ErrTooManyOverflows. Zero disables the check.
+	MaxOverflowRatio float64
+	// LoopSleep is a pause before each read, which keeps backends whose reads do not block from spinning
+	// a CPU core. PortAudio reads block until a buffer is ready, so zero, no pause, suits it.
+	LoopSleep time.Duration
+	// Smoothing is the smoothing factor of the volume display, from 0 (none) to below 1; see SlidingRMS.
+	Smoothing float64
+	// Prompt is the instruction shown when the recording starts, a preset name or custom text; see PromptText.
+	// Empty means PromptSpeak.
+	Prompt string
+	// Color draws the volume bar in color; see VolumeBar.
+	Color bool
+	// StopOnSilence is the length of trailing silence, after the first sound, that ends the recording
+	// before Duration, once MinDuration is captured. Zero disables it.
+	StopOnSilence time.Duration
+	// DeviceCheckInterval is the interval between checks of the input device of streams implementing
+	// DeviceIdentifier. A change aborts the recording with ErrDeviceChanged. Zero disables the checks.
+	DeviceCheckInterval time.Duration
+	// MaxRepeatedBuffers is the largest number of consecutive byte-identical buffers before the device is
+	// considered frozen and the recording is rejected with ErrStuckDevice. Zero disables the check.
+	MaxRepeatedBuffers int
+	// SilenceThreshold is the RMS of the captured samples, before gain, below which a buffer is silent.
+	// Zero means DefaultSilenceThreshold.
+	SilenceThreshold float32
+	// OnBuffer is called from the recording routine with each buffer that is kept, after sanitizing, e.g. to
+	// stream it to a monitor (see UDPSink). It must return quickly and must not modify the buffer. Nil disables it.
+	OnBuffer func(buffer []float32)
+}
+
+// DefaultSilenceThreshold is the default RMS below which RecordOptions.StopOnSilence considers a buffer silent.
+const DefaultSilenceThreshold = 0.01
+
+// silenceDetector detects a trailing silence of window frames, counted from the first buffer above the threshold.
+type silenceDetector struct {
+	threshold float32
+	window    int
+	channels  int
+	heard     bool
+	silent    int
+}
+
+// update adds a buffer to the detector and reports whether the trailing silence reached the window.
+func (d *silenceDetector) update(buffer []float32) bool {
+	volume, err := CalculateVolume(buffer)
+	if err != nil {
+		return false
+	}
+	if volume >= d.threshold {
+		d.heard, d.silent = true, 0
+		return false
+	}
+	if d.heard {
+		d.silent += len(buffer) / d.channels
+	}
+	return d.heard && d.silent >= d.window
+}
+
+// Preset instructions of RecordOptions.Prompt.
+const (
+	PromptSpeak   = "speak"
+	PromptAmbient = "ambient"
+	PromptTap     = "tap"
+	PromptMusic   = "music"
+)
+
+// promptPresets maps the preset names to their instruction.
+var promptPresets = map[string]string{
+	PromptSpeak:   "Speak into the microphone...",
+	PromptAmbient: "Stay quiet and let the microphone pick up the ambient noise...",
+	PromptTap:     "Tap, snap your fingers, or rustle paper near the microphone...",
+	PromptMusic:   "Play music near the microphone...",
+}
+
+// PromptText returns the instruction of a preset, or the prompt itself if it is not a preset name.
+// Empty prompts give the instruction of PromptSpeak.
+func PromptText(prompt string) string {
+	if prompt == "" {
+		prompt = PromptSpeak
+	}
+	if text, ok := promptPresets[prompt]; ok {
+		return text
+	}
+	return prompt
+}
+
+// Policies for the buffers read with ErrInputOverflowed.
+const (
+	OverflowKeep    = "keep"    // Use the buffer anyway
+	OverflowDiscard = "discard" // Leave the buffer out of the recording
+	OverflowRetry   = "retry"   // Read again once, and leave the buffer out if it overflows again
+)
+
+// ErrInputOverflowed indicates that input data was lost before a read, so the buffer may hold
+// repeated or partial data. The buffer is still filled.
+var ErrInputOverflowed = errors.New("input overflowed")
+
+// ErrTooManyOverflows indicates that so many reads overflowed that the recording is unreliable,
+// usually because the device or the machine is overloaded.
+var ErrTooManyOverflows = errors.New("too many input overflows")
+
+// ErrStuckDevice indicates that the device kept returning the same buffer, as a frozen device does.
+// Such audio may look loud but contributes no new entropy.
+var ErrStuckDevice = errors.New("stuck audio device")
+
+// ErrNoAudioCaptured indicates that a recording or an input holds no samples, so its hash adds no entropy.
+var ErrNoAudioCaptured = errors.New("no audio captured")
+
+// ValidateOverflowPolicy checks that the overflow policy is supported.
+func ValidateOverflowPolicy(policy string) error {
+	switch policy {
+	case "", OverflowKeep, OverflowDiscard, OverflowRetry:
+		return nil
+	}
+	return fmt.Errorf("invalid overflow policy %q: must be %q, %q or %q", policy, OverflowKeep, OverflowDiscard, OverflowRetry)
+}
+
+// readWithOverflowPolicy reads a buffer from the stream and reports whether it should be kept under the policy,
+// and whether the read overflowed, even if a retry succeeded.
+func readWithOverflowPolicy(stream AudioStream, policy string) (keep, overflowed bool, err error) {
+	err = stream.Read()
+	overflowed = errors.Is(err, ErrInputOverflowed)
+	if policy == OverflowRetry && overflowed {
+		err = stream.Read()
+	}
+	if !errors.Is(err, ErrInputOverflowed) {
+		return err == nil, overflowed, err
+	}
+
+	if policy == "" || policy == OverflowKeep {
+		log.Printf("Input overflow occurred: %v", err)
+		return true, overflowed, nil
+	}
+	return false, overflowed, nil
+}
+
+// Recording holds the result of an audio recording.
+type Recording struct {
+	// Samples are the raw interleaved samples as read from the stream, before any gain.
+	Samples []float32
+	// DroppedSamples is the number of NaN or infinite samples that were replaced by silence.
+	DroppedSamples int
+	// DiscardedBuffers is the number of overflowed buffers left out by the overflow policy.
+	DiscardedBuffers int
+	// Reads is the number of buffers read after the warmup, and Overflows the number of them that overflowed.
+	Reads, Overflows int
+	// Digest is the SHA-256 hash of the samples converted with utils.Float32ToByteSlice,
+	// updated frame by frame so that it always covers exactly the samples captured so far.
+	Digest [sha256.Size]byte
+}
+
+// ConcatRecordings joins recordings made one after the other into a single recording of all their samples,
+// with the sum of their counters and the digest of the joined samples.
+func ConcatRecordings(recordings []*Recording) *Recording {
+	joined := &Recording{}
+	for _, recording := range recordings {
+		joined.Samples = append(joined.Samples, recording.Samples...)
+		joined.DroppedSamples += recording.DroppedSamples
+		joined.DiscardedBuffers += recording.DiscardedBuffers
+		joined.Reads += recording.Reads
+		joined.Overflows += recording.Overflows
+	}
+	joined.Digest = sha256.Sum256(utils.Float32ToByteSlice(joined.Samples))
+	return joined
+}
+
 // RecordAudio performs audio recording and returns the recorded data.
 func RecordAudio(stream AudioStream, calculateVolumeFunc func(buffer []float32) (float32, error)) ([]byte, error) {
-	bufferSize := sampleRate * numSeconds
+	recording, err := RecordAudioWithOptions(stream, calculateVolumeFunc, RecordOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert the audio buffer to bytes.
+	return utils.Float32ToByteSlice(recording.Samples), nil
+}
+
+// levelMeter measures the volume of the buffers read from a stream and displays it.
+type levelMeter struct {
+	calculateVolume func(buffer []float32) (float32, error)
+	gain            float32
+	channels        int
+	ceiling         float32
+	color           bool
+	throttle        repaintThrottle
+	meter           *SlidingRMS
+	channelMeters   []*SlidingRMS
+}
+
+// newLevelMeter creates a levelMeter with the display options of opts.
+func newLevelMeter(calculateVolume func(buffer []float32) (float32, error), gain float32, channels int, opts RecordOptions) *levelMeter {
+	m := &levelMeter{
+		calculateVolume: calculateVolume,
+		gain:            gain,
+		channels:        channels,
+		ceiling:         opts.BarCeiling,
+		color:           opts.Color,
+		throttle:        repaintThrottle{interval: opts.Refresh},
+		meter:           NewSlidingRMS(opts.Smoothing),
+		channelMeters:   make([]*SlidingRMS, channels),
+	}
+	for c := range m.channelMeters {
+		m.channelMeters[c] = NewSlidingRMS(opts.Smoothing)
+	}
+	return m
+}
+
+// show measures the volume of a buffer, and repaints the volume display unless it was repainted too recently.
+func (m *levelMeter) show(buffer []float32) error {
+	// Calculate the volume.
+	amplified := ApplyGain(buffer, m.gain)
+	volume, err := m.calculateVolume(amplified)
+	if err != nil {
+		return fmt.Errorf("error calculating volume: %w", err)
+	}
+
+	// Smooth the volume of every buffer, including the ones that are not painted.
+	volume = m.meter.Update(volume)
+	var volumes []float32
+	if m.channels > 1 {
+		volumes = MultiChannelVolume(amplified, m.channels)
+		for c := range volumes {
+			volumes[c] = m.channelMeters[c].Update(volumes[c])
+		}
+	}
+	if !m.throttle.ready(time.Now()) {
+		return nil
+	}
+
+	// Draw one bar per channel, then move the cursor back up to the first one.
+	if m.channels > 1 {
+		fmt.Printf("\r%s\033[%dA", DrawChannelBars(volumes, m.ceiling, m.color), m.channels-1)
+		return nil
+	}
+
+	fmt.Printf("\rVolume: %f", volume)
+
+	// Update the volume bar.
+	volumeBar := NewVolumeBar()
+	volumeBar.Ceiling = m.ceiling
+	volumeBar.Color = m.color
+	volumeBar.Update(volume)
+
+	// Draw the volume bar.
+	fmt.Printf("\r%s", volumeBar.Draw())
+	return nil
+}
+
+// MonitorLevels displays the live volume of the stream until ctx is done, without keeping or hashing any audio,
+// so that the microphone can be positioned and its levels checked. Only the display options and Gain, Channels,
+// LoopSleep and OnBuffer of opts are used. Input overflows are ignored.
+func MonitorLevels(ctx context.Context, stream AudioStream, calculateVolumeFunc func(buffer []float32) (float32, error), opts RecordOptions) error {
+	gain := opts.Gain
+	if gain == 0 {
+		gain = 1
+	}
+	channels := opts.Channels
+	if channels == 0 {
+		channels = 1
+	}
+	meter := newLevelMeter(calculateVolumeFunc, gain, channels, opts)
+
+	if err := stream.Start(); err != nil {
+		return fmt.Errorf("error starting audio stream: %w", err)
+	}
+	defer func() {
+		if err := stream.Stop(); err != nil {
+			log.Printf("Error stopping audio stream: %v", err)
+		}
+	}()
+
+	fmt.Println("Monitoring input levels. Press Ctrl-C to stop...")
+	for {
+		select {
+		case <-ctx.Done():
+			// Move the cursor below the volume display.
+			fmt.Print(strings.Repeat("\n", channels))
+			return nil
+		default:
+			if opts.LoopSleep > 0 {
+				time.Sleep(opts.LoopSleep)
+			}
+			if err := stream.Read(); err != nil && !errors.Is(err, ErrInputOverflowed) {
+				return fmt.Errorf("error reading from audio stream: %w", err)
+			}
+			buffer, _ := SanitizeSamples(stream.Buffer())
+			if opts.OnBuffer != nil {
+				opts.OnBuffer(buffer)
+			}
+			if err := meter.show(buffer); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// RecordAudioWithOptions performs audio recording with the given options and returns the recorded samples.
+func RecordAudioWithOptions(stream AudioStream, calculateVolumeFunc func(buffer []float32) (float32, error), opts RecordOptions) (*Recording, error) {
+	gain := opts.Gain
+	if gain == 0 {
+		gain = 1
+	}
+
+	channels := opts.Channels
+	if channels == 0 {
+		channels = 1
+	}
+
+	duration := opts.Duration
+	if duration == 0 {
+		duration = time.Duration(numSeconds) * time.Second
+	}
+
+	bufferSize := int(duration.Seconds()*sampleRate) * channels
 	fullBuffer := make([]float32, 0, bufferSize)
+	droppedSamples := 0
+	overflowedBuffers := 0
+	reads, overflows := 0, 0
+	digest := sha256.New()
+	meter := newLevelMeter(calculateVolumeFunc, gain, channels, opts)
+
+	// Detect the trailing silence that ends the recording early if requested.
+	var silence *silenceDetector
+	if opts.StopOnSilence > 0 {
+		threshold := opts.SilenceThreshold
+		if threshold == 0 {
+			threshold = DefaultSilenceThreshold
+		}
+		silence = &silenceDetector{threshold: threshold, window: int(opts.StopOnSilence.Seconds() * sampleRate), channels: channels}
+	}
+	minFrames := int(opts.MinDuration.Seconds() * sampleRate)
+
+	// The hash of the previous buffer, and the number of buffers identical to it in a row, detect a frozen device.
+	var previousHash [sha256.Size]byte
+	repeatedBuffers := 0
+
+	// Identify the input device, to detect a switch during the recording, if requested and supported.
+	var device string
+	var deviceChecks <-chan time.Time
+	if identifier, ok := stream.(DeviceIdentifier); ok && opts.DeviceCheckInterval > 0 {
+		var err error
+		if device, err = identifier.DeviceID(); err != nil {
+			return nil, fmt.Errorf("error identifying input device: %w", err)
+		}
+		ticker := time.NewTicker(opts.DeviceCheckInterval)
+		defer ticker.Stop()
+		deviceChecks = ticker.C
+	}
 
-	fmt.Println("Recording. Speak into the microphone...")
+	fmt.Printf("Recording. %s\n", PromptText(opts.Prompt))
 
 	// Start the audio stream.
 	if err := stream.Start(); err != nil {
@@ -149,9 +830,18 @@ func RecordAudio(stream AudioStream, calculateVolumeFunc func(buffer []float32)
 		}
 	}()
 
+	// Discard the first buffers, which often hold startup transients.
+	for i := 0; i < opts.Warmup; i++ {
+		if err := stream.Read(); err != nil && !errors.Is(err, ErrInputOverflowed) {
+			return nil, fmt.Errorf("error reading from audio stream during warmup: %w", err)
+		}
+	}
+
 	var wg sync.WaitGroup
 	done := make(chan bool)
-	errChan := make(chan error)
+	// Buffered so the recording routine never blocks when reporting its error.
+	errChan := make(chan error, 1)
+	silenced := make(chan struct{})
 
 	// Recording routine.
 	wg.Add(1)
@@ -164,52 +854,132 @@ func RecordAudio(stream AudioStream, calculateVolumeFunc func(buffer []float32)
 			case <-done:
 				return
 			default:
-				// Read from the audio stream.
-				err := stream.Read()
+				if opts.LoopSleep > 0 {
+					time.Sleep(opts.LoopSleep)
+				}
+
+				// Read from the audio stream, applying the overflow policy.
+				keep, overflowed, err := readWithOverflowPolicy(stream, opts.OverflowPolicy)
 				if err != nil {
 					errChan <- fmt.Errorf("error reading from audio stream: %w", err)
 					return
 				}
+				reads++
+				if overflowed {
+					overflows++
+				}
+				if !keep {
+					overflowedBuffers++
+					continue
+				}
 
-				// Calculate the volume.
-				volume, err := calculateVolumeFunc(stream.(*ConcreteAudioStream).buffer)
-				if err != nil {
-					errChan <- fmt.Errorf("error calculating volume: %w", err)
-					return
+				// Replace the NaN or infinite samples some drivers emit on glitches.
+				// This also copies the samples, as the stream reuses its buffer.
+				buffer, dropped := SanitizeSamples(stream.Buffer())
+				droppedSamples += dropped
+
+				// Abort when the device keeps returning the same buffer.
+				bufferBytes := utils.Float32ToByteSlice(buffer)
+				if opts.MaxRepeatedBuffers > 0 {
+					hash := sha256.Sum256(bufferBytes)
+					if hash == previousHash {
+						repeatedBuffers++
+					} else {
+						previousHash, repeatedBuffers = hash, 0
+					}
+					if repeatedBuffers > opts.MaxRepeatedBuffers {
+						errChan <- fmt.Errorf("%w: the same buffer was read %d times in a row; the device may be frozen or muted", ErrStuckDevice, repeatedBuffers+1)
+						return
+					}
 				}
 
-				fmt.Printf("\rVolume: %f", volume)
+				fullBuffer = append(fullBuffer, buffer...)
+				digest.Write(bufferBytes)
+				if opts.OnBuffer != nil {
+					opts.OnBuffer(buffer)
+				}
 
-				// Update the volume bar.
-				volumeBar := NewVolumeBar()
-				volumeBar.Update(volume)
+				// Measure and display the volume.
+				if err := meter.show(buffer); err != nil {
+					errChan <- err
+					return
+				}
 
-				// Draw the volume bar.
-				fmt.Printf("\r%s", volumeBar.Draw())
+				// Stop at the end of the trailing silence, once the minimum duration is captured.
+				if silence != nil && silence.update(buffer) && len(fullBuffer)/channels >= minFrames {
+					close(silenced)
+					return
+				}
 			}
 		}
 	}()
 
-	// Wait for the recording to complete.
-	timer := time.NewTimer(time.Duration(numSeconds) * time.Second)
-	<-timer.C
+	// Wait for the recording to complete, or abort as soon as the recording routine fails.
+	// Early stop requests end the recording only once the minimum duration is captured.
+	started := time.Now()
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	var recordErr error
+wait:
+	for {
+		select {
+		case <-timer.C:
+			break wait
+		case recordErr = <-errChan:
+			break wait
+		case <-deviceChecks:
+			current, err := stream.(DeviceIdentifier).DeviceID()
+			if err != nil {
+				recordErr = fmt.Errorf("error identifying input device: %w", err)
+				break wait
+			}
+			if current != device {
+				recordErr = fmt.Errorf("%w from %q to %q; record again", ErrDeviceChanged, device, current)
+				break wait
+			}
+		case <-silenced:
+			fmt.Printf("\nStopped after %s of silence.\n", opts.StopOnSilence)
+			break wait
+		case <-opts.Stop:
+			remaining := opts.MinDuration - time.Since(started)
+			if remaining <= 0 {
+				break wait
+			}
+			fmt.Printf("\nKeep recording, %.0f more seconds needed.\n", math.Ceil(remaining.Seconds()))
+		}
+	}
 	close(done)
 	wg.Wait()
 
+	// Move the cursor below the per-channel bars.
+	if channels > 1 {
+		fmt.Print(strings.Repeat("\n", channels-1))
+	}
+
 	// Check for any errors that occurred during recording.
-	select {
-	case err := <-errChan:
-		return nil, err
-	default:
-		// No errors.
+	if recordErr != nil {
+		return nil, recordErr
+	}
+
+	// Reject a recording of which too much input was lost.
+	if opts.MaxOverflowRatio > 0 && reads > 0 {
+		if ratio := float64(overflows) / float64(reads); ratio > opts.MaxOverflowRatio {
+			return nil, fmt.Errorf("%w: %d of %d reads (%.0f%%), above the maximum of %.0f%%; try a larger buffer size or close other programs",
+				ErrTooManyOverflows, overflows, reads, ratio*100, opts.MaxOverflowRatio*100)
+		}
 	}
 
 	fmt.Println("\nRecording complete. Processing...")
 
-	// Convert the audio buffer to bytes.
-	audioData := utils.Float32ToByteSlice(fullBuffer)
+	if droppedSamples > 0 {
+		log.Printf("Replaced %d NaN or infinite samples with silence", droppedSamples)
+	}
+
+	recording := &Recording{Samples: fullBuffer, DroppedSamples: droppedSamples, DiscardedBuffers: overflowedBuffers, Reads: reads, Overflows: overflows}
+	copy(recording.Digest[:], digest.Sum(nil))
 
-	return audioData, nil
+	return recording, nil
 }
 
 // ErrInvalidBuffer indicates an operation on an invalid buffer.
@@ -221,16 +991,8 @@ func CalculateVolume(buffer []float32) (float32, error) {
 		return 0, ErrInvalidBuffer
 	}
 
-	var sumSquares float64
-	for _, sample := range buffer {
-		sumSquares += float64(sample) * float64(sample) // Squaring each sample.
-	}
-
-	// Calculate the mean of the squares.
-	meanSquare := sumSquares / float64(len(buffer))
-
 	// Calculate the root of the mean square, i.e., RMS.
-	rms := math.Sqrt(meanSquare)
+	rms := AnalyzeBuffer(buffer).RMS
 
 	// Normalizing the volume so that it fits in a 0-1 range for visualization.
 	// This approach avoids using dB and keeps the volume in a linear scale.
@@ -0,0 +1,982 @@
+// audio/audio_test.go
+
+package audio
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/utils"
+)
+
+func TestApplyGain(t *testing.T) {
+	samples := []float32{0, 0.1, -0.2, 0.5, -0.5}
+	amplified := ApplyGain(samples, 2)
+	want := []float32{0, 0.2, -0.4, 1, -1}
+	for i := range want {
+		if amplified[i] != want[i] {
+			t.Errorf("ApplyGain(%v, 2)[%d] = %v, want %v", samples[i], i, amplified[i], want[i])
+		}
+	}
+	if samples[1] != 0.1 {
+		t.Error("ApplyGain modified its input")
+	}
+}
+
+func TestValidateCaptureFormat(t *testing.T) {
+	for _, format := range []string{CaptureFloat32, CaptureInt16} {
+		if err := ValidateCaptureFormat(format); err != nil {
+			t.Errorf("ValidateCaptureFormat(%q) = %v", format, err)
+		}
+	}
+	for _, format := range []string{"", "int24", "FLOAT32"} {
+		if err := ValidateCaptureFormat(format); !errors.Is(err, ErrUnsupportedCaptureFormat) {
+			t.Errorf("ValidateCaptureFormat(%q) = %v, want ErrUnsupportedCaptureFormat", format, err)
+		}
+	}
+}
+
+func TestResolveLatency(t *testing.T) {
+	// The default low and high input latencies a typical ALSA device reports.
+	low, high := 8707*time.Microsecond, 34829*time.Microsecond
+	tests := []struct {
+		preset string
+		want   time.Duration
+	}{
+		{LatencyLow, low},
+		{LatencyNormal, 21768 * time.Microsecond},
+		{LatencyHigh, high},
+	}
+	for _, tt := range tests {
+		if got, err := ResolveLatency(tt.preset, low, high); err != nil || got != tt.want {
+			t.Errorf("ResolveLatency(%q) = %v, %v, want %v", tt.preset, got, err, tt.want)
+		}
+		if err := ValidateLatency(tt.preset); err != nil {
+			t.Errorf("ValidateLatency(%q) = %v", tt.preset, err)
+		}
+	}
+	for _, preset := range []string{"", "medium", "HIGH"} {
+		if _, err := ResolveLatency(preset, low, high); !errors.Is(err, ErrUnknownLatency) {
+			t.Errorf("ResolveLatency(%q) = %v, want ErrUnknownLatency", preset, err)
+		}
+	}
+}
+
+// Check at compile time that the streams of both backends implement AudioStream.
+var (
+	_ AudioStream = (*ConcreteAudioStream)(nil)
+	_ AudioStream = (*MalgoAudioStream)(nil)
+)
+
+func TestNewInputStreamBackend(t *testing.T) {
+	// Replace the constructors with ones recording which backend was called.
+	saved := inputBackends
+	t.Cleanup(func() { inputBackends = saved })
+	var called string
+	inputBackends = map[string]func(bufferSize, channels int, format, latency string) (AudioStream, func(), error){}
+	for backend := range saved {
+		backend := backend
+		inputBackends[backend] = func(bufferSize, channels int, format, latency string) (AudioStream, func(), error) {
+			called = backend
+			return newFakeStream(bufferSize*channels, nil), func() {}, nil
+		}
+	}
+
+	for _, backend := range []string{BackendPortAudio, BackendMalgo} {
+		called = ""
+		stream, _, err := NewInputStream(backend, 64, 2, CaptureInt16, LatencyLow)
+		if err != nil || called != backend || len(stream.Buffer()) != 128 {
+			t.Errorf("NewInputStream(%s) called the %q backend (%v), want %s", backend, called, err, backend)
+		}
+	}
+
+	called = ""
+	if _, _, err := NewInputStream("alsa", 64, 1, CaptureFloat32, LatencyHigh); !errors.Is(err, ErrUnknownBackend) || called != "" {
+		t.Errorf("NewInputStream(alsa) = %v and called %q, want ErrUnknownBackend", err, called)
+	}
+}
+
+func TestVolumeBarCeiling(t *testing.T) {
+	tests := []struct {
+		ceiling float32
+		volume  float32
+		want    int
+	}{
+		{0, 0.1, maxBarCount / 10},           // The default ceiling of 1 barely moves for a quiet microphone
+		{1, 0.5, maxBarCount / 2},            // Half the ceiling fills half the bar
+		{0.1, 0.095, maxBarCount * 95 / 100}, // A low ceiling fills the bar with a small RMS
+		{0.1, 0.5, maxBarCount},              // Louder than the ceiling is clamped
+		{0.1, -0.1, 0},
+	}
+	for _, tt := range tests {
+		vb := NewVolumeBar()
+		vb.Ceiling = tt.ceiling
+		vb.Update(tt.volume)
+		if vb.BarCount != tt.want {
+			t.Errorf("ceiling %v: Update(%v) fills %d bars, want %d", tt.ceiling, tt.volume, vb.BarCount, tt.want)
+		}
+		if bar := vb.Draw(); len(bar) != maxBarCount+2 {
+			t.Errorf("ceiling %v: Draw(%v) = %q, want %d characters", tt.ceiling, tt.volume, bar, maxBarCount+2)
+		}
+	}
+}
+
+func TestSlidingRMSStep(t *testing.T) {
+	meter := NewSlidingRMS(0.5)
+	// A step from silence to 1 rises gradually: halfway to the remaining distance with each buffer.
+	want := []float32{0.5, 0.75, 0.875, 0.9375}
+	for i, w := range want {
+		if got := meter.Update(1); math.Abs(float64(got-w)) > 1e-6 {
+			t.Errorf("level after %d buffers = %v, want %v", i+1, got, w)
+		}
+	}
+	// And falls gradually back toward silence.
+	if got := meter.Update(0); math.Abs(float64(got-0.46875)) > 1e-6 {
+		t.Errorf("level after a silent buffer = %v, want 0.46875", got)
+	}
+
+	// No smoothing follows each buffer.
+	if got := NewSlidingRMS(0).Update(0.3); got != 0.3 {
+		t.Errorf("unsmoothed level = %v, want 0.3", got)
+	}
+}
+
+func TestVolumeBarColor(t *testing.T) {
+	vb := NewVolumeBar()
+	vb.Update(0.95)
+	if bar := vb.Draw(); strings.Contains(bar, "\033[") {
+		t.Errorf("uncolored bar %q contains escape codes", bar)
+	}
+	vb.Color = true
+	if bar := vb.Draw(); !strings.HasPrefix(bar, "["+ansiRed) || !strings.Contains(bar, ansiReset) {
+		t.Errorf("colored bar of a loud volume = %q, want it red", bar)
+	}
+}
+
+func TestApplyGainClamps(t *testing.T) {
+	samples := []float32{0.3, -0.3, 0.9, -0.9, 0.001}
+	amplified := ApplyGain(samples, 100)
+	want := []float32{1, -1, 1, -1, 0.1}
+	for i := range want {
+		if diff := amplified[i] - want[i]; diff > 1e-6 || diff < -1e-6 {
+			t.Errorf("ApplyGain(%v, 100) = %v, want %v", samples[i], amplified[i], want[i])
+		}
+	}
+}
+
+// fakeStream is an AudioStream test double that fills its buffer with a sawtooth that never repeats exactly,
+// and fails the reads for which readErr returns an error.
+type fakeStream struct {
+	buffer           []float32
+	reads            int
+	readErr          func(read int) error
+	started, stopped bool
+}
+
+// Check at compile time that the test doubles implement the stream interfaces.
+var (
+	_ AudioStream  = (*fakeStream)(nil)
+	_ OutputStream = (*fakeOutputStream)(nil)
+)
+
+// newFakeStream creates a fakeStream of buffers of the given size, failing the reads as readErr says.
+func newFakeStream(size int, readErr func(read int) error) *fakeStream {
+	return &fakeStream{buffer: make([]float32, size), readErr: readErr}
+}
+
+// Read fills the buffer and returns the error of readErr for this read, if any.
+func (s *fakeStream) Read() error {
+	s.reads++
+	for i := range s.buffer {
+		s.buffer[i] = float32((s.reads*len(s.buffer)+i)%199-99) / 100
+	}
+	if s.readErr != nil {
+		return s.readErr(s.reads)
+	}
+	return nil
+}
+
+func (s *fakeStream) Start() error      { s.started = true; return nil }
+func (s *fakeStream) Stop() error       { s.stopped = true; return nil }
+func (s *fakeStream) Close() error      { return nil }
+func (s *fakeStream) Buffer() []float32 { return s.buffer }
+
+// failAt returns a readErr function failing the nth read with err.
+func failAt(n int, err error) func(read int) error {
+	return func(read int) error {
+		if read == n {
+			return err
+		}
+		return nil
+	}
+}
+
+// longRecording is a recording length the error tests never reach, unless the error does not abort it.
+const longRecording = 30 * time.Second
+
+// recordWithTimeout runs RecordAudioWithOptions and fails the test if it does not return within timeout, as
+// happens when the recording routine and the waiting one deadlock.
+func recordWithTimeout(t *testing.T, stream AudioStream, calculateVolume func([]float32) (float32, error), opts RecordOptions, timeout time.Duration) (*Recording, error) {
+	t.Helper()
+	type result struct {
+		recording *Recording
+		err       error
+	}
+	done := make(chan result, 1)
+	go func() {
+		recording, err := RecordAudioWithOptions(stream, calculateVolume, opts)
+		done <- result{recording, err}
+	}()
+	select {
+	case r := <-done:
+		return r.recording, r.err
+	case <-time.After(timeout):
+		t.Fatalf("RecordAudioWithOptions did not return within %v", timeout)
+		return nil, nil
+	}
+}
+
+// checkGoroutines fails the test if the number of goroutines does not go back to before within a second.
+func checkGoroutines(t *testing.T, before int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Errorf("%d goroutines left running, %d before recording", runtime.NumGoroutine(), before)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+var errRead = errors.New("injected read error")
+
+func TestRecordAudioWithOptions(t *testing.T) {
+	stream := newFakeStream(64, nil)
+	recording, err := recordWithTimeout(t, stream, CalculateVolume, RecordOptions{Duration: 50 * time.Millisecond, LoopSleep: time.Millisecond}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recording.Samples) == 0 || len(recording.Samples)%64 != 0 {
+		t.Errorf("recorded %d samples, want a positive multiple of the 64-sample buffer", len(recording.Samples))
+	}
+	if recording.Reads*64 != len(recording.Samples) {
+		t.Errorf("%d reads recorded %d samples, want %d", recording.Reads, len(recording.Samples), recording.Reads*64)
+	}
+	if !stream.started || !stream.stopped {
+		t.Errorf("stream started %v, stopped %v, want both", stream.started, stream.stopped)
+	}
+}
+
+func TestRecordAudioWithOptionsReadError(t *testing.T) {
+	before := runtime.NumGoroutine()
+	stream := newFakeStream(64, failAt(3, errRead))
+	_, err := recordWithTimeout(t, stream, CalculateVolume, RecordOptions{Duration: longRecording, LoopSleep: time.Millisecond}, 5*time.Second)
+	if !errors.Is(err, errRead) {
+		t.Errorf("RecordAudioWithOptions = %v, want the read error", err)
+	}
+	if !stream.stopped {
+		t.Error("the stream was not stopped after the read error")
+	}
+	if stream.reads != 3 {
+		t.Errorf("%d reads, want the recording to stop at the failing third one", stream.reads)
+	}
+	checkGoroutines(t, before)
+}
+
+func TestRecordAudioWithOptionsVolumeError(t *testing.T) {
+	before := runtime.NumGoroutine()
+	errVolume := errors.New("injected volume error")
+	calls := 0
+	calculateVolume := func(buffer []float32) (float32, error) {
+		calls++
+		if calls == 2 {
+			return 0, errVolume
+		}
+		return CalculateVolume(buffer)
+	}
+	stream := newFakeStream(64, nil)
+	_, err := recordWithTimeout(t, stream, calculateVolume, RecordOptions{Duration: longRecording, LoopSleep: time.Millisecond}, 5*time.Second)
+	if !errors.Is(err, errVolume) {
+		t.Errorf("RecordAudioWithOptions = %v, want the volume error", err)
+	}
+	if !stream.stopped {
+		t.Error("the stream was not stopped after the volume error")
+	}
+	checkGoroutines(t, before)
+}
+
+func TestRecordAudioWithOptionsWarmupError(t *testing.T) {
+	before := runtime.NumGoroutine()
+	stream := newFakeStream(64, failAt(2, errRead))
+	_, err := recordWithTimeout(t, stream, CalculateVolume, RecordOptions{Duration: longRecording, Warmup: 5}, 5*time.Second)
+	if !errors.Is(err, errRead) {
+		t.Errorf("RecordAudioWithOptions = %v, want the warmup read error", err)
+	}
+	checkGoroutines(t, before)
+}
+
+func TestRecordAudioFirstReadError(t *testing.T) {
+	before := runtime.NumGoroutine()
+	stream := newFakeStream(64, failAt(1, errRead))
+	done := make(chan error, 1)
+	go func() {
+		_, err := RecordAudio(stream, CalculateVolume)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, errRead) {
+			t.Errorf("RecordAudio = %v, want the read error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RecordAudio deadlocked on the first read error")
+	}
+	checkGoroutines(t, before)
+}
+
+func TestDecimate(t *testing.T) {
+	samples := make([]float32, 10)
+	for i := range samples {
+		samples[i] = float32(i)
+	}
+	tests := []struct {
+		channels, factor int
+		want             []float32
+	}{
+		{1, 1, []float32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{1, 3, []float32{0, 3, 6, 9}},
+		{1, 4, []float32{0, 4, 8}},
+		// Whole frames are kept: frames 0, 2 and 4 of the stereo pairs.
+		{2, 2, []float32{0, 1, 4, 5, 8, 9}},
+		{2, 3, []float32{0, 1, 6, 7}},
+	}
+	for _, tt := range tests {
+		got := Decimate(samples, tt.channels, tt.factor)
+		if len(got) != len(tt.want) {
+			t.Errorf("Decimate(%d channels, factor %d) = %v, want %v", tt.channels, tt.factor, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("Decimate(%d channels, factor %d) = %v, want %v", tt.channels, tt.factor, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestSanitizeSamples(t *testing.T) {
+	samples := []float32{0.5, float32(math.NaN()), -0.25, float32(math.Inf(1)), float32(math.Inf(-1)), 1}
+	clean, dropped := SanitizeSamples(samples)
+	if dropped != 3 {
+		t.Errorf("SanitizeSamples dropped %d samples, want 3", dropped)
+	}
+	want := []float32{0.5, 0, -0.25, 0, 0, 1}
+	for i := range want {
+		if clean[i] != want[i] {
+			t.Errorf("SanitizeSamples = %v, want %v", clean, want)
+			break
+		}
+	}
+}
+
+// fakeOutputStream is an OutputStream test double that records the samples written to it.
+type fakeOutputStream struct {
+	buffer           []float32
+	played           []float32
+	started, stopped bool
+}
+
+func (s *fakeOutputStream) Write() error {
+	s.played = append(s.played, s.buffer...)
+	return nil
+}
+
+func (s *fakeOutputStream) Start() error      { s.started = true; return nil }
+func (s *fakeOutputStream) Stop() error       { s.stopped = true; return nil }
+func (s *fakeOutputStream) Close() error      { return nil }
+func (s *fakeOutputStream) Buffer() []float32 { return s.buffer }
+
+func TestPlayAudio(t *testing.T) {
+	stream := &fakeOutputStream{buffer: make([]float32, 64)}
+	samples := make([]float32, 150)
+	for i := range samples {
+		samples[i] = float32(i+1) / 150
+	}
+	frames, err := PlayAudio(stream, samples)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 150 samples take three 64-frame buffers, the last one padded with silence.
+	if frames != 192 || len(stream.played) != 192 {
+		t.Errorf("PlayAudio wrote %d frames, played %d, want 192", frames, len(stream.played))
+	}
+	for i, sample := range stream.played {
+		want := float32(0)
+		if i < len(samples) {
+			want = samples[i]
+		}
+		if sample != want {
+			t.Errorf("played sample %d = %v, want %v", i, sample, want)
+			break
+		}
+	}
+	if !stream.started || !stream.stopped {
+		t.Errorf("stream started %v, stopped %v, want both", stream.started, stream.stopped)
+	}
+
+	if _, err := PlayAudio(&fakeOutputStream{}, samples); !errors.Is(err, ErrInvalidBuffer) {
+		t.Errorf("PlayAudio on an empty buffer = %v, want ErrInvalidBuffer", err)
+	}
+}
+
+func TestDownmixToMono(t *testing.T) {
+	tests := []struct {
+		interleaved []float32
+		channels    int
+		want        []float32
+	}{
+		{[]float32{0.5, -0.5, 1, 0, -1, -0.5}, 2, []float32{0, 0.5, -0.75}},
+		// The trailing half frame is ignored.
+		{[]float32{0.5, 0.25, 1}, 2, []float32{0.375}},
+		{[]float32{0.3, 0.6, 0.9, -0.3, 0, 0.3}, 3, []float32{0.6, 0}},
+		{[]float32{0.1, 0.2}, 1, []float32{0.1, 0.2}},
+	}
+	for _, tt := range tests {
+		got := DownmixToMono(tt.interleaved, tt.channels)
+		if len(got) != len(tt.want) {
+			t.Errorf("DownmixToMono(%v, %d) = %v, want %v", tt.interleaved, tt.channels, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if math.Abs(float64(got[i]-tt.want[i])) > 1e-6 {
+				t.Errorf("DownmixToMono(%v, %d) = %v, want %v", tt.interleaved, tt.channels, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestRecordingDigest(t *testing.T) {
+	var recordings []*Recording
+	var concatenated []byte
+	for i := 0; i < 2; i++ {
+		recording, err := recordWithTimeout(t, newFakeStream(64, nil), CalculateVolume, RecordOptions{Duration: 20 * time.Millisecond, LoopSleep: time.Millisecond}, 5*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The digest updated frame by frame equals the hash of all the frames at once.
+		data := utils.Float32ToByteSlice(recording.Samples)
+		if recording.Digest != sha256.Sum256(data) {
+			t.Errorf("digest of %d reads differs from the hash of their samples", recording.Reads)
+		}
+		recordings = append(recordings, recording)
+		concatenated = append(concatenated, data...)
+	}
+
+	joined := ConcatRecordings(recordings)
+	if joined.Digest != sha256.Sum256(concatenated) {
+		t.Error("digest of the joined recordings differs from the hash of their concatenation")
+	}
+	if joined.Reads != recordings[0].Reads+recordings[1].Reads {
+		t.Errorf("joined reads = %d, want %d", joined.Reads, recordings[0].Reads+recordings[1].Reads)
+	}
+}
+
+func TestMultiChannelVolume(t *testing.T) {
+	// The left channel alternates ±0.5, the right one ±0.1, with a trailing partial frame ignored.
+	interleaved := []float32{0.5, 0.1, -0.5, -0.1, 0.5, 0.1, -0.5, -0.1, 0.9}
+	volumes := MultiChannelVolume(interleaved, 2)
+	want := []float32{0.5, 0.1}
+	if len(volumes) != len(want) {
+		t.Fatalf("MultiChannelVolume = %v, want %v", volumes, want)
+	}
+	for c := range want {
+		if math.Abs(float64(volumes[c]-want[c])) > 1e-6 {
+			t.Errorf("channel %d RMS = %v, want %v", c, volumes[c], want[c])
+		}
+	}
+
+	if volumes := MultiChannelVolume(nil, 2); len(volumes) != 2 || volumes[0] != 0 || volumes[1] != 0 {
+		t.Errorf("MultiChannelVolume of no samples = %v, want two zero volumes", volumes)
+	}
+	if volumes := MultiChannelVolume(interleaved, 0); volumes != nil {
+		t.Errorf("MultiChannelVolume with no channels = %v, want nil", volumes)
+	}
+}
+
+// blockingStream is a fakeStream whose Start and Stop block until release is closed, like a hung device.
+type blockingStream struct {
+	fakeStream
+	release chan struct{}
+}
+
+func (s *blockingStream) Start() error { <-s.release; return nil }
+func (s *blockingStream) Stop() error  { <-s.release; return nil }
+
+func TestCallWithTimeout(t *testing.T) {
+	stream := &blockingStream{release: make(chan struct{})}
+	defer close(stream.release)
+
+	start := time.Now()
+	if err := callWithTimeout(stream.Start, 50*time.Millisecond, ErrAudioStartTimeout); !errors.Is(err, ErrAudioStartTimeout) {
+		t.Errorf("callWithTimeout of a blocked Start = %v, want ErrAudioStartTimeout", err)
+	}
+	if err := callWithTimeout(stream.Stop, 50*time.Millisecond, ErrAudioStopTimeout); !errors.Is(err, ErrAudioStopTimeout) {
+		t.Errorf("callWithTimeout of a blocked Stop = %v, want ErrAudioStopTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("the timeouts took %v", elapsed)
+	}
+
+	// Errors are wrapped with context, and successful calls return nil.
+	if err := callWithTimeout(func() error { return errRead }, time.Second, ErrAudioStartTimeout); !errors.Is(err, errRead) || errors.Is(err, ErrAudioStartTimeout) {
+		t.Errorf("callWithTimeout of a failing call = %v, want the wrapped error", err)
+	}
+	if err := callWithTimeout(func() error { return nil }, time.Second, ErrAudioStartTimeout); err != nil {
+		t.Errorf("callWithTimeout of a successful call = %v", err)
+	}
+}
+
+func TestRecordAudioWithOptionsWarmup(t *testing.T) {
+	stream := newFakeStream(64, nil)
+	recording, err := recordWithTimeout(t, stream, CalculateVolume, RecordOptions{Duration: 20 * time.Millisecond, LoopSleep: time.Millisecond, Warmup: 3}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stream.reads != recording.Reads+3 {
+		t.Errorf("%d reads for %d recorded buffers, want 3 more for the warmup", stream.reads, recording.Reads)
+	}
+	// The recording starts with the buffer of the fourth read.
+	want := newFakeStream(64, nil)
+	for i := 0; i < 4; i++ {
+		want.Read()
+	}
+	for i, sample := range want.buffer {
+		if recording.Samples[i] != sample {
+			t.Fatalf("recorded sample %d = %v, want %v from the first read after the warmup", i, recording.Samples[i], sample)
+		}
+	}
+}
+
+func TestRepaintThrottle(t *testing.T) {
+	throttle := repaintThrottle{interval: 50 * time.Millisecond}
+	start := time.Unix(1000, 0)
+	steps := []struct {
+		after time.Duration
+		want  bool
+	}{
+		{0, true},
+		{10 * time.Millisecond, false},
+		{49 * time.Millisecond, false},
+		{50 * time.Millisecond, true},
+		// The interval restarts from the last repaint, not from the suppressed ones.
+		{60 * time.Millisecond, false},
+		{100 * time.Millisecond, true},
+	}
+	for _, step := range steps {
+		if got := throttle.ready(start.Add(step.after)); got != step.want {
+			t.Errorf("ready after %v = %v, want %v", step.after, got, step.want)
+		}
+	}
+
+	unthrottled := repaintThrottle{}
+	for i := 0; i < 3; i++ {
+		if !unthrottled.ready(start) {
+			t.Error("a zero interval suppressed a repaint")
+		}
+	}
+}
+
+func TestSwapChannels(t *testing.T) {
+	interleaved := []float32{0.1, 0.2, 0.3, 0.4, 0.5}
+	swapped := SwapChannels(interleaved)
+	// The trailing partial frame is kept as is.
+	want := []float32{0.2, 0.1, 0.4, 0.3, 0.5}
+	for i := range want {
+		if swapped[i] != want[i] {
+			t.Fatalf("SwapChannels(%v) = %v, want %v", interleaved, swapped, want)
+		}
+	}
+	if interleaved[0] != 0.1 {
+		t.Error("SwapChannels modified its input")
+	}
+	twice := SwapChannels(swapped)
+	for i := range interleaved {
+		if twice[i] != interleaved[i] {
+			t.Fatalf("swapping twice = %v, want %v", twice, interleaved)
+		}
+	}
+}
+
+func TestRecordAudioWithOptionsMinDuration(t *testing.T) {
+	stop := make(chan struct{})
+	go func() {
+		// The first request comes before the minimum duration and is ignored, the second one after it.
+		time.Sleep(20 * time.Millisecond)
+		stop <- struct{}{}
+		time.Sleep(300 * time.Millisecond)
+		stop <- struct{}{}
+	}()
+
+	start := time.Now()
+	opts := RecordOptions{Duration: longRecording, LoopSleep: time.Millisecond, Stop: stop, MinDuration: 200 * time.Millisecond}
+	if _, err := recordWithTimeout(t, newFakeStream(64, nil), CalculateVolume, opts, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("recording stopped after %v, want the stop request before the minimum duration ignored", elapsed)
+	}
+}
+
+// fakeBuffer returns the buffer of the given size that fakeStream fills on its nth read.
+func fakeBuffer(size, read int) []float32 {
+	buffer := make([]float32, size)
+	for i := range buffer {
+		buffer[i] = float32((read*size+i)%199-99) / 100
+	}
+	return buffer
+}
+
+func TestReadWithOverflowPolicy(t *testing.T) {
+	overflowed := fmt.Errorf("%w: lost input", ErrInputOverflowed)
+	tests := []struct {
+		name       string
+		policy     string
+		readErr    func(read int) error
+		wantKeep   bool
+		wantReads  int
+		wantBuffer int // The read whose data is in the buffer
+		wantErr    error
+	}{
+		{"keep", OverflowKeep, failAt(1, overflowed), true, 1, 1, nil},
+		{"default keeps", "", failAt(1, overflowed), true, 1, 1, nil},
+		{"discard", OverflowDiscard, failAt(1, overflowed), false, 1, 1, nil},
+		{"retry succeeds", OverflowRetry, failAt(1, overflowed), true, 2, 2, nil},
+		{"retry overflows again", OverflowRetry, func(int) error { return overflowed }, false, 2, 2, nil},
+		{"read error", OverflowRetry, failAt(1, errRead), false, 1, 1, errRead},
+	}
+	for _, tt := range tests {
+		stream := newFakeStream(8, tt.readErr)
+		keep, gotOverflowed, err := readWithOverflowPolicy(stream, tt.policy)
+		if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if keep != tt.wantKeep {
+			t.Errorf("%s: keep = %v, want %v", tt.name, keep, tt.wantKeep)
+		}
+		if gotOverflowed != (tt.wantErr == nil) {
+			t.Errorf("%s: overflowed = %v", tt.name, gotOverflowed)
+		}
+		if stream.reads != tt.wantReads {
+			t.Errorf("%s: %d reads, want %d", tt.name, stream.reads, tt.wantReads)
+		}
+		if !reflect.DeepEqual(stream.Buffer(), fakeBuffer(8, tt.wantBuffer)) {
+			t.Errorf("%s: buffer does not hold read %d", tt.name, tt.wantBuffer)
+		}
+	}
+}
+
+func TestRecordAudioWithOptionsOverflowPolicy(t *testing.T) {
+	const size = 64
+	overflowed := fmt.Errorf("%w: lost input", ErrInputOverflowed)
+	tests := []struct {
+		policy        string
+		wantSecond    int // The read whose data follows the first buffer in the recording
+		wantDiscarded int
+	}{
+		{OverflowKeep, 2, 0},
+		{OverflowDiscard, 3, 1},
+		{OverflowRetry, 3, 0},
+	}
+	for _, tt := range tests {
+		stream := newFakeStream(size, failAt(2, overflowed))
+		opts := RecordOptions{Duration: 50 * time.Millisecond, LoopSleep: time.Millisecond, OverflowPolicy: tt.policy}
+		recording, err := recordWithTimeout(t, stream, CalculateVolume, opts, 5*time.Second)
+		if err != nil {
+			t.Errorf("%s: %v", tt.policy, err)
+			continue
+		}
+		if len(recording.Samples) < 2*size {
+			t.Errorf("%s: recorded %d samples, want at least two buffers", tt.policy, len(recording.Samples))
+			continue
+		}
+		if !reflect.DeepEqual(recording.Samples[size:2*size], fakeBuffer(size, tt.wantSecond)) {
+			t.Errorf("%s: second buffer of the recording is not read %d", tt.policy, tt.wantSecond)
+		}
+		if recording.DiscardedBuffers != tt.wantDiscarded || recording.Overflows != 1 {
+			t.Errorf("%s: %d buffers discarded and %d overflows, want %d and 1", tt.policy, recording.DiscardedBuffers, recording.Overflows, tt.wantDiscarded)
+		}
+	}
+}
+
+func TestRecordAudioWithOptionsMaxOverflowRatio(t *testing.T) {
+	overflowed := fmt.Errorf("%w: lost input", ErrInputOverflowed)
+	// Three of every four reads overflow.
+	mostlyOverflowing := func(read int) error {
+		if read%4 != 0 {
+			return overflowed
+		}
+		return nil
+	}
+	opts := RecordOptions{Duration: 50 * time.Millisecond, LoopSleep: time.Millisecond, MaxOverflowRatio: 0.1}
+
+	before := runtime.NumGoroutine()
+	_, err := recordWithTimeout(t, newFakeStream(64, mostlyOverflowing), CalculateVolume, opts, 5*time.Second)
+	if !errors.Is(err, ErrTooManyOverflows) {
+		t.Errorf("recording with 75%% overflows = %v, want ErrTooManyOverflows", err)
+	}
+	checkGoroutines(t, before)
+
+	// A ratio above the overflows, and zero, which disables the check, keep the recording.
+	for _, ratio := range []float64{0.9, 0} {
+		opts.MaxOverflowRatio = ratio
+		if _, err := recordWithTimeout(t, newFakeStream(64, mostlyOverflowing), CalculateVolume, opts, 5*time.Second); err != nil {
+			t.Errorf("recording with 75%% overflows and a maximum ratio of %v: %v", ratio, err)
+		}
+	}
+}
+
+func TestRecordAudioWithOptionsLoopSleep(t *testing.T) {
+	// fakeStream reads return at once, like backends whose reads do not block.
+	record := func(loopSleep time.Duration) int {
+		t.Helper()
+		stream := newFakeStream(16, nil)
+		opts := RecordOptions{Duration: 100 * time.Millisecond, LoopSleep: loopSleep, Refresh: time.Hour}
+		if _, err := recordWithTimeout(t, stream, CalculateVolume, opts, 5*time.Second); err != nil {
+			t.Fatal(err)
+		}
+		return stream.reads
+	}
+
+	busy := record(0)
+	throttled := record(10 * time.Millisecond)
+	// A 10 ms pause allows about 10 reads in 100 ms; leave room for a slow scheduler.
+	if throttled > 20 {
+		t.Errorf("%d reads in 100 ms with a 10 ms loop sleep, want at most about 10", throttled)
+	}
+	if busy < 10*throttled {
+		t.Errorf("%d reads without a loop sleep and %d with one, want the sleep to avoid busy-waiting", busy, throttled)
+	}
+}
+
+// BenchmarkRecordLoop measures the reads of a non-blocking stream during 20 ms of recording: each read is CPU
+// time the recording loop spends spinning, unless LoopSleep paces it.
+func BenchmarkRecordLoop(b *testing.B) {
+	for _, loopSleep := range []time.Duration{0, time.Millisecond} {
+		b.Run(loopSleep.String(), func(b *testing.B) {
+			reads := 0
+			for i := 0; i < b.N; i++ {
+				stream := newFakeStream(16, nil)
+				if _, err := RecordAudioWithOptions(stream, CalculateVolume, RecordOptions{Duration: 20 * time.Millisecond, LoopSleep: loopSleep, Refresh: time.Hour}); err != nil {
+					b.Fatal(err)
+				}
+				reads += stream.reads
+			}
+			b.ReportMetric(float64(reads)/float64(b.N), "reads/op")
+		})
+	}
+}
+
+// captureStdout returns what f prints to the standard output.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan string)
+	go func() {
+		contents, _ := io.ReadAll(r)
+		output <- string(contents)
+	}()
+	f()
+	w.Close()
+	return <-output
+}
+
+func TestRecordAudioWithOptionsPrompt(t *testing.T) {
+	for _, prompt := range []string{"", PromptAmbient, PromptTap, PromptMusic, "Whistle a tune..."} {
+		output := captureStdout(t, func() {
+			opts := RecordOptions{Duration: 10 * time.Millisecond, LoopSleep: time.Millisecond, Prompt: prompt}
+			if _, err := recordWithTimeout(t, newFakeStream(64, nil), CalculateVolume, opts, 5*time.Second); err != nil {
+				t.Error(err)
+			}
+		})
+		if want := PromptText(prompt); !strings.Contains(output, "Recording. "+want) {
+			t.Errorf("prompt %q: output does not show %q:\n%s", prompt, want, output)
+		}
+	}
+	if PromptText("") != PromptText(PromptSpeak) || PromptText(PromptTap) == PromptTap {
+		t.Error("PromptText does not resolve the presets")
+	}
+}
+
+func TestMonitorLevels(t *testing.T) {
+	stream := newFakeStream(64, nil)
+	updates := 0
+	calculateVolume := func(buffer []float32) (float32, error) {
+		updates++
+		return CalculateVolume(buffer)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+
+	before := runtime.NumGoroutine()
+	done := make(chan error, 1)
+	go func() {
+		done <- MonitorLevels(ctx, stream, calculateVolume, RecordOptions{LoopSleep: time.Millisecond})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("MonitorLevels = %v, want nil on cancel", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("MonitorLevels did not return after its context was canceled")
+	}
+	checkGoroutines(t, before)
+
+	if updates == 0 || updates != stream.reads {
+		t.Errorf("%d bar updates for %d reads, want one per read", updates, stream.reads)
+	}
+	if !stream.started || !stream.stopped {
+		t.Errorf("stream started %v and stopped %v, want both", stream.started, stream.stopped)
+	}
+
+	// A read error ends the monitoring.
+	err := MonitorLevels(context.Background(), newFakeStream(64, failAt(3, errRead)), CalculateVolume, RecordOptions{})
+	if !errors.Is(err, errRead) {
+		t.Errorf("MonitorLevels with a read error = %v, want errRead", err)
+	}
+}
+
+// fadingStream is a fakeStream that falls silent after a number of reads.
+type fadingStream struct {
+	*fakeStream
+	loudReads int
+}
+
+func (s *fadingStream) Read() error {
+	err := s.fakeStream.Read()
+	if s.reads > s.loudReads {
+		for i := range s.buffer {
+			s.buffer[i] = 0
+		}
+	}
+	return err
+}
+
+func TestRecordAudioWithOptionsStopOnSilence(t *testing.T) {
+	// Buffers of 10 ms of audio: 5 loud ones, then silence, which must end the recording after 100 ms of it.
+	const frames = sampleRate / 100
+	stream := &fadingStream{fakeStream: newFakeStream(frames, nil), loudReads: 5}
+	opts := RecordOptions{Duration: longRecording, LoopSleep: time.Millisecond, StopOnSilence: 100 * time.Millisecond}
+
+	recording, err := recordWithTimeout(t, stream, CalculateVolume, opts, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffers := len(recording.Samples) / frames
+	if buffers < 15 || buffers > 25 {
+		t.Errorf("recorded %d buffers, want the 5 loud ones and about 10 silent ones", buffers)
+	}
+}
+
+// frozenStream is a fakeStream that returns the same loud buffer from a number of reads on.
+type frozenStream struct {
+	*fakeStream
+	frozenAt int
+}
+
+func (s *frozenStream) Read() error {
+	if s.reads >= s.frozenAt {
+		s.reads++
+		return nil
+	}
+	return s.fakeStream.Read()
+}
+
+func TestRecordAudioWithOptionsStuckDevice(t *testing.T) {
+	opts := RecordOptions{Duration: longRecording, LoopSleep: time.Millisecond, MaxRepeatedBuffers: 5}
+	before := runtime.NumGoroutine()
+	stream := &frozenStream{fakeStream: newFakeStream(64, nil), frozenAt: 3}
+	if _, err := recordWithTimeout(t, stream, CalculateVolume, opts, 5*time.Second); !errors.Is(err, ErrStuckDevice) {
+		t.Errorf("recording from a frozen device = %v, want ErrStuckDevice", err)
+	}
+	// The buffer of read 3 is repeated by reads 4 to 9, one more time than the 5 repeats allowed.
+	if stream.reads != 9 {
+		t.Errorf("recording aborted after %d reads, want 9", stream.reads)
+	}
+	checkGoroutines(t, before)
+
+	// Changing buffers, or a disabled check, keep the recording going.
+	opts.Duration = 50 * time.Millisecond
+	if _, err := recordWithTimeout(t, newFakeStream(64, nil), CalculateVolume, opts, 5*time.Second); err != nil {
+		t.Errorf("recording from a working device: %v", err)
+	}
+	opts.MaxRepeatedBuffers = 0
+	if _, err := recordWithTimeout(t, &frozenStream{fakeStream: newFakeStream(64, nil), frozenAt: 3}, CalculateVolume, opts, 5*time.Second); err != nil {
+		t.Errorf("recording from a frozen device without the check: %v", err)
+	}
+}
+
+// switchingStream is a fakeStream whose input device switches from "built-in" to "headset" after a number of
+// identity checks, as when headphones are plugged in. DeviceID runs concurrently with Read.
+type switchingStream struct {
+	*fakeStream
+	mu       sync.Mutex
+	checks   int
+	switchAt int
+}
+
+func (s *switchingStream) DeviceID() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checks++
+	if s.switchAt > 0 && s.checks > s.switchAt {
+		return "headset", nil
+	}
+	return "built-in", nil
+}
+
+func TestRecordAudioWithOptionsDeviceChange(t *testing.T) {
+	opts := RecordOptions{Duration: longRecording, LoopSleep: time.Millisecond, DeviceCheckInterval: 5 * time.Millisecond}
+	before := runtime.NumGoroutine()
+	// The identity is read when the recording starts, then checked; the third check sees the new device.
+	stream := &switchingStream{fakeStream: newFakeStream(64, nil), switchAt: 3}
+	_, err := recordWithTimeout(t, stream, CalculateVolume, opts, 5*time.Second)
+	if !errors.Is(err, ErrDeviceChanged) {
+		t.Errorf("recording across a device switch = %v, want ErrDeviceChanged", err)
+	}
+	if err != nil && !strings.Contains(err.Error(), `"built-in" to "headset"`) {
+		t.Errorf("device change error %q does not name the devices", err)
+	}
+	checkGoroutines(t, before)
+
+	// Without a switch, or without checks, the recording completes.
+	opts.Duration = 50 * time.Millisecond
+	if _, err := recordWithTimeout(t, &switchingStream{fakeStream: newFakeStream(64, nil)}, CalculateVolume, opts, 5*time.Second); err != nil {
+		t.Errorf("recording from the same device: %v", err)
+	}
+	opts.DeviceCheckInterval = 0
+	if _, err := recordWithTimeout(t, &switchingStream{fakeStream: newFakeStream(64, nil), switchAt: 1}, CalculateVolume, opts, 5*time.Second); err != nil {
+		t.Errorf("recording without device checks: %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+// audio/features.go
+
+package audio
+
+import "math"
+
+const (
+	// FeatureWindows is the default number of windows of a feature vector.
+	FeatureWindows = 32
+	// FeatureLevels is the default number of quantization levels of a feature vector.
+	FeatureLevels = 8
+)
+
+// ExtractFeatures returns a coarse feature vector of mono samples: the RMS of each of windows equal windows,
+// normalized to the loudest window and quantized to levels levels. Small variations between two
+// recordings of the same sound mostly disappear in the quantization, unlike with the raw bytes.
+// Silent or too short buffers give an all-zero vector.
+func ExtractFeatures(samples []float32, windows, levels int) []byte {
+	features := make([]byte, windows)
+	if windows < 1 || levels < 2 || len(samples) < windows {
+		return features
+	}
+
+	// Measure the RMS of each window.
+	windowSize := len(samples) / windows
+	rms := make([]float64, windows)
+	peak := 0.0
+	for w := range rms {
+		var sumSquares float64
+		for _, sample := range samples[w*windowSize : (w+1)*windowSize] {
+			sumSquares += float64(sample) * float64(sample)
+		}
+		rms[w] = math.Sqrt(sumSquares / float64(windowSize))
+		peak = math.Max(peak, rms[w])
+	}
+	if peak == 0 {
+		return features
+	}
+
+	// Normalize to the loudest window and quantize, so the overall level does not matter.
+	for w, level := range rms {
+		features[w] = byte(math.Min(math.Floor(level/peak*float64(levels)), float64(levels-1)))
+	}
+	return features
+}
@@ -0,0 +1,31 @@
+// audio/features_test.go
+
+package audio
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestExtractFeatures(t *testing.T) {
+	// A tune of a loud, a quiet and a medium part.
+	tune := append(append(sineWave(4096, 440, 0.8), sineWave(4096, 440, 0.1)...), sineWave(4096, 440, 0.4)...)
+	features := ExtractFeatures(tune, 3, FeatureLevels)
+	if want := []byte{7, 1, 4}; !bytes.Equal(features, want) {
+		t.Errorf("ExtractFeatures = %v, want %v", features, want)
+	}
+
+	// The same tune recorded quieter and with a little noise gives the same features.
+	variation := make([]float32, len(tune))
+	noise := whiteNoise(len(tune), 0.005, 2)
+	for i := range tune {
+		variation[i] = 0.6*tune[i] + noise[i]
+	}
+	if got := ExtractFeatures(variation, 3, FeatureLevels); !bytes.Equal(got, features) {
+		t.Errorf("ExtractFeatures of a variation = %v, want %v", got, features)
+	}
+
+	if got := ExtractFeatures(make([]float32, 4096), 3, FeatureLevels); !bytes.Equal(got, make([]byte, 3)) {
+		t.Errorf("ExtractFeatures of silence = %v, want zeros", got)
+	}
+}
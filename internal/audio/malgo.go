@@ -0,0 +1,186 @@
+//go:build !noaudio
+
+// audio/malgo.go
+
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/gen2brain/malgo"
+)
+
+// malgoQueueLength is the number of device periods the malgo stream queues between two reads before it drops
+// them and reports an overflow.
+const malgoQueueLength = 64
+
+// MalgoAudioStream is an implementation of the AudioStream interface on miniaudio, through malgo, which needs
+// no native library besides the system audio API. miniaudio pushes the captured periods to a callback, which
+// queues them for Read.
+type MalgoAudioStream struct {
+	context *malgo.AllocatedContext
+	device  *malgo.Device
+	format  string
+	buffer  []float32
+	// periods receives copies of the captured periods, and pending holds the bytes not read yet.
+	periods chan []byte
+	pending []byte
+	// overflowed is set by the callback when a period is dropped because the queue is full.
+	overflowed atomic.Bool
+}
+
+// NewMalgoAudioStream creates a new MalgoAudioStream recording the given number of channels in the given native
+// capture format from the default input device. The low latency preset asks miniaudio for its low latency
+// profile, the others for its conservative one.
+func NewMalgoAudioStream(bufferSize, channels int, format, latency string) (*MalgoAudioStream, func(), error) {
+	if channels < 1 {
+		return nil, nil, fmt.Errorf("invalid channel count: %d", channels)
+	}
+	if err := ValidateCaptureFormat(format); err != nil {
+		return nil, nil, err
+	}
+	if err := ValidateLatency(latency); err != nil {
+		return nil, nil, err
+	}
+
+	context, err := malgo.InitContext(nil, malgo.ContextConfig{}, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error initializing miniaudio: %w", err)
+	}
+
+	config := malgo.DefaultDeviceConfig(malgo.Capture)
+	config.Capture.Format = malgo.FormatF32
+	if format == CaptureInt16 {
+		config.Capture.Format = malgo.FormatS16
+	}
+	config.Capture.Channels = uint32(channels)
+	config.SampleRate = sampleRate
+	config.PeriodSizeInFrames = uint32(bufferSize)
+	config.PerformanceProfile = malgo.Conservative
+	if latency == LatencyLow {
+		config.PerformanceProfile = malgo.LowLatency
+	}
+
+	s := &MalgoAudioStream{
+		format:  format,
+		buffer:  make([]float32, bufferSize*channels),
+		periods: make(chan []byte, malgoQueueLength),
+		context: context,
+	}
+	device, err := malgo.InitDevice(context.Context, config, malgo.DeviceCallbacks{Data: s.onData})
+	if err != nil {
+		freeMalgoContext(context)
+		return nil, nil, fmt.Errorf("%w: error opening default input device: %w", ErrNoInputDevice, err)
+	}
+	s.device = device
+
+	// Create a cleanup function.
+	cleanup := func() {
+		if err := s.Close(); err != nil {
+			log.Printf("Error closing the stream: %v", err)
+		}
+		freeMalgoContext(context)
+	}
+
+	return s, cleanup, nil
+}
+
+// freeMalgoContext uninitializes and frees a miniaudio context.
+func freeMalgoContext(context *malgo.AllocatedContext) {
+	if err := context.Uninit(); err != nil {
+		log.Printf("Error terminating miniaudio: %v", err)
+	}
+	context.Free()
+}
+
+// onData queues a copy of the captured samples, as miniaudio reuses its buffer, or drops them if the queue is
+// full. It runs on the audio thread of miniaudio, so it must not block.
+func (s *MalgoAudioStream) onData(_, input []byte, _ uint32) {
+	select {
+	case s.periods <- append([]byte(nil), input...):
+	default:
+		s.overflowed.Store(true)
+	}
+}
+
+// Read fills the buffer with audio data. It returns ErrInputOverflowed, with a filled buffer, when input was lost,
+// and ErrAudioReadTimeout if the device delivers no audio.
+func (s *MalgoAudioStream) Read() error {
+	sampleSize := 4
+	if s.format == CaptureInt16 {
+		sampleSize = 2
+	}
+	need := len(s.buffer) * sampleSize
+	for len(s.pending) < need {
+		select {
+		case period := <-s.periods:
+			s.pending = append(s.pending, period...)
+		case <-time.After(streamControlTimeout):
+			return fmt.Errorf("%w after %v", ErrAudioReadTimeout, streamControlTimeout)
+		}
+	}
+	decodeCapture(s.buffer, s.pending[:need], s.format)
+	s.pending = append(s.pending[:0], s.pending[need:]...)
+
+	if s.overflowed.Swap(false) {
+		return fmt.Errorf("%w: the capture queue was full", ErrInputOverflowed)
+	}
+	return nil
+}
+
+// decodeCapture converts captured samples of the given format, in the little-endian byte order of the supported
+// platforms, into float32 samples in [-1, 1].
+func decodeCapture(dst []float32, src []byte, format string) {
+	if format == CaptureInt16 {
+		for i := range dst {
+			dst[i] = float32(int16(binary.LittleEndian.Uint16(src[2*i:]))) / 32768
+		}
+		return
+	}
+	for i := range dst {
+		dst[i] = math.Float32frombits(binary.LittleEndian.Uint32(src[4*i:]))
+	}
+}
+
+// Buffer returns the buffer filled by Read.
+func (s *MalgoAudioStream) Buffer() []float32 {
+	return s.buffer
+}
+
+// Close uninitializes the device. The stream cannot be used afterwards.
+func (s *MalgoAudioStream) Close() error {
+	if s.device != nil {
+		s.device.Uninit()
+		s.device = nil
+	}
+	return nil
+}
+
+// Start starts the audio stream, giving up with ErrAudioStartTimeout if the device does not respond.
+func (s *MalgoAudioStream) Start() error {
+	return callWithTimeout(s.device.Start, streamControlTimeout, ErrAudioStartTimeout)
+}
+
+// Stop stops the audio stream, giving up with ErrAudioStopTimeout if the device does not respond.
+func (s *MalgoAudioStream) Stop() error {
+	return callWithTimeout(s.device.Stop, streamControlTimeout, ErrAudioStopTimeout)
+}
+
+// DeviceID returns the name of the default input device, which the stream captures from.
+func (s *MalgoAudioStream) DeviceID() (string, error) {
+	devices, err := s.context.Devices(malgo.Capture)
+	if err != nil {
+		return "", fmt.Errorf("error listing devices: %w", err)
+	}
+	for _, device := range devices {
+		if device.IsDefault != 0 {
+			return device.Name(), nil
+		}
+	}
+	return "", ErrNoInputDevice
+}
@@ -0,0 +1,79 @@
+//go:build !noaudio
+
+// audio/malgo_test.go
+
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDecodeCapture(t *testing.T) {
+	ints := []int16{0, 16384, -16384, 32767, -32768}
+	src := make([]byte, 2*len(ints))
+	for i, sample := range ints {
+		binary.LittleEndian.PutUint16(src[2*i:], uint16(sample))
+	}
+	want := []float32{0, 0.5, -0.5, 32767.0 / 32768, -1}
+	dst := make([]float32, len(ints))
+	decodeCapture(dst, src, CaptureInt16)
+	for i := range want {
+		if dst[i] != want[i] {
+			t.Errorf("int16 sample %d = %v, want %v", i, dst[i], want[i])
+		}
+	}
+
+	floats := []float32{0, 0.25, -1, 1}
+	src = make([]byte, 4*len(floats))
+	for i, sample := range floats {
+		binary.LittleEndian.PutUint32(src[4*i:], math.Float32bits(sample))
+	}
+	dst = make([]float32, len(floats))
+	decodeCapture(dst, src, CaptureFloat32)
+	for i := range floats {
+		if dst[i] != floats[i] {
+			t.Errorf("float32 sample %d = %v, want %v", i, dst[i], floats[i])
+		}
+	}
+}
+
+func TestMalgoAudioStreamRead(t *testing.T) {
+	saved := streamControlTimeout
+	t.Cleanup(func() { streamControlTimeout = saved })
+	streamControlTimeout = 50 * time.Millisecond
+
+	// A stream of 2 int16 samples per buffer, fed by the callback without a device.
+	s := &MalgoAudioStream{format: CaptureInt16, buffer: make([]float32, 2), periods: make(chan []byte, 2)}
+	input := []byte{0, 0x40, 0, 0xc0, 0xff, 0x7f}
+	s.onData(nil, input, 3)
+	input[0] = 0xff // The callback keeps a copy, as miniaudio reuses its buffer.
+
+	// Buffers are filled across the periods of the callback.
+	if err := s.Read(); err != nil || s.Buffer()[0] != 0.5 || s.Buffer()[1] != -0.5 {
+		t.Errorf("first Read = %v, %v, want [0.5 -0.5]", s.Buffer(), err)
+	}
+	s.onData(nil, []byte{0, 0x80}, 1)
+	if err := s.Read(); err != nil || s.Buffer()[0] != 32767.0/32768 || s.Buffer()[1] != -1 {
+		t.Errorf("second Read = %v, %v, want [%v -1]", s.Buffer(), err, 32767.0/32768)
+	}
+
+	// Periods that do not fit in the queue are dropped and reported as an overflow.
+	for i := 0; i < 3; i++ {
+		s.onData(nil, []byte{0, 0, 0, 0}, 2)
+	}
+	if err := s.Read(); !errors.Is(err, ErrInputOverflowed) {
+		t.Errorf("Read after a full queue = %v, want ErrInputOverflowed", err)
+	}
+	if err := s.Read(); err != nil {
+		t.Errorf("Read of the queued period = %v", err)
+	}
+
+	// A device that delivers nothing times out.
+	if err := s.Read(); !errors.Is(err, ErrAudioReadTimeout) {
+		t.Errorf("Read without audio = %v, want ErrAudioReadTimeout", err)
+	}
+}
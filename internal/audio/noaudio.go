@@ -0,0 +1,150 @@
+//go:build noaudio
+
+// audio/noaudio.go
+
+package audio
+
+// ConcreteAudioStream stands in for the PortAudio input stream in builds without audio support.
+type ConcreteAudioStream struct {
+	buffer []float32
+}
+
+// NewConcreteAudioStream returns ErrAudioUnavailable.
+func NewConcreteAudioStream(bufferSize int) (*ConcreteAudioStream, func(), error) {
+	return NewConcreteAudioStreamWithChannels(bufferSize, 1)
+}
+
+// NewConcreteAudioStreamWithChannels returns ErrAudioUnavailable.
+func NewConcreteAudioStreamWithChannels(bufferSize, channels int) (*ConcreteAudioStream, func(), error) {
+	return NewConcreteAudioStreamWithFormat(bufferSize, channels, CaptureFloat32)
+}
+
+// NewConcreteAudioStreamWithFormat returns ErrAudioUnavailable.
+func NewConcreteAudioStreamWithFormat(bufferSize, channels int, format string) (*ConcreteAudioStream, func(), error) {
+	return NewConcreteAudioStreamWithLatency(bufferSize, channels, format, LatencyHigh)
+}
+
+// NewConcreteAudioStreamWithLatency returns ErrAudioUnavailable.
+func NewConcreteAudioStreamWithLatency(bufferSize, channels int, format, latency string) (*ConcreteAudioStream, func(), error) {
+	return nil, nil, ErrAudioUnavailable
+}
+
+// Read returns ErrAudioUnavailable.
+func (cas *ConcreteAudioStream) Read() error {
+	return ErrAudioUnavailable
+}
+
+// Buffer returns the (empty) buffer.
+func (cas *ConcreteAudioStream) Buffer() []float32 {
+	return cas.buffer
+}
+
+// Close does nothing.
+func (cas *ConcreteAudioStream) Close() error {
+	return nil
+}
+
+// Start returns ErrAudioUnavailable.
+func (cas *ConcreteAudioStream) Start() error {
+	return ErrAudioUnavailable
+}
+
+// Stop returns ErrAudioUnavailable.
+func (cas *ConcreteAudioStream) Stop() error {
+	return ErrAudioUnavailable
+}
+
+// DeviceID returns ErrAudioUnavailable.
+func (cas *ConcreteAudioStream) DeviceID() (string, error) {
+	return "", ErrAudioUnavailable
+}
+
+// MalgoAudioStream stands in for the malgo input stream in builds without audio support.
+type MalgoAudioStream struct {
+	buffer []float32
+}
+
+// NewMalgoAudioStream returns ErrAudioUnavailable.
+func NewMalgoAudioStream(bufferSize, channels int, format, latency string) (*MalgoAudioStream, func(), error) {
+	return nil, nil, ErrAudioUnavailable
+}
+
+// Read returns ErrAudioUnavailable.
+func (s *MalgoAudioStream) Read() error {
+	return ErrAudioUnavailable
+}
+
+// Buffer returns the (empty) buffer.
+func (s *MalgoAudioStream) Buffer() []float32 {
+	return s.buffer
+}
+
+// Close does nothing.
+func (s *MalgoAudioStream) Close() error {
+	return nil
+}
+
+// Start returns ErrAudioUnavailable.
+func (s *MalgoAudioStream) Start() error {
+	return ErrAudioUnavailable
+}
+
+// Stop returns ErrAudioUnavailable.
+func (s *MalgoAudioStream) Stop() error {
+	return ErrAudioUnavailable
+}
+
+// DeviceID returns ErrAudioUnavailable.
+func (s *MalgoAudioStream) DeviceID() (string, error) {
+	return "", ErrAudioUnavailable
+}
+
+// ConcreteOutputStream stands in for the PortAudio output stream in builds without audio support.
+type ConcreteOutputStream struct {
+	buffer []float32
+}
+
+// NewConcreteOutputStream returns ErrAudioUnavailable.
+func NewConcreteOutputStream(bufferSize int) (*ConcreteOutputStream, func(), error) {
+	return nil, nil, ErrAudioUnavailable
+}
+
+// Write returns ErrAudioUnavailable.
+func (cos *ConcreteOutputStream) Write() error {
+	return ErrAudioUnavailable
+}
+
+// Buffer returns the (empty) buffer.
+func (cos *ConcreteOutputStream) Buffer() []float32 {
+	return cos.buffer
+}
+
+// Close does nothing.
+func (cos *ConcreteOutputStream) Close() error {
+	return nil
+}
+
+// Start returns ErrAudioUnavailable.
+func (cos *ConcreteOutputStream) Start() error {
+	return ErrAudioUnavailable
+}
+
+// Stop returns ErrAudioUnavailable.
+func (cos *ConcreteOutputStream) Stop() error {
+	return ErrAudioUnavailable
+}
+
+// PortAudioVersion reports that PortAudio is not linked in.
+func PortAudioVersion() string {
+	return "none (built with the noaudio tag)"
+}
+
+// DefaultInputChannels returns ErrAudioUnavailable.
+func DefaultInputChannels() (int, error) {
+	return 0, ErrAudioUnavailable
+}
+
+// ListInputDevices returns ErrAudioUnavailable.
+func ListInputDevices() ([]DeviceInfo, error) {
+	return nil, ErrAudioUnavailable
+}
@@ -0,0 +1,39 @@
+//go:build noaudio
+
+// audio/noaudio_test.go
+
+package audio
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNoAudioStubs(t *testing.T) {
+	if _, _, err := NewConcreteAudioStream(64); !errors.Is(err, ErrAudioUnavailable) {
+		t.Errorf("NewConcreteAudioStream = %v, want ErrAudioUnavailable", err)
+	}
+	for _, backend := range []string{BackendPortAudio, BackendMalgo} {
+		if _, _, err := NewInputStream(backend, 64, 1, CaptureFloat32, LatencyHigh); !errors.Is(err, ErrAudioUnavailable) {
+			t.Errorf("NewInputStream(%s) = %v, want ErrAudioUnavailable", backend, err)
+		}
+	}
+	if _, _, err := NewConcreteOutputStream(64); !errors.Is(err, ErrAudioUnavailable) {
+		t.Errorf("NewConcreteOutputStream = %v, want ErrAudioUnavailable", err)
+	}
+	if _, err := ListInputDevices(); !errors.Is(err, ErrAudioUnavailable) {
+		t.Errorf("ListInputDevices = %v, want ErrAudioUnavailable", err)
+	}
+	if _, err := DefaultInputChannels(); !errors.Is(err, ErrAudioUnavailable) {
+		t.Errorf("DefaultInputChannels = %v, want ErrAudioUnavailable", err)
+	}
+
+	// The stub streams still satisfy AudioStream, and every operation on them fails.
+	for _, stream := range []AudioStream{&ConcreteAudioStream{}, &MalgoAudioStream{}} {
+		for name, op := range map[string]func() error{"Start": stream.Start, "Read": stream.Read, "Stop": stream.Stop} {
+			if err := op(); !errors.Is(err, ErrAudioUnavailable) {
+				t.Errorf("%T.%s = %v, want ErrAudioUnavailable", stream, name, err)
+			}
+		}
+	}
+}
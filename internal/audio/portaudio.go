@@ -0,0 +1,301 @@
+//go:build !noaudio
+
+// audio/portaudio.go
+
+package audio
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// ConcreteAudioStream is a concrete implementation of the AudioStream interface.
+type ConcreteAudioStream struct {
+	stream *portaudio.Stream
+	buffer []float32
+	raw    []int16 // Native int16 samples, converted into buffer after each read; nil for float32 capture
+}
+
+// NewConcreteAudioStream creates a new mono ConcreteAudioStream.
+func NewConcreteAudioStream(bufferSize int) (*ConcreteAudioStream, func(), error) {
+	return NewConcreteAudioStreamWithChannels(bufferSize, 1)
+}
+
+// NewConcreteAudioStreamWithChannels creates a new ConcreteAudioStream recording the given number of channels.
+// The buffer holds bufferSize frames of interleaved samples.
+func NewConcreteAudioStreamWithChannels(bufferSize, channels int) (*ConcreteAudioStream, func(), error) {
+	return NewConcreteAudioStreamWithFormat(bufferSize, channels, CaptureFloat32)
+}
+
+// NewConcreteAudioStreamWithFormat creates a new ConcreteAudioStream recording the given number of channels
+// in the given native capture format. Samples are always converted to float32 in the buffer.
+func NewConcreteAudioStreamWithFormat(bufferSize, channels int, format string) (*ConcreteAudioStream, func(), error) {
+	return NewConcreteAudioStreamWithLatency(bufferSize, channels, format, LatencyHigh)
+}
+
+// NewConcreteAudioStreamWithLatency creates a new ConcreteAudioStream recording the given number of channels
+// in the given native capture format, from the default input device with the suggested latency of the preset
+// (see ResolveLatency).
+func NewConcreteAudioStreamWithLatency(bufferSize, channels int, format, latency string) (*ConcreteAudioStream, func(), error) {
+	if channels < 1 {
+		return nil, nil, fmt.Errorf("invalid channel count: %d", channels)
+	}
+	if err := ValidateCaptureFormat(format); err != nil {
+		return nil, nil, err
+	}
+	if err := ValidateLatency(latency); err != nil {
+		return nil, nil, err
+	}
+
+	// Initialize PortAudio once during the program lifecycle.
+	err := portaudio.Initialize()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error initializing PortAudio: %w", err)
+	}
+
+	// Buffer for incoming audio.
+	input := make([]float32, bufferSize*channels)
+	captureBuffer, raw := captureBuffers(format, input)
+
+	// Open the default input device with the suggested latency of the preset.
+	device, err := portaudio.DefaultInputDevice()
+	if err != nil {
+		portaudio.Terminate()
+		return nil, nil, fmt.Errorf("%w: %w", ErrNoInputDevice, err)
+	}
+	suggested, err := ResolveLatency(latency, device.DefaultLowInputLatency, device.DefaultHighInputLatency)
+	if err != nil {
+		portaudio.Terminate()
+		return nil, nil, err
+	}
+	params := portaudio.StreamParameters{
+		Input:           portaudio.StreamDeviceParameters{Device: device, Channels: channels, Latency: suggested},
+		SampleRate:      sampleRate,
+		FramesPerBuffer: bufferSize,
+	}
+	stream, err := portaudio.OpenStream(params, captureBuffer)
+	if err != nil {
+		portaudio.Terminate() // It's important to terminate after a failed initialization.
+		return nil, nil, fmt.Errorf("error opening default stream: %w", err)
+	}
+
+	// Create a cleanup function.
+	cleanup := func() {
+		err := stream.Close()
+		if err != nil {
+			log.Printf("Error closing the stream: %v", err)
+		}
+		err = portaudio.Terminate()
+		if err != nil {
+			log.Printf("Error terminating PortAudio: %v", err)
+		}
+	}
+
+	return &ConcreteAudioStream{stream: stream, buffer: input, raw: raw}, cleanup, nil
+}
+
+// captureBuffers returns the buffer handed to PortAudio, whose element type selects the native sample format
+// of the stream, and for int16 capture the raw buffer that Read converts into the float32 input buffer.
+func captureBuffers(format string, input []float32) (interface{}, []int16) {
+	if format == CaptureInt16 {
+		raw := make([]int16, len(input))
+		return &raw, raw
+	}
+	return &input, nil
+}
+
+// int16ToFloat32 converts native int16 samples into float32 samples in [-1, 1).
+func int16ToFloat32(dst []float32, src []int16) {
+	for i, sample := range src {
+		dst[i] = float32(sample) / 32768
+	}
+}
+
+// Read from the audio stream into the buffer.
+// Read fills the buffer with audio data. It returns ErrInputOverflowed, with a filled buffer, when input was lost.
+func (cas *ConcreteAudioStream) Read() error {
+	err := cas.stream.Read()
+	if err != nil && err != portaudio.InputOverflowed {
+		return fmt.Errorf("error reading from audio stream: %w", err)
+	}
+	int16ToFloat32(cas.buffer, cas.raw)
+	if err == portaudio.InputOverflowed {
+		return fmt.Errorf("%w: %v", ErrInputOverflowed, err)
+	}
+	return nil
+}
+
+// Buffer returns the buffer filled by Read.
+func (cas *ConcreteAudioStream) Buffer() []float32 {
+	return cas.buffer
+}
+
+// Close the audio stream.
+func (cas *ConcreteAudioStream) Close() error {
+	if cas.stream != nil {
+		err := cas.stream.Close()
+		if err != nil {
+			return fmt.Errorf("failed to close audio stream: %w", err)
+		}
+	}
+	return nil
+}
+
+// Start starts the audio stream, giving up with ErrAudioStartTimeout if the device does not respond.
+func (cas *ConcreteAudioStream) Start() error {
+	return callWithTimeout(cas.stream.Start, streamControlTimeout, ErrAudioStartTimeout)
+}
+
+// Stop stops the audio stream, giving up with ErrAudioStopTimeout if the device does not respond.
+func (cas *ConcreteAudioStream) Stop() error {
+	return callWithTimeout(cas.stream.Stop, streamControlTimeout, ErrAudioStopTimeout)
+}
+
+// DeviceID returns the name and host API of the default input device, which the stream captures from.
+// PortAudio only lists the devices when it is initialized, so a device switched by the system behind the
+// default device may go unnoticed.
+func (cas *ConcreteAudioStream) DeviceID() (string, error) {
+	device, err := portaudio.DefaultInputDevice()
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrNoInputDevice, err)
+	}
+	if device.HostApi == nil {
+		return device.Name, nil
+	}
+	return fmt.Sprintf("%s (%s)", device.Name, device.HostApi.Name), nil
+}
+
+// ConcreteOutputStream is a concrete implementation of the OutputStream interface.
+type ConcreteOutputStream struct {
+	stream *portaudio.Stream
+	buffer []float32
+}
+
+// NewConcreteOutputStream creates a new ConcreteOutputStream on the default output device.
+func NewConcreteOutputStream(bufferSize int) (*ConcreteOutputStream, func(), error) {
+	err := portaudio.Initialize()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error initializing PortAudio: %w", err)
+	}
+
+	// Buffer for outgoing audio.
+	output := make([]float32, bufferSize)
+
+	stream, err := portaudio.OpenDefaultStream(0, 1, sampleRate, bufferSize, &output)
+	if err != nil {
+		portaudio.Terminate()
+		return nil, nil, fmt.Errorf("error opening default output stream: %w", err)
+	}
+
+	// Create a cleanup function.
+	cleanup := func() {
+		err := stream.Close()
+		if err != nil {
+			log.Printf("Error closing the output stream: %v", err)
+		}
+		err = portaudio.Terminate()
+		if err != nil {
+			log.Printf("Error terminating PortAudio: %v", err)
+		}
+	}
+
+	return &ConcreteOutputStream{stream: stream, buffer: output}, cleanup, nil
+}
+
+// Write plays the buffer.
+func (cos *ConcreteOutputStream) Write() error {
+	err := cos.stream.Write()
+	if err != nil {
+		if err != portaudio.OutputUnderflowed {
+			return fmt.Errorf("error writing to audio stream: %w", err)
+		}
+		log.Printf("Output underflow occurred: %v", err)
+	}
+	return nil
+}
+
+// Buffer returns the buffer played by Write.
+func (cos *ConcreteOutputStream) Buffer() []float32 {
+	return cos.buffer
+}
+
+// Close the output stream.
+func (cos *ConcreteOutputStream) Close() error {
+	if cos.stream != nil {
+		err := cos.stream.Close()
+		if err != nil {
+			return fmt.Errorf("failed to close audio stream: %w", err)
+		}
+	}
+	return nil
+}
+
+// Start starts the output stream.
+func (cos *ConcreteOutputStream) Start() error {
+	return cos.stream.Start()
+}
+
+// Stop stops the output stream.
+func (cos *ConcreteOutputStream) Stop() error {
+	return cos.stream.Stop()
+}
+
+// PortAudioVersion returns the version text of the PortAudio library.
+func PortAudioVersion() string {
+	return portaudio.VersionText()
+}
+
+// DefaultInputChannels returns the maximum number of input channels of the default input device.
+func DefaultInputChannels() (int, error) {
+	if err := portaudio.Initialize(); err != nil {
+		return 0, fmt.Errorf("error initializing PortAudio: %w", err)
+	}
+	defer portaudio.Terminate()
+
+	device, err := portaudio.DefaultInputDevice()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrNoInputDevice, err)
+	}
+	return device.MaxInputChannels, nil
+}
+
+// ListInputDevices returns the devices that can be used for recording.
+func ListInputDevices() ([]DeviceInfo, error) {
+	if err := portaudio.Initialize(); err != nil {
+		return nil, fmt.Errorf("error initializing PortAudio: %w", err)
+	}
+	defer portaudio.Terminate()
+
+	devices, err := portaudio.Devices()
+	if err != nil {
+		return nil, fmt.Errorf("error listing devices: %w", err)
+	}
+
+	// The default device is optional, e.g. on headless machines.
+	defaultDevice, err := portaudio.DefaultInputDevice()
+	if err != nil {
+		defaultDevice = nil
+	}
+
+	var inputs []DeviceInfo
+	for index, device := range devices {
+		if device.MaxInputChannels < 1 {
+			continue
+		}
+		info := DeviceInfo{
+			Index:             index,
+			Name:              device.Name,
+			MaxInputChannels:  device.MaxInputChannels,
+			DefaultSampleRate: device.DefaultSampleRate,
+			Default:           device == defaultDevice,
+		}
+		if device.HostApi != nil {
+			info.HostAPI = device.HostApi.Name
+		}
+		inputs = append(inputs, info)
+	}
+
+	return inputs, nil
+}
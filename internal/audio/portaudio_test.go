@@ -0,0 +1,41 @@
+//go:build !noaudio
+
+// audio/portaudio_test.go
+
+package audio
+
+import "testing"
+
+func TestCaptureBuffers(t *testing.T) {
+	input := make([]float32, 8)
+
+	// PortAudio picks the sample format of the stream from the element type of the buffer.
+	buffer, raw := captureBuffers(CaptureFloat32, input)
+	if floats, ok := buffer.(*[]float32); !ok || &(*floats)[0] != &input[0] {
+		t.Errorf("float32 capture buffer = %T, want the input buffer as *[]float32", buffer)
+	}
+	if raw != nil {
+		t.Errorf("float32 capture has a raw buffer of %d samples", len(raw))
+	}
+
+	buffer, raw = captureBuffers(CaptureInt16, input)
+	ints, ok := buffer.(*[]int16)
+	if !ok {
+		t.Fatalf("int16 capture buffer = %T, want *[]int16", buffer)
+	}
+	if len(*ints) != len(input) || len(raw) != len(input) || &(*ints)[0] != &raw[0] {
+		t.Errorf("int16 capture buffer has %d samples and raw buffer %d, want the same %d", len(*ints), len(raw), len(input))
+	}
+}
+
+func TestInt16ToFloat32(t *testing.T) {
+	src := []int16{0, 16384, -16384, 32767, -32768}
+	want := []float32{0, 0.5, -0.5, 32767.0 / 32768, -1}
+	dst := make([]float32, len(src))
+	int16ToFloat32(dst, src)
+	for i := range want {
+		if dst[i] != want[i] {
+			t.Errorf("sample %d = %v, want %v", i, dst[i], want[i])
+		}
+	}
+}
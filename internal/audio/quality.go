@@ -0,0 +1,524 @@
+// audio/quality.go
+
+package audio
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"sort"
+	"time"
+)
+
+const (
+	flatnessFrameSize = 1024 // Number of samples per FFT frame, must be a power of two
+
+	silentRMSThreshold   = 0.001 // RMS below which the signal is considered silent
+	loudRMSThreshold     = 0.05  // RMS above which the signal is considered loud
+	lowFlatnessThreshold = 0.05  // Spectral flatness below which the spectrum is considered tonal
+	lowByteEntropyBits   = 6.0   // Shannon entropy per byte below which the data is considered predictable
+
+	periodicityWindow        = 1 << 14 // Number of samples the periodicity is measured on
+	periodicityMaxLag        = 1024    // Largest lag of the periodicity, enough for the period of 50 Hz hum at 44.1 kHz
+	highPeriodicityThreshold = 0.8     // Periodicity above which the signal is considered periodic
+
+	humFrameSize          = 1 << 14 // Largest number of samples per FFT frame of MainsHumRatio, about 2.7 Hz per bin at 44.1 kHz
+	humMinFrameSize       = 1 << 10 // Smallest frame of MainsHumRatio; shorter buffers return 0
+	humHarmonics          = 5       // Number of multiples of the mains frequency, fundamental included, that count as hum
+	humBandwidth          = 3.0     // Half-width of the band around each harmonic, in Hz, widened to two bins if coarser
+	highHumRatioThreshold = 0.5     // Mains hum ratio above which the hum dominates the signal
+
+	noiseFloorFrameSize  = 1024 // Number of samples per frame of NoiseFloorRMS
+	noiseFloorPercentile = 0.1  // Share of the quietest frames whose RMS is the noise floor
+	lowSNRThreshold      = 1.0  // SNR in dB below which the signal does not rise above its noise floor
+)
+
+// Accepted mains frequencies of MainsHumRatio, in Hz.
+const (
+	Mains50Hz = 50
+	Mains60Hz = 60
+)
+
+// BufferStats are the level statistics of a buffer of samples, see AnalyzeBuffer.
+type BufferStats struct {
+	RMS              float64 // Root mean square of the samples
+	Peak             float64 // Largest absolute sample value
+	DCOffset         float64 // Mean of the samples
+	ZeroCrossingRate float64 // Fraction of consecutive samples whose sign differs, from 0 to 1
+	Min              float64 // Smallest sample value
+	Max              float64 // Largest sample value
+}
+
+// AnalyzeBuffer computes the statistics of the samples in a single pass, so that large buffers are only
+// read once. Zero counts as positive for zero crossings. Empty buffers return all zeros.
+func AnalyzeBuffer(samples []float32) BufferStats {
+	if len(samples) == 0 {
+		return BufferStats{}
+	}
+
+	var sum, sumSquares float64
+	crossings := 0
+	low, high := float64(samples[0]), float64(samples[0])
+	for i, sample := range samples {
+		value := float64(sample)
+		sum += value
+		sumSquares += value * value
+		if value < low {
+			low = value
+		}
+		if value > high {
+			high = value
+		}
+		if i > 0 && (samples[i-1] < 0) != (sample < 0) {
+			crossings++
+		}
+	}
+
+	count := float64(len(samples))
+	stats := BufferStats{
+		RMS:      math.Sqrt(sumSquares / count),
+		Peak:     math.Max(math.Abs(low), math.Abs(high)),
+		DCOffset: sum / count,
+		Min:      low,
+		Max:      high,
+	}
+	if len(samples) > 1 {
+		stats.ZeroCrossingRate = float64(crossings) / float64(len(samples)-1)
+	}
+	return stats
+}
+
+// QualityReport summarizes how suitable a recording is as an entropy source.
+type QualityReport struct {
+	RMS              float64 // Root mean square of the samples, in [0, 1]
+	ShannonEntropy   float64 // Shannon entropy of the hashed bytes, in bits per byte
+	SpectralFlatness float64 // Spectral flatness, from 0 (pure tone) to 1 (white noise)
+	Periodicity      float64 // Peak autocorrelation, from 0 (noise) to 1 (periodic signal), see Periodicity
+	DCOffset         float64 // Mean of the samples
+	MainsHum         float64 // Share of the energy at the mains frequency and its harmonics, see MainsHumRatio
+	NoiseFloor       float64 // RMS of the quietest frames, see NoiseFloorRMS
+	SNR              float64 // Signal-to-noise ratio of the RMS over the noise floor, in dB, see EstimateSNR
+	Warnings         []string
+}
+
+// AnalyzeQualityWithMains computes the quality report of interleaved samples and of the bytes that are hashed,
+// and also measures the mains hum of the downmixed samples at the given sample rate and mains frequency,
+// with a warning when it dominates the signal.
+func AnalyzeQualityWithMains(samples []float32, data []byte, channels, sampleRate int, mainsHz float64) QualityReport {
+	report := AnalyzeQuality(samples, data)
+	report.MainsHum = MainsHumRatio(DownmixToMono(samples, channels), sampleRate, mainsHz)
+	if report.RMS >= silentRMSThreshold && report.MainsHum > highHumRatioThreshold {
+		// Hum is a deterministic waveform picked up from the power lines, and only its noise floor is random.
+		report.Warnings = append(report.Warnings, fmt.Sprintf("the recording is dominated by %g Hz mains hum", mainsHz))
+	}
+	return report
+}
+
+// AnalyzeQuality computes the quality report of the samples and of the bytes that are hashed.
+func AnalyzeQuality(samples []float32, data []byte) QualityReport {
+	stats := AnalyzeBuffer(samples)
+	report := QualityReport{
+		RMS:              stats.RMS,
+		ShannonEntropy:   ShannonEntropy(data),
+		SpectralFlatness: SpectralFlatness(samples),
+		Periodicity:      Periodicity(samples),
+		DCOffset:         stats.DCOffset,
+		NoiseFloor:       NoiseFloorRMS(samples),
+	}
+	report.SNR = EstimateSNR(float32(report.RMS), float32(report.NoiseFloor))
+
+	switch {
+	case report.RMS < silentRMSThreshold:
+		report.Warnings = append(report.Warnings, "the recording is nearly silent")
+	case report.RMS > loudRMSThreshold &&
+		(report.SpectralFlatness < lowFlatnessThreshold || report.ShannonEntropy < lowByteEntropyBits):
+		// A loud but constant sound, such as fan hum or a tone, carries little entropy.
+		report.Warnings = append(report.Warnings, "the recording is loud but predictable (tonal or constant sound)")
+	}
+	if report.RMS >= silentRMSThreshold && report.Periodicity > highPeriodicityThreshold {
+		// Hum or a tone repeats itself, so each period adds little entropy.
+		report.Warnings = append(report.Warnings, "the recording is strongly periodic (hum or tone)")
+	}
+	if report.RMS >= silentRMSThreshold && report.SNR < lowSNRThreshold {
+		// Nothing rises above a constant noise floor, such as the hiss of the microphone.
+		report.Warnings = append(report.Warnings, fmt.Sprintf("the recording barely rises above its noise floor (SNR %.1f dB)", report.SNR))
+	}
+
+	return report
+}
+
+// NoiseFloorRMS estimates the noise floor of the samples as the RMS of their quietest frames of 1024 samples,
+// the tenth of them with the lowest RMS. Buffers shorter than two frames return 0, as they are too short to tell
+// the floor apart from the signal.
+func NoiseFloorRMS(samples []float32) float64 {
+	frames := len(samples) / noiseFloorFrameSize
+	if frames < 2 {
+		return 0
+	}
+
+	levels := make([]float64, frames)
+	for i := range levels {
+		var sumSquares float64
+		for _, sample := range samples[i*noiseFloorFrameSize : (i+1)*noiseFloorFrameSize] {
+			sumSquares += float64(sample) * float64(sample)
+		}
+		levels[i] = sumSquares / noiseFloorFrameSize
+	}
+	sort.Float64s(levels)
+
+	quietest := int(math.Ceil(noiseFloorPercentile * float64(frames)))
+	var sum float64
+	for _, level := range levels[:quietest] {
+		sum += level
+	}
+	return math.Sqrt(sum / float64(quietest))
+}
+
+// EstimateSNR returns the signal-to-noise ratio of a signal RMS over a noise floor RMS (see NoiseFloorRMS),
+// 20·log10(signal/noise) dB: 0 dB when the signal does not rise above the floor. A zero noise floor gives +Inf,
+// or 0 if the signal is silent too.
+func EstimateSNR(signalRMS, noiseFloorRMS float32) float64 {
+	if noiseFloorRMS <= 0 {
+		if signalRMS <= 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return 20 * math.Log10(float64(signalRMS)/float64(noiseFloorRMS))
+}
+
+// AnalysisThresholds are the limits audio must meet to pass Analyze.
+type AnalysisThresholds struct {
+	MinShannonEntropy   float64 // Minimum Shannon entropy of the bytes, in bits per byte
+	MinMinEntropy       float64 // Minimum min-entropy of the bytes, in bits per byte
+	MinSpectralFlatness float64 // Minimum spectral flatness
+	MaxDCOffset         float64 // Maximum absolute mean of the samples
+}
+
+// DefaultAnalysisThresholds are the thresholds used by the quality report warnings.
+var DefaultAnalysisThresholds = AnalysisThresholds{
+	MinShannonEntropy:   lowByteEntropyBits,
+	MinMinEntropy:       3,
+	MinSpectralFlatness: lowFlatnessThreshold,
+	MaxDCOffset:         0.1,
+}
+
+// Analysis is the detailed quality analysis of stored audio, with a pass/fail verdict.
+type Analysis struct {
+	ShannonEntropy   float64 // Shannon entropy of the bytes, in bits per byte
+	MinEntropy       float64 // Min-entropy of the bytes, in bits per byte
+	SpectralFlatness float64 // Spectral flatness, from 0 (pure tone) to 1 (white noise)
+	DCOffset         float64 // Mean of the samples
+	Peak             float64 // Largest absolute sample value
+	Failures         []string
+}
+
+// Passed reports whether the audio met all the thresholds.
+func (a Analysis) Passed() bool {
+	return len(a.Failures) == 0
+}
+
+// Analyze computes the analysis of the samples and of their stored bytes, and checks it against the thresholds.
+func Analyze(samples []float32, data []byte, thresholds AnalysisThresholds) Analysis {
+	stats := AnalyzeBuffer(samples)
+	analysis := Analysis{
+		ShannonEntropy:   ShannonEntropy(data),
+		MinEntropy:       MinEntropy(data),
+		SpectralFlatness: SpectralFlatness(samples),
+		DCOffset:         stats.DCOffset,
+		Peak:             stats.Peak,
+	}
+
+	if analysis.ShannonEntropy < thresholds.MinShannonEntropy {
+		analysis.Failures = append(analysis.Failures, fmt.Sprintf("byte entropy %.2f is below %.2f bits/byte", analysis.ShannonEntropy, thresholds.MinShannonEntropy))
+	}
+	if analysis.MinEntropy < thresholds.MinMinEntropy {
+		analysis.Failures = append(analysis.Failures, fmt.Sprintf("min-entropy %.2f is below %.2f bits/byte", analysis.MinEntropy, thresholds.MinMinEntropy))
+	}
+	if analysis.SpectralFlatness < thresholds.MinSpectralFlatness {
+		analysis.Failures = append(analysis.Failures, fmt.Sprintf("spectral flatness %.3f is below %.3f", analysis.SpectralFlatness, thresholds.MinSpectralFlatness))
+	}
+	if math.Abs(analysis.DCOffset) > thresholds.MaxDCOffset {
+		analysis.Failures = append(analysis.Failures, fmt.Sprintf("DC offset %.4f exceeds %.4f", analysis.DCOffset, thresholds.MaxDCOffset))
+	}
+
+	return analysis
+}
+
+// ShannonEntropy returns the Shannon entropy of the byte distribution of data, in bits per byte.
+func ShannonEntropy(data []byte) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+
+	var counts [256]int
+	for _, b := range data {
+		counts[b]++
+	}
+
+	entropy := 0.0
+	total := float64(len(data))
+	for _, count := range counts {
+		if count == 0 {
+			continue
+		}
+		p := float64(count) / total
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// MinEntropy returns the min-entropy of the byte distribution of data, in bits per byte:
+// the negative log of the probability of the most common byte, a worst case for guessing.
+func MinEntropy(data []byte) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+
+	var counts [256]int
+	maxCount := 0
+	for _, b := range data {
+		counts[b]++
+		if counts[b] > maxCount {
+			maxCount = counts[b]
+		}
+	}
+	return math.Log2(float64(len(data)) / float64(maxCount))
+}
+
+// EntropyPerSample estimates the entropy of the samples in bits per sample, as the min-entropy of the
+// distribution of their 16-bit quantized values. It is bounded by the log of the sample count, so it
+// underestimates the entropy of short buffers of loud noise, which errs on the safe side.
+func EntropyPerSample(samples []float32) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+
+	counts := make(map[int16]int)
+	maxCount := 0
+	for _, sample := range samples {
+		value := int16(math.Max(-1, math.Min(1, float64(sample))) * math.MaxInt16)
+		counts[value]++
+		if counts[value] > maxCount {
+			maxCount = counts[value]
+		}
+	}
+	return math.Log2(float64(len(samples)) / float64(maxCount))
+}
+
+// EstimateTotalEntropy estimates the entropy of the samples in bits, as their entropy per sample
+// (see EntropyPerSample) times their count.
+func EstimateTotalEntropy(samples []float32) float64 {
+	return EntropyPerSample(samples) * float64(len(samples))
+}
+
+// EstimateRequiredDuration estimates how long to record to collect targetBits of entropy, given the entropy
+// per sample measured on a probe (see EntropyPerSample) and the sample rate. Without any entropy per sample,
+// it returns the longest duration.
+func EstimateRequiredDuration(sampleLevel float64, targetBits int, sampleRate int) time.Duration {
+	if sampleLevel <= 0 || sampleRate <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	seconds := float64(targetBits) / (sampleLevel * float64(sampleRate))
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
+
+// DCOffset returns the mean of the samples. Empty buffers return 0.
+func DCOffset(samples []float32) float64 {
+	return AnalyzeBuffer(samples).DCOffset
+}
+
+// RemoveDC returns a copy of interleaved samples with the mean of each channel subtracted from it, removing
+// the DC offset of microphones that biases the low bits of every sample.
+func RemoveDC(interleaved []float32, channels int) []float32 {
+	if channels < 1 {
+		channels = 1
+	}
+	sums := make([]float64, channels)
+	counts := make([]int, channels)
+	for i, sample := range interleaved {
+		sums[i%channels] += float64(sample)
+		counts[i%channels]++
+	}
+
+	removed := make([]float32, len(interleaved))
+	for i, sample := range interleaved {
+		removed[i] = sample - float32(sums[i%channels]/float64(counts[i%channels]))
+	}
+	return removed
+}
+
+// Peak returns the largest absolute value of the samples.
+func Peak(samples []float32) float64 {
+	return AnalyzeBuffer(samples).Peak
+}
+
+// Autocorrelation returns the normalized autocorrelation of the samples at lags 0 to maxLag: the correlation
+// of the samples, minus their mean, with themselves shifted by the lag. Lag 0 is 1 and the other lags range
+// from -1 to 1. Silent or constant buffers return all zeros, and lags beyond the buffer are 0.
+func Autocorrelation(samples []float32, maxLag int) []float64 {
+	if maxLag < 0 {
+		return nil
+	}
+	correlations := make([]float64, maxLag+1)
+	mean := DCOffset(samples)
+
+	var energy float64
+	for _, sample := range samples {
+		deviation := float64(sample) - mean
+		energy += deviation * deviation
+	}
+	if energy == 0 {
+		return correlations
+	}
+
+	for lag := 0; lag <= maxLag && lag < len(samples); lag++ {
+		var sum float64
+		for i := 0; i+lag < len(samples); i++ {
+			sum += (float64(samples[i]) - mean) * (float64(samples[i+lag]) - mean)
+		}
+		correlations[lag] = sum / energy
+	}
+	return correlations
+}
+
+// Periodicity returns the peak autocorrelation of the samples beyond its first zero crossing, measured on at
+// most the first periodicityWindow samples. Neighboring samples of real recordings are always correlated, but
+// only periodic signals, such as hum or tones, correlate again after the autocorrelation first drops to zero:
+// a pure tone gives a value close to 1 at its period, and noise a value close to 0.
+func Periodicity(samples []float32) float64 {
+	if len(samples) > periodicityWindow {
+		samples = samples[:periodicityWindow]
+	}
+	correlations := Autocorrelation(samples, periodicityMaxLag)
+
+	peak := 0.0
+	crossed := false
+	for _, correlation := range correlations[1:] {
+		if !crossed {
+			crossed = correlation <= 0
+			continue
+		}
+		peak = math.Max(peak, correlation)
+	}
+	return peak
+}
+
+// SpectralFlatness returns the ratio of the geometric mean to the arithmetic mean of the power spectrum,
+// averaged over frames of the samples. It is close to 1 for white noise and close to 0 for a pure tone.
+// Buffers shorter than one frame return 0.
+func SpectralFlatness(samples []float32) float64 {
+	numFrames := len(samples) / flatnessFrameSize
+	if numFrames == 0 {
+		return 0
+	}
+
+	// Average the power spectrum over all frames, ignoring the DC bin.
+	power := make([]float64, flatnessFrameSize/2)
+	frame := make([]complex128, flatnessFrameSize)
+	for f := 0; f < numFrames; f++ {
+		for i := range frame {
+			frame[i] = complex(float64(samples[f*flatnessFrameSize+i]), 0)
+		}
+		fft(frame)
+		for k := 1; k <= len(power); k++ {
+			magnitude := cmplx.Abs(frame[k])
+			power[k-1] += magnitude * magnitude / float64(numFrames)
+		}
+	}
+
+	// A tiny floor keeps silent bins from sending the geometric mean to -Inf.
+	const floor = 1e-20
+	var logSum, sum float64
+	for _, p := range power {
+		logSum += math.Log(p + floor)
+		sum += p + floor
+	}
+	geometricMean := math.Exp(logSum / float64(len(power)))
+	arithmeticMean := sum / float64(len(power))
+
+	return geometricMean / arithmeticMean
+}
+
+// MainsHumRatio returns the share of the energy of mono samples that lies within a few hertz of the mains
+// frequency and its first harmonics, from about 0 for broadband noise to 1 for pure hum. The power spectrum is
+// averaged over Hann-windowed frames of up to 16384 samples, ignoring the DC bin. Buffers shorter than 1024
+// samples return 0.
+func MainsHumRatio(samples []float32, sampleRate int, mainsHz float64) float64 {
+	frameSize := humFrameSize
+	for frameSize > len(samples) {
+		frameSize >>= 1
+	}
+	if frameSize < humMinFrameSize || sampleRate <= 0 || mainsHz <= 0 {
+		return 0
+	}
+	numFrames := len(samples) / frameSize
+
+	// Average the power spectrum over all frames.
+	window := make([]float64, frameSize)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(frameSize))
+	}
+	power := make([]float64, frameSize/2+1)
+	frame := make([]complex128, frameSize)
+	for f := 0; f < numFrames; f++ {
+		for i := range frame {
+			frame[i] = complex(float64(samples[f*frameSize+i])*window[i], 0)
+		}
+		fft(frame)
+		for k := range power {
+			magnitude := cmplx.Abs(frame[k])
+			power[k] += magnitude * magnitude
+		}
+	}
+
+	// The window spreads a tone over a few bins, so the bands are at least two bins wide on each side.
+	binWidth := float64(sampleRate) / float64(frameSize)
+	bandwidth := math.Max(humBandwidth, 2*binWidth)
+	var hum, total float64
+	for k := 1; k < len(power); k++ {
+		total += power[k]
+		frequency := float64(k) * binWidth
+		for h := 1; h <= humHarmonics; h++ {
+			if math.Abs(frequency-float64(h)*mainsHz) <= bandwidth {
+				hum += power[k]
+				break
+			}
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return hum / total
+}
+
+// fft computes the discrete Fourier transform of x in place. The length of x must be a power of two.
+func fft(x []complex128) {
+	n := len(x)
+
+	// Reorder the input in bit-reversed order.
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	// Combine the transforms of increasing size.
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				even, odd := x[start+k], w*x[start+k+size/2]
+				x[start+k] = even + odd
+				x[start+k+size/2] = even - odd
+				w *= step
+			}
+		}
+	}
+}
@@ -0,0 +1,313 @@
+// audio/quality_test.go
+
+package audio
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/utils"
+)
+
+// sineWave returns n samples of a sine wave of a frequency and amplitude at 44.1 kHz.
+func sineWave(n int, frequency, amplitude float64) []float32 {
+	samples := make([]float32, n)
+	for i := range samples {
+		samples[i] = float32(amplitude * math.Sin(2*math.Pi*frequency*float64(i)/44100))
+	}
+	return samples
+}
+
+// whiteNoise returns n samples of uniform noise in [-amplitude, amplitude), the same for the same seed.
+func whiteNoise(n int, amplitude float64, seed int64) []float32 {
+	r := rand.New(rand.NewSource(seed))
+	samples := make([]float32, n)
+	for i := range samples {
+		samples[i] = float32(amplitude * (2*r.Float64() - 1))
+	}
+	return samples
+}
+
+// hasWarning reports whether one of the warnings of a report contains substr.
+func hasWarning(report QualityReport, substr string) bool {
+	for _, warning := range report.Warnings {
+		if strings.Contains(warning, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSpectralFlatness(t *testing.T) {
+	sine := SpectralFlatness(sineWave(1<<14, 1000, 0.8))
+	noise := SpectralFlatness(whiteNoise(1<<14, 0.8, 1))
+	if sine >= lowFlatnessThreshold {
+		t.Errorf("flatness of a sine wave = %.3f, want below %.3f", sine, lowFlatnessThreshold)
+	}
+	if noise < 0.5 {
+		t.Errorf("flatness of white noise = %.3f, want above 0.5", noise)
+	}
+	if got := SpectralFlatness(make([]float32, flatnessFrameSize-1)); got != 0 {
+		t.Errorf("flatness of less than a frame = %v, want 0", got)
+	}
+}
+
+func TestAnalyzeQualityLoudButPredictable(t *testing.T) {
+	sine := sineWave(1<<14, 1000, 0.8)
+	if report := AnalyzeQuality(sine, utils.Float32ToByteSlice(sine)); !hasWarning(report, "loud but predictable") {
+		t.Errorf("a loud sine wave gave the warnings %q, want loud but predictable", report.Warnings)
+	}
+	noise := whiteNoise(1<<14, 0.8, 1)
+	if report := AnalyzeQuality(noise, utils.Float32ToByteSlice(noise)); hasWarning(report, "loud but predictable") {
+		t.Errorf("white noise gave the warnings %q", report.Warnings)
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	noise := whiteNoise(1<<14, 0.9, 3)
+	if analysis := Analyze(noise, utils.Float32ToByteSlice(noise), DefaultAnalysisThresholds); !analysis.Passed() {
+		t.Errorf("white noise failed the analysis: %q", analysis.Failures)
+	}
+
+	silence := make([]float32, 1<<14)
+	analysis := Analyze(silence, utils.Float32ToByteSlice(silence), DefaultAnalysisThresholds)
+	if analysis.Passed() {
+		t.Error("silence passed the analysis")
+	}
+	if analysis.ShannonEntropy != 0 || analysis.Peak != 0 {
+		t.Errorf("silence has byte entropy %v and peak %v, want 0", analysis.ShannonEntropy, analysis.Peak)
+	}
+}
+
+func TestEstimateRequiredDuration(t *testing.T) {
+	// 256 bits at 44.1 kHz: 4 bits per sample take 1.45 ms, 0.001 bits per sample 5.8 s.
+	high := EstimateRequiredDuration(4, 256, 44100)
+	low := EstimateRequiredDuration(0.001, 256, 44100)
+	if high >= 2*time.Millisecond || high <= time.Millisecond {
+		t.Errorf("estimate at 4 bits per sample = %v, want about 1.45ms", high)
+	}
+	if low <= 5*time.Second || low >= 6*time.Second {
+		t.Errorf("estimate at 0.001 bits per sample = %v, want about 5.8s", low)
+	}
+	if got := EstimateRequiredDuration(0, 256, 44100); got != time.Duration(math.MaxInt64) {
+		t.Errorf("estimate without entropy = %v, want the longest duration", got)
+	}
+}
+
+func TestAutocorrelation(t *testing.T) {
+	// A 441 Hz sine repeats every 100 samples at 44.1 kHz.
+	sine := sineWave(1<<14, 441, 0.5)
+	correlations := Autocorrelation(sine, 200)
+	if len(correlations) != 201 || math.Abs(correlations[0]-1) > 1e-9 {
+		t.Fatalf("Autocorrelation returned %d lags starting with %v, want 201 starting with 1", len(correlations), correlations[0])
+	}
+	if correlations[100] < 0.95 || correlations[50] > -0.95 {
+		t.Errorf("sine autocorrelation is %.3f at its period and %.3f at half of it, want about 1 and -1", correlations[100], correlations[50])
+	}
+
+	noise := whiteNoise(1<<14, 0.5, 4)
+	for lag, correlation := range Autocorrelation(noise, 200)[1:] {
+		if math.Abs(correlation) > 0.05 {
+			t.Errorf("white noise autocorrelation at lag %d = %.3f, want about 0", lag+1, correlation)
+		}
+	}
+
+	for _, correlation := range Autocorrelation(make([]float32, 100), 10) {
+		if correlation != 0 {
+			t.Fatalf("autocorrelation of silence = %v, want zeros", correlation)
+		}
+	}
+}
+
+func TestPeriodicityWarning(t *testing.T) {
+	sine := sineWave(1<<14, 441, 0.5)
+	if periodicity := Periodicity(sine); periodicity < highPeriodicityThreshold {
+		t.Errorf("periodicity of a sine = %.3f, want above %v", periodicity, highPeriodicityThreshold)
+	}
+	if report := AnalyzeQuality(sine, utils.Float32ToByteSlice(sine)); !hasWarning(report, "periodic") {
+		t.Errorf("a sine wave gave the warnings %q, want strongly periodic", report.Warnings)
+	}
+	noise := whiteNoise(1<<14, 0.5, 5)
+	if periodicity := Periodicity(noise); periodicity > 0.2 {
+		t.Errorf("periodicity of white noise = %.3f, want about 0", periodicity)
+	}
+	if report := AnalyzeQuality(noise, utils.Float32ToByteSlice(noise)); hasWarning(report, "periodic") {
+		t.Errorf("white noise gave the warnings %q", report.Warnings)
+	}
+}
+
+func TestMainsHumRatio(t *testing.T) {
+	// A 60 Hz tone with its third harmonic, as picked up from the power lines.
+	hum := sineWave(1<<15, 60, 0.4)
+	for i, sample := range sineWave(len(hum), 180, 0.1) {
+		hum[i] += sample
+	}
+	if ratio := MainsHumRatio(hum, 44100, Mains60Hz); ratio < 0.9 {
+		t.Errorf("60 Hz hum ratio at 60 Hz = %.3f, want above 0.9", ratio)
+	}
+	if ratio := MainsHumRatio(hum, 44100, Mains50Hz); ratio > highHumRatioThreshold {
+		t.Errorf("60 Hz hum ratio at 50 Hz = %.3f, want below %v", ratio, highHumRatioThreshold)
+	}
+	noise := whiteNoise(1<<15, 0.4, 9)
+	if ratio := MainsHumRatio(noise, 44100, Mains60Hz); ratio > 0.05 {
+		t.Errorf("white noise hum ratio = %.3f, want about 0", ratio)
+	}
+	if ratio := MainsHumRatio(hum[:humMinFrameSize-1], 44100, Mains60Hz); ratio != 0 {
+		t.Errorf("hum ratio of a short buffer = %v, want 0", ratio)
+	}
+
+	if report := AnalyzeQualityWithMains(hum, utils.Float32ToByteSlice(hum), 1, 44100, Mains60Hz); !hasWarning(report, "60 Hz mains hum") {
+		t.Errorf("60 Hz hum gave the warnings %q, want mains hum", report.Warnings)
+	}
+	if report := AnalyzeQualityWithMains(noise, utils.Float32ToByteSlice(noise), 1, 44100, Mains60Hz); hasWarning(report, "mains hum") {
+		t.Errorf("white noise gave the warnings %q", report.Warnings)
+	}
+}
+
+func TestEstimateSNR(t *testing.T) {
+	tests := []struct {
+		signal, noise float32
+		want          float64
+	}{
+		{1, 0.1, 20},
+		{0.5, 0.5, 0},
+		{0.1, 1, -20},
+		{1, 0.001, 60},
+		{0.2, 0, math.Inf(1)}, // No noise floor, e.g. digital silence between sounds
+		{0, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := EstimateSNR(tt.signal, tt.noise); math.Abs(got-tt.want) > 1e-4 && !(math.IsInf(tt.want, 1) && math.IsInf(got, 1)) {
+			t.Errorf("EstimateSNR(%v, %v) = %v dB, want %v dB", tt.signal, tt.noise, got, tt.want)
+		}
+	}
+}
+
+func TestLowSNRWarning(t *testing.T) {
+	// Steady noise has no quieter frames than its average, so it does not rise above its floor.
+	steady := whiteNoise(1<<15, 0.5, 10)
+	if floor := NoiseFloorRMS(steady); math.Abs(floor-0.5/math.Sqrt(3)) > 0.02 {
+		t.Errorf("noise floor of steady noise = %.3f, want its RMS %.3f", floor, 0.5/math.Sqrt(3))
+	}
+	if report := AnalyzeQuality(steady, utils.Float32ToByteSlice(steady)); !hasWarning(report, "noise floor") {
+		t.Errorf("steady noise gave the warnings %q, want a low SNR", report.Warnings)
+	}
+
+	// Loud bursts over a quiet background rise well above the floor.
+	bursts := whiteNoise(1<<15, 0.01, 11)
+	for i, sample := range whiteNoise(1<<15, 0.9, 12) {
+		if i/noiseFloorFrameSize%4 != 0 {
+			bursts[i] = sample
+		}
+	}
+	report := AnalyzeQuality(bursts, utils.Float32ToByteSlice(bursts))
+	if report.SNR < 20 || hasWarning(report, "noise floor") {
+		t.Errorf("bursts over a quiet background have an SNR of %.1f dB and the warnings %q, want above 20 dB", report.SNR, report.Warnings)
+	}
+	if floor := NoiseFloorRMS(make([]float32, noiseFloorFrameSize)); floor != 0 {
+		t.Errorf("noise floor of a single frame = %v, want 0", floor)
+	}
+}
+
+func TestRemoveDC(t *testing.T) {
+	// Stereo noise with a DC offset of 0.2 on the left channel and -0.1 on the right one.
+	noise := whiteNoise(1<<14, 0.5, 6)
+	for i := range noise {
+		noise[i] += []float32{0.2, -0.1}[i%2]
+	}
+	if offset := DCOffset(noise); math.Abs(offset-0.05) > 0.01 {
+		t.Errorf("DC offset of the offset noise = %.4f, want about 0.05", offset)
+	}
+
+	removed := RemoveDC(noise, 2)
+	for channel := 0; channel < 2; channel++ {
+		var sum float64
+		for i := channel; i < len(removed); i += 2 {
+			sum += float64(removed[i])
+		}
+		if mean := sum / float64(len(removed)/2); math.Abs(mean) > 1e-6 {
+			t.Errorf("channel %d mean after RemoveDC = %v, want 0", channel, mean)
+		}
+	}
+	if noise[0] == removed[0] {
+		t.Error("RemoveDC modified the samples in place or removed nothing")
+	}
+}
+
+func TestAnalyzeBuffer(t *testing.T) {
+	// Sum -0.75, sum of squares 1.5625, and sign changes at 3 of the 4 steps (zero counts as positive).
+	stats := AnalyzeBuffer([]float32{0.5, -0.5, 0.25, 0, -1})
+	want := BufferStats{RMS: math.Sqrt(0.3125), Peak: 1, DCOffset: -0.15, ZeroCrossingRate: 0.75, Min: -1, Max: 0.5}
+	got := []float64{stats.RMS, stats.Peak, stats.DCOffset, stats.ZeroCrossingRate, stats.Min, stats.Max}
+	for i, w := range []float64{want.RMS, want.Peak, want.DCOffset, want.ZeroCrossingRate, want.Min, want.Max} {
+		if math.Abs(got[i]-w) > 1e-12 {
+			t.Errorf("AnalyzeBuffer = %+v, want %+v", stats, want)
+			break
+		}
+	}
+	if stats := AnalyzeBuffer(nil); stats != (BufferStats{}) {
+		t.Errorf("AnalyzeBuffer of no samples = %+v, want zeros", stats)
+	}
+	if stats := AnalyzeBuffer([]float32{-0.25}); stats.Peak != 0.25 || stats.ZeroCrossingRate != 0 {
+		t.Errorf("AnalyzeBuffer of a single sample = %+v", stats)
+	}
+
+	// The single pass agrees with a pass per statistic.
+	noise := whiteNoise(4096, 0.5, 8)
+	single, separate := AnalyzeBuffer(noise), separateStats(noise)
+	if math.Abs(single.RMS-separate.RMS) > 1e-12 || math.Abs(single.DCOffset-separate.DCOffset) > 1e-12 ||
+		single.Peak != separate.Peak || single.Min != separate.Min || single.Max != separate.Max ||
+		single.ZeroCrossingRate != separate.ZeroCrossingRate {
+		t.Errorf("AnalyzeBuffer of noise = %+v, want %+v", single, separate)
+	}
+}
+
+// separateStats computes the statistics of AnalyzeBuffer with a pass over the samples for each of them, as the
+// meter, report and analyzers did before, for BenchmarkAnalyzeBuffer.
+func separateStats(samples []float32) BufferStats {
+	var stats BufferStats
+	var sum, sumSquares float64
+	for _, sample := range samples {
+		sum += float64(sample)
+	}
+	for _, sample := range samples {
+		sumSquares += float64(sample) * float64(sample)
+	}
+	stats.Min, stats.Max = math.Inf(1), math.Inf(-1)
+	for _, sample := range samples {
+		stats.Min = math.Min(stats.Min, float64(sample))
+	}
+	for _, sample := range samples {
+		stats.Max = math.Max(stats.Max, float64(sample))
+	}
+	for _, sample := range samples {
+		stats.Peak = math.Max(stats.Peak, math.Abs(float64(sample)))
+	}
+	crossings := 0
+	for i := 1; i < len(samples); i++ {
+		if (samples[i-1] < 0) != (samples[i] < 0) {
+			crossings++
+		}
+	}
+	stats.RMS = math.Sqrt(sumSquares / float64(len(samples)))
+	stats.DCOffset = sum / float64(len(samples))
+	stats.ZeroCrossingRate = float64(crossings) / float64(len(samples)-1)
+	return stats
+}
+
+func BenchmarkAnalyzeBuffer(b *testing.B) {
+	samples := whiteNoise(15*44100, 0.5, 7)
+	b.Run("single-pass", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			AnalyzeBuffer(samples)
+		}
+	})
+	b.Run("separate-passes", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			separateStats(samples)
+		}
+	})
+}
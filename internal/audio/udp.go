@@ -0,0 +1,54 @@
+// audio/udp.go
+
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/utils"
+)
+
+// ErrRemoteStreamTarget indicates a UDP sink address that is not on the loopback interface.
+var ErrRemoteStreamTarget = errors.New("remote stream target")
+
+// UDPSink sends buffers of live samples to a UDP listener, one datagram of 16-bit little-endian PCM per buffer,
+// so that another tool can monitor the input during a recording. Sending is best effort: datagrams that cannot
+// be sent, e.g. because nothing listens, are dropped without interrupting the recording.
+type UDPSink struct {
+	conn   *net.UDPConn
+	format utils.WAVFormat
+}
+
+// NewUDPSink connects a sink to the host:port address, which must resolve to a loopback address unless
+// allowRemote is set. channels is the number of interleaved channels of the buffers.
+func NewUDPSink(address string, channels int, allowRemote bool) (*UDPSink, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving %s: %w", address, err)
+	}
+	if !allowRemote && !addr.IP.IsLoopback() {
+		return nil, fmt.Errorf("%w %s: only loopback addresses are allowed", ErrRemoteStreamTarget, addr)
+	}
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %w", addr, err)
+	}
+	format := utils.WAVFormat{AudioFormat: utils.AudioFormatPCM, SampleRate: sampleRate, NumChannels: channels, BitsPerSample: 16}
+	return &UDPSink{conn: conn, format: format}, nil
+}
+
+// Send sends a buffer of interleaved samples as one datagram.
+func (s *UDPSink) Send(buffer []float32) {
+	data, err := utils.EncodeSamples(buffer, s.format)
+	if err != nil {
+		return
+	}
+	s.conn.Write(data) // Best effort, see UDPSink.
+}
+
+// Close closes the connection of the sink.
+func (s *UDPSink) Close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,77 @@
+// audio/udp_test.go
+
+package audio
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/utils"
+)
+
+func TestUDPSink(t *testing.T) {
+	listener, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skipf("cannot listen on the loopback interface: %v", err)
+	}
+	defer listener.Close()
+	listener.SetReadBuffer(1 << 20)
+
+	sink, err := NewUDPSink(listener.LocalAddr().String(), 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	// A stereo mock recording of 64-sample buffers, each streamed as it is kept.
+	stream := newFakeStream(64, nil)
+	sent := 0
+	opts := RecordOptions{Duration: 20 * time.Millisecond, LoopSleep: 2 * time.Millisecond, Refresh: time.Hour}
+	opts.OnBuffer = func(buffer []float32) {
+		sent++
+		sink.Send(buffer)
+	}
+	recording, err := recordWithTimeout(t, stream, CalculateVolume, opts, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent == 0 || sent*64 != len(recording.Samples) {
+		t.Fatalf("streamed %d buffers of a recording of %d samples, want one per 64 samples", sent, len(recording.Samples))
+	}
+
+	// Each buffer arrives as one datagram of 16-bit PCM, 2 bytes per sample.
+	format := utils.WAVFormat{AudioFormat: utils.AudioFormatPCM, SampleRate: sampleRate, NumChannels: 2, BitsPerSample: 16}
+	datagram := make([]byte, 1024)
+	received := 0
+	for ; received < sent; received++ {
+		listener.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := listener.Read(datagram)
+		if err != nil {
+			t.Fatalf("received %d of %d datagrams: %v", received, sent, err)
+		}
+		if n != 64*2 {
+			t.Fatalf("datagram %d has %d bytes, want %d", received, n, 64*2)
+		}
+		if received == 0 {
+			want, err := utils.EncodeSamples(recording.Samples[:64], format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(datagram[:n]) != string(want) {
+				t.Errorf("first datagram = %x, want the PCM of the first buffer %x", datagram[:n], want)
+			}
+		}
+	}
+	listener.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, err := listener.Read(datagram); err == nil {
+		t.Errorf("received more than the %d datagrams streamed", sent)
+	}
+}
+
+func TestNewUDPSinkRemote(t *testing.T) {
+	if _, err := NewUDPSink("192.0.2.1:9000", 1, false); !errors.Is(err, ErrRemoteStreamTarget) {
+		t.Errorf("NewUDPSink to a remote address = %v, want ErrRemoteStreamTarget", err)
+	}
+}
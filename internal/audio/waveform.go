@@ -0,0 +1,76 @@
+// audio/waveform.go
+
+package audio
+
+import (
+	"math"
+	"strings"
+)
+
+const (
+	// WaveformWidth is the default number of columns of a waveform preview.
+	WaveformWidth = 64
+	// WaveformHeight is the default number of rows of a waveform preview.
+	WaveformHeight = 9
+)
+
+// RenderWaveform draws a compact ASCII preview of mono samples in [-1, 1], width columns by height rows.
+// Each column covers an equal slice of the samples and is filled between their minimum and maximum, so that
+// captured signal stands out from silence. Empty or silent buffers give a flat line across the middle row.
+func RenderWaveform(samples []float32, width, height int) string {
+	if width < 1 || height < 1 {
+		return ""
+	}
+
+	grid := make([][]byte, height)
+	for row := range grid {
+		grid[row] = []byte(strings.Repeat(" ", width))
+	}
+
+	for column := 0; column < width; column++ {
+		low, high := float32(0), float32(0)
+		start := column * len(samples) / width
+		end := (column + 1) * len(samples) / width
+		if end == start && start < len(samples) {
+			// Fewer samples than columns: neighboring columns repeat the same sample.
+			end = start + 1
+		}
+		if end > start {
+			low, high = samples[start], samples[start]
+			for _, sample := range samples[start:end] {
+				if sample < low {
+					low = sample
+				}
+				if sample > high {
+					high = sample
+				}
+			}
+		}
+		for row := waveformRow(high, height); row <= waveformRow(low, height); row++ {
+			grid[row][column] = '#'
+		}
+	}
+
+	lines := make([]string, height)
+	for row := range grid {
+		lines[row] = string(grid[row])
+	}
+	return strings.Join(lines, "\n")
+}
+
+// waveformRow returns the row of a sample value, from 0 for 1 at the top to height-1 for -1 at the bottom.
+// Values outside [-1, 1], and NaN, are clamped.
+func waveformRow(value float32, height int) int {
+	position := (1 - float64(value)) / 2
+	if math.IsNaN(position) {
+		position = 0.5
+	}
+	row := int(math.Round(position * float64(height-1)))
+	if row < 0 {
+		return 0
+	}
+	if row > height-1 {
+		return height - 1
+	}
+	return row
+}
@@ -0,0 +1,60 @@
+// audio/waveform_test.go
+
+package audio
+
+import (
+	"strings"
+	"testing"
+)
+
+// topRows returns the topmost filled row of each column of a rendered waveform, or -1 for empty columns.
+func topRows(waveform string, width int) []int {
+	tops := make([]int, width)
+	for column := range tops {
+		tops[column] = -1
+	}
+	for row, line := range strings.Split(waveform, "\n") {
+		for column := 0; column < width && column < len(line); column++ {
+			if line[column] == '#' && tops[column] < 0 {
+				tops[column] = row
+			}
+		}
+	}
+	return tops
+}
+
+func TestRenderWaveformRamp(t *testing.T) {
+	const width, height = 16, 9
+	ramp := make([]float32, 160)
+	for i := range ramp {
+		ramp[i] = -1 + 2*float32(i)/float32(len(ramp)-1)
+	}
+	waveform := RenderWaveform(ramp, width, height)
+	if lines := strings.Split(waveform, "\n"); len(lines) != height || len(lines[0]) != width {
+		t.Fatalf("waveform is %d lines of %d columns, want %d of %d:\n%s", len(lines), len(lines[0]), height, width, waveform)
+	}
+
+	// Each column of a rising ramp reaches at least as high as the one before, from the bottom to the top row.
+	tops := topRows(waveform, width)
+	for column := 1; column < width; column++ {
+		if tops[column] > tops[column-1] {
+			t.Errorf("column %d reaches row %d, lower than row %d of column %d:\n%s", column, tops[column], tops[column-1], column-1, waveform)
+		}
+	}
+	if tops[0] != height-1 || tops[width-1] != 0 {
+		t.Errorf("ramp goes from row %d to row %d, want %d to 0:\n%s", tops[0], tops[width-1], height-1, waveform)
+	}
+}
+
+func TestRenderWaveformFlat(t *testing.T) {
+	const width, height = 8, 5
+	want := strings.Join([]string{"        ", "        ", "########", "        ", "        "}, "\n")
+	for name, samples := range map[string][]float32{"silent": make([]float32, 100), "empty": nil} {
+		if got := RenderWaveform(samples, width, height); got != want {
+			t.Errorf("%s waveform =\n%s\nwant a flat line across the middle row:\n%s", name, got, want)
+		}
+	}
+	if got := RenderWaveform(make([]float32, 10), 0, height); got != "" {
+		t.Errorf("waveform of zero width = %q, want empty", got)
+	}
+}
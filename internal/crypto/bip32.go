@@ -0,0 +1,110 @@
+// crypto/bip32.go
+
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Accepted networks of DeriveMasterKey and DeriveBIP84Addresses.
+const (
+	NetworkMainnet = "mainnet"
+	NetworkTestnet = "testnet"
+)
+
+// privateKeyVersions maps the networks to the version bytes of their serialized private keys,
+// which make them start with "xprv" on mainnet and "tprv" on testnet.
+var privateKeyVersions = map[string]uint32{
+	NetworkMainnet: 0x0488ADE4,
+	NetworkTestnet: 0x04358394,
+}
+
+// ErrUnknownNetwork indicates a network that DeriveMasterKey and DeriveBIP84Addresses do not support.
+var ErrUnknownNetwork = errors.New("unknown network")
+
+// ErrInvalidMasterKey indicates a seed whose master key is invalid, which BIP-32 says to discard.
+var ErrInvalidMasterKey = errors.New("invalid master key")
+
+// secp256k1Order is the order of the secp256k1 curve, the upper bound of private keys.
+var secp256k1Order, _ = new(big.Int).SetString("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364141", 16)
+
+// ValidateNetwork checks that the network is supported by DeriveMasterKey and DeriveBIP84Addresses.
+func ValidateNetwork(network string) error {
+	if _, ok := privateKeyVersions[network]; !ok {
+		return fmt.Errorf("%w %q: must be %q or %q", ErrUnknownNetwork, network, NetworkMainnet, NetworkTestnet)
+	}
+	return nil
+}
+
+// DeriveMasterKey derives the BIP-32 master private key of a seed (see DeriveSeed) and returns it serialized
+// in Base58Check with the version bytes of the network: an "xprv" key on mainnet, a "tprv" key on testnet.
+func DeriveMasterKey(seed []byte, network string) (string, error) {
+	if err := ValidateNetwork(network); err != nil {
+		return "", err
+	}
+
+	key, chainCode, err := masterKey(seed)
+	if err != nil {
+		return "", err
+	}
+	defer Wipe(key)
+
+	// Version, depth, parent fingerprint and child number, all zero for a master key, chain code, and key.
+	serialized := make([]byte, 0, 78)
+	serialized = binary.BigEndian.AppendUint32(serialized, privateKeyVersions[network])
+	serialized = append(serialized, make([]byte, 1+4+4)...)
+	serialized = append(serialized, chainCode...)
+	serialized = append(serialized, 0)
+	serialized = append(serialized, key...)
+	return base58CheckEncode(serialized), nil
+}
+
+// masterKey returns the BIP-32 master private key and chain code of a seed.
+func masterKey(seed []byte) (key, chainCode []byte, err error) {
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+	key, chainCode = sum[:32], sum[32:]
+	if k := new(big.Int).SetBytes(key); k.Sign() == 0 || k.Cmp(secp256k1Order) >= 0 {
+		Wipe(sum)
+		return nil, nil, ErrInvalidMasterKey
+	}
+	return key, chainCode, nil
+}
+
+// base58Alphabet is the Bitcoin Base58 alphabet.
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// base58CheckEncode encodes data in Base58 after appending the first 4 bytes of its double SHA-256 hash.
+func base58CheckEncode(data []byte) string {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	data = append(append([]byte{}, data...), second[:4]...)
+
+	var encoded []byte
+	value := new(big.Int).SetBytes(data)
+	radix := big.NewInt(int64(len(base58Alphabet)))
+	remainder := new(big.Int)
+	for value.Sign() > 0 {
+		value.DivMod(value, radix, remainder)
+		encoded = append(encoded, base58Alphabet[remainder.Int64()])
+	}
+	// Leading zero bytes are encoded as leading ones.
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		encoded = append(encoded, base58Alphabet[0])
+	}
+
+	for i, j := 0, len(encoded)-1; i < j; i, j = i+1, j-1 {
+		encoded[i], encoded[j] = encoded[j], encoded[i]
+	}
+	return string(encoded)
+}
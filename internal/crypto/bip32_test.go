@@ -0,0 +1,40 @@
+// crypto/bip32_test.go
+
+package crypto
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDeriveMasterKey(t *testing.T) {
+	vector1, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	abandon := DeriveSeed("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "")
+	tests := []struct {
+		name    string
+		seed    []byte
+		network string
+		want    string
+	}{
+		// The master key of BIP-32 test vector 1.
+		{"vector 1", vector1, NetworkMainnet, "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"},
+		{"vector 1", vector1, NetworkTestnet, "tprv8ZgxMBicQKsPeDgjzdC36fs6bMjGApWDNLR9erAXMs5skhMv36j9MV5ecvfavji5khqjWaWSFhN3YcCUUdiKH6isR4Pwy3U5y5egddBr16m"},
+		{"abandon", abandon, NetworkMainnet, "xprv9s21ZrQH143K3GJpoapnV8SFfukcVBSfeCficPSGfubmSFDxo1kuHnLisriDvSnRRuL2Qrg5ggqHKNVpxR86QEC8w35uxmGoggxtQTPvfUu"},
+		{"abandon", abandon, NetworkTestnet, "tprv8ZgxMBicQKsPe5YMU9gHen4Ez3ApihUfykaqUorj9t6FDqy3nP6eoXiAo2ssvpAjoLroQxHqr3R5nE3a5dU3DHTjTgJDd7zrbniJr6nrCzd"},
+	}
+	for _, tt := range tests {
+		got, err := DeriveMasterKey(tt.seed, tt.network)
+		if err != nil || got != tt.want {
+			t.Errorf("%s %s master key = %s (%v), want %s", tt.name, tt.network, got, err, tt.want)
+		}
+		if prefix := map[string]string{NetworkMainnet: "xprv", NetworkTestnet: "tprv"}[tt.network]; !strings.HasPrefix(got, prefix) {
+			t.Errorf("%s %s master key %s does not start with %s", tt.name, tt.network, got, prefix)
+		}
+	}
+
+	if _, err := DeriveMasterKey(vector1, "regtest"); !errors.Is(err, ErrUnknownNetwork) {
+		t.Errorf("DeriveMasterKey on an unknown network = %v, want ErrUnknownNetwork", err)
+	}
+}
@@ -0,0 +1,151 @@
+// crypto/bip84.go
+
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// MaxAddresses is the largest number of addresses DeriveBIP84Addresses derives at once.
+const MaxAddresses = 100
+
+// hardened is the offset of the hardened BIP-32 child numbers, written with an apostrophe in paths.
+const hardened = 0x80000000
+
+// addressPrefixes maps the networks to the human-readable part of their bech32 addresses.
+var addressPrefixes = map[string]string{
+	NetworkMainnet: "bc",
+	NetworkTestnet: "tb",
+}
+
+// coinTypes maps the networks to their BIP-44 coin type.
+var coinTypes = map[string]uint32{
+	NetworkMainnet: 0,
+	NetworkTestnet: 1,
+}
+
+// ErrInvalidChildKey indicates a child number whose key is invalid, which BIP-32 says to skip.
+var ErrInvalidChildKey = errors.New("invalid child key")
+
+// BIP84Path returns the derivation path of the receive address of a network at an index: m/84'/0'/0'/0/index
+// on mainnet and m/84'/1'/0'/0/index on testnet.
+func BIP84Path(network string, index int) string {
+	return fmt.Sprintf("m/84'/%d'/0'/0/%d", coinTypes[network], index)
+}
+
+// DeriveBIP84Addresses derives the first count BIP-84 receive addresses of a seed (see DeriveSeed), the native
+// segwit (P2WPKH) addresses of the first account that wallets show: "bc1" addresses on mainnet, "tb1" addresses
+// on testnet. The secp256k1 arithmetic is that of btcec, and the addresses are encoded by btcutil's bech32.
+func DeriveBIP84Addresses(seed []byte, network string, count int) ([]string, error) {
+	if err := ValidateNetwork(network); err != nil {
+		return nil, err
+	}
+	if count < 0 || count > MaxAddresses {
+		return nil, fmt.Errorf("invalid address count %d: must be between 0 and %d", count, MaxAddresses)
+	}
+
+	key, chainCode, err := masterKey(seed)
+	if err != nil {
+		return nil, err
+	}
+	// The closure wipes the key of the last level, as key is replaced at each level below.
+	defer func() {
+		Wipe(key)
+		Wipe(chainCode)
+	}()
+	// The external chain of the first account, m/84'/coin'/0'/0.
+	for _, index := range []uint32{hardened + 84, hardened + coinTypes[network], hardened, 0} {
+		childKey, childChainCode, err := deriveChildKey(key, chainCode, index)
+		if err != nil {
+			return nil, err
+		}
+		Wipe(key)
+		Wipe(chainCode)
+		key, chainCode = childKey, childChainCode
+	}
+
+	addresses := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		childKey, _, err := deriveChildKey(key, chainCode, uint32(i))
+		if err != nil {
+			return nil, fmt.Errorf("%w at %s", err, BIP84Path(network, i))
+		}
+		address, err := segwitAddress(addressPrefixes[network], hash160(publicKey(childKey)))
+		Wipe(childKey)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, nil
+}
+
+// deriveChildKey derives the BIP-32 child private key and chain code of a private key at a child number, which
+// is hardened from the hardened offset on.
+func deriveChildKey(key, chainCode []byte, index uint32) (childKey, childChainCode []byte, err error) {
+	data := make([]byte, 0, 33+4)
+	if index >= hardened {
+		data = append(append(data, 0), key...)
+	} else {
+		data = append(data, publicKey(key)...)
+	}
+	data = binary.BigEndian.AppendUint32(data, index)
+	mac := hmac.New(sha512.New, chainCode)
+	mac.Write(data)
+	Wipe(data)
+	sum := mac.Sum(nil)
+	defer Wipe(sum)
+
+	// The child key is the first half of the HMAC added to the key, modulo the curve order.
+	var tweak, k btcec.ModNScalar
+	defer tweak.Zero()
+	defer k.Zero()
+	if overflow := tweak.SetByteSlice(sum[:32]); overflow {
+		return nil, nil, ErrInvalidChildKey
+	}
+	k.SetByteSlice(key)
+	if k.Add(&tweak).IsZero() {
+		return nil, nil, ErrInvalidChildKey
+	}
+	childKey = make([]byte, 32)
+	k.PutBytesUnchecked(childKey)
+	return childKey, append([]byte{}, sum[32:]...), nil
+}
+
+// publicKey returns the compressed secp256k1 public key of a private key: a parity byte and the x coordinate.
+func publicKey(key []byte) []byte {
+	privateKey, pub := btcec.PrivKeyFromBytes(key)
+	defer privateKey.Zero()
+	return pub.SerializeCompressed()
+}
+
+// hash160 returns the RIPEMD-160 hash of the SHA-256 hash of data, the hash of Bitcoin addresses.
+func hash160(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	h := ripemd160.New()
+	h.Write(sum[:])
+	return h.Sum(nil)
+}
+
+// segwitAddress encodes a witness version 0 program as a bech32 address (BIP-173) with a human-readable part.
+func segwitAddress(prefix string, program []byte) (string, error) {
+	// The witness version, then the program regrouped from 8-bit bytes into 5-bit groups.
+	data, err := bech32.ConvertBits(program, 8, 5, true)
+	if err != nil {
+		return "", fmt.Errorf("error encoding address: %w", err)
+	}
+	address, err := bech32.Encode(prefix, append([]byte{0}, data...))
+	if err != nil {
+		return "", fmt.Errorf("error encoding address: %w", err)
+	}
+	return address, nil
+}
@@ -0,0 +1,66 @@
+// crypto/bip84_test.go
+
+package crypto
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func TestDeriveBIP84Addresses(t *testing.T) {
+	// The test vectors of BIP-84, for the mnemonic of 128 zero bits and an empty passphrase.
+	seed := DeriveSeed("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "")
+	tests := []struct {
+		network string
+		count   int
+		want    []string
+	}{
+		{NetworkMainnet, 2, []string{"bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu", "bc1qnjg0jd8228aq7egyzacy8cys3knf9xvrerkf9g"}},
+		{NetworkTestnet, 1, []string{"tb1q6rz28mcfaxtmd6v789l9rrlrusdprr9pqcpvkl"}},
+		{NetworkMainnet, 0, []string{}},
+	}
+	for _, tt := range tests {
+		got, err := DeriveBIP84Addresses(seed, tt.network, tt.count)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("DeriveBIP84Addresses(%s, %d) = %q, want %q", tt.network, tt.count, got, tt.want)
+		}
+	}
+
+	if _, err := DeriveBIP84Addresses(seed, "regtest", 1); err == nil {
+		t.Error("DeriveBIP84Addresses on an unknown network succeeded")
+	}
+	for _, count := range []int{-1, MaxAddresses + 1} {
+		if _, err := DeriveBIP84Addresses(seed, NetworkMainnet, count); err == nil {
+			t.Errorf("DeriveBIP84Addresses of %d addresses succeeded", count)
+		}
+	}
+	if !reflect.DeepEqual(seed, DeriveSeed("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "")) {
+		t.Error("DeriveBIP84Addresses modified the seed")
+	}
+}
+
+func TestBIP84Path(t *testing.T) {
+	if got := BIP84Path(NetworkMainnet, 3); got != "m/84'/0'/0'/0/3" {
+		t.Errorf("BIP84Path(mainnet, 3) = %s", got)
+	}
+	if got := BIP84Path(NetworkTestnet, 0); got != "m/84'/1'/0'/0/0" {
+		t.Errorf("BIP84Path(testnet, 0) = %s", got)
+	}
+}
+
+func TestSegwitAddress(t *testing.T) {
+	// The P2WPKH example of BIP-173, the address of the public key of the private key 1.
+	key := make([]byte, 32)
+	key[31] = 1
+	pub := publicKey(key)
+	if want := "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"; hex.EncodeToString(pub) != want {
+		t.Fatalf("public key of 1 = %x, want %s", pub, want)
+	}
+	if got, err := segwitAddress("bc", hash160(pub)); err != nil || got != "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4" {
+		t.Errorf("segwitAddress = %s (%v), want bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", got, err)
+	}
+}
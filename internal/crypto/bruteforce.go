@@ -0,0 +1,34 @@
+// crypto/bruteforce.go
+
+package crypto
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	bruteForceGuessesPerSecond = 1e12 // Generous guess rate of a large attacker, far above a single machine
+	secondsPerYear             = 365.25 * 24 * 3600
+
+	// infeasibleYears is the expected search time above which BruteForceEstimate reports a search as infeasible,
+	// about the age of the universe.
+	infeasibleYears = 1.4e10
+)
+
+// BruteForceEstimate describes the search space of a secret with the given bits of entropy and the expected
+// time to find it by trying half of that space at 10^12 guesses per second, e.g.
+// "Search space: 2^128, about 5e+18 years at 10^12 guesses per second, infeasible.".
+// The estimate assumes the entropy is uniform and ignores attacks on how it was produced.
+func BruteForceEstimate(bits int) string {
+	years := math.Ldexp(1, bits-1) / bruteForceGuessesPerSecond / secondsPerYear
+	duration := fmt.Sprintf("about %.0e years", years)
+	if years < 1 {
+		duration = "under a year"
+	}
+	verdict := "feasible for a determined attacker"
+	if years >= infeasibleYears {
+		verdict = "infeasible"
+	}
+	return fmt.Sprintf("Search space: 2^%d, %s at 10^12 guesses per second, %s.", bits, duration, verdict)
+}
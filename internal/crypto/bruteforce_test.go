@@ -0,0 +1,22 @@
+// crypto/bruteforce_test.go
+
+package crypto
+
+import "testing"
+
+func TestBruteForceEstimate(t *testing.T) {
+	tests := []struct {
+		bits int
+		want string
+	}{
+		// 2^127 guesses at 10^12 per second take about 5.4e18 years, and 2^255 guesses about 1.8e57 years.
+		{128, "Search space: 2^128, about 5e+18 years at 10^12 guesses per second, infeasible."},
+		{256, "Search space: 2^256, about 2e+57 years at 10^12 guesses per second, infeasible."},
+		{40, "Search space: 2^40, under a year at 10^12 guesses per second, feasible for a determined attacker."},
+	}
+	for _, tt := range tests {
+		if got := BruteForceEstimate(tt.bits); got != tt.want {
+			t.Errorf("BruteForceEstimate(%d) = %q, want %q", tt.bits, got, tt.want)
+		}
+	}
+}
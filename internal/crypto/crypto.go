@@ -3,33 +3,203 @@
 package crypto
 
 import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
 	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/tyler-smith/go-bip39"
 	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
 )
 
 const (
 	keySize = 32 // 256 bits
+
+	// SchemeVersion is the current version of the mixing and derivation scheme.
+	// Bump it whenever a change would make the same inputs produce a different mnemonic.
+	SchemeVersion = 1
+)
+
+// ErrUnsupportedScheme indicates a scheme version this package does not implement.
+var ErrUnsupportedScheme = errors.New("unsupported scheme version")
+
+// SchemeTag returns the domain-separation tag of a scheme version, e.g. "aeb/v1".
+// Version 0 is the legacy scheme without a tag and returns nil.
+func SchemeTag(version int) []byte {
+	if version == 0 {
+		return nil
+	}
+	return []byte(fmt.Sprintf("aeb/v%d", version))
+}
+
+// PersonalizeTag appends an application personalization to a scheme tag, so that the same inputs produce
+// different outputs for different applications, e.g. "aeb/v1/personalize:my-app\x00". The personalization is
+// NUL-terminated to keep it apart from the data that follows it, and must not contain NUL itself.
+// An empty personalization returns the tag unchanged.
+func PersonalizeTag(tag []byte, personalization string) []byte {
+	if personalization == "" {
+		return tag
+	}
+	personalized := append([]byte{}, tag...)
+	personalized = append(personalized, "/personalize:"...)
+	personalized = append(personalized, personalization...)
+	return append(personalized, 0)
+}
+
+// ValidateSchemeVersion checks that the version is implemented.
+func ValidateSchemeVersion(version int) error {
+	if version < 0 || version > SchemeVersion {
+		return fmt.Errorf("%w: %d (supported: 0 to %d)", ErrUnsupportedScheme, version, SchemeVersion)
+	}
+	return nil
+}
+
+const (
+	// DefaultEntropyRetries is the number of times GenerateEntropy retries a failed read of the system RNG.
+	DefaultEntropyRetries = 3
+
+	entropyRetryBackoff = 10 * time.Millisecond // Wait before the first retry, doubled after each one
 )
 
-// GenerateEntropy uses the bip39 package to generate cryptographic entropy of a specified size.
+// ErrEntropyUnavailable indicates that the random number generator kept failing after all retries.
+var ErrEntropyUnavailable = errors.New("entropy unavailable")
+
+// GenerateEntropy generates cryptographic entropy of a specified size from the system RNG,
+// retrying transient failures DefaultEntropyRetries times.
 func GenerateEntropy(bitSize int) ([]byte, error) {
-	entropy, err := bip39.NewEntropy(bitSize)
-	if err != nil {
+	return GenerateEntropyFrom(rand.Reader, bitSize, DefaultEntropyRetries)
+}
+
+// GenerateEntropyFrom reads bitSize bits of BIP-39 entropy (128 to 256, a multiple of 32) from r.
+// A failed or short read is retried up to retries times, waiting 10 ms before the first retry and
+// twice as long before each next one, and returns ErrEntropyUnavailable once the retries run out.
+func GenerateEntropyFrom(r io.Reader, bitSize, retries int) ([]byte, error) {
+	if bitSize%32 != 0 || bitSize < 128 || bitSize > 256 {
+		return nil, fmt.Errorf("entropy generation error: %w", bip39.ErrEntropyLengthInvalid)
+	}
+	entropy := make([]byte, bitSize/8)
+	backoff := entropyRetryBackoff
+	for attempt := 0; ; attempt++ {
+		_, err := io.ReadFull(r, entropy)
+		if err == nil {
+			return entropy, nil
+		}
+		if attempt >= retries {
+			return nil, fmt.Errorf("%w: %d attempts failed, last error: %v", ErrEntropyUnavailable, attempt+1, err)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// ErrMemoryLock indicates that a secret could not be locked into RAM, see LockMemory.
+var ErrMemoryLock = errors.New("cannot lock memory")
+
+// Wipe overwrites b with zeros, to clear a secret from memory once it is no longer needed.
+func Wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// RandomBytes returns n bytes from the system random number generator.
+func RandomBytes(n int) ([]byte, error) {
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
 		return nil, fmt.Errorf("entropy generation error: %w", err)
 	}
-	return entropy, nil
+	return data, nil
+}
+
+const (
+	entropyCheckSize    = 32              // Bytes read per sample by the entropy source check
+	entropyCheckTimeout = 2 * time.Second // Time after which a read is considered blocked
+)
+
+// ErrWeakSystemEntropy indicates that the system random number generator looks broken or unseeded.
+var ErrWeakSystemEntropy = errors.New("weak system entropy")
+
+// CheckSystemEntropy runs CheckEntropySource on the system random number generator.
+func CheckSystemEntropy() error {
+	return CheckEntropySource(rand.Reader)
+}
+
+// CheckEntropySource is a sanity check of a random source: two reads must complete without blocking,
+// succeed, and return distinct, non-constant outputs. It cannot prove the source is good,
+// but it catches sources that are blocked, failing, or stuck.
+func CheckEntropySource(r io.Reader) error {
+	type result struct {
+		first, second []byte
+		err           error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		var res result
+		res.first = make([]byte, entropyCheckSize)
+		res.second = make([]byte, entropyCheckSize)
+		if _, res.err = io.ReadFull(r, res.first); res.err == nil {
+			_, res.err = io.ReadFull(r, res.second)
+		}
+		done <- res
+	}()
+
+	var res result
+	select {
+	case res = <-done:
+	case <-time.After(entropyCheckTimeout):
+		return fmt.Errorf("%w: read blocked for more than %v", ErrWeakSystemEntropy, entropyCheckTimeout)
+	}
+
+	if res.err != nil {
+		return fmt.Errorf("%w: %v", ErrWeakSystemEntropy, res.err)
+	}
+	if bytes.Equal(res.first, res.second) {
+		return fmt.Errorf("%w: two reads returned identical output", ErrWeakSystemEntropy)
+	}
+	if bytes.Count(res.first, res.first[:1]) == len(res.first) {
+		return fmt.Errorf("%w: read returned constant bytes", ErrWeakSystemEntropy)
+	}
+
+	return nil
 }
 
+// ErrShortKeyDerivation indicates that the key derivation function could not fill the whole key.
+var ErrShortKeyDerivation = errors.New("short key derivation")
+
 // DeriveKey uses the HKDF to derive a key from the entropy.
 func DeriveKey(entropy []byte) ([]byte, error) {
+	return DeriveKeyWithParams(entropy, nil, nil)
+}
+
+// DeriveKeyWithParams uses the HKDF to derive a key from the entropy with an optional salt and info.
+// A nil salt and info give the same key as DeriveKey.
+func DeriveKeyWithParams(entropy, salt, info []byte) ([]byte, error) {
 	// Create a new HKDF reader.
-	hkdfReader := hkdf.New(sha256.New, entropy, nil, nil)
+	hkdfReader := hkdf.New(sha256.New, entropy, salt, info)
 
+	return readKey(hkdfReader)
+}
+
+// readKey reads a whole key from r, which may return fewer bytes per Read than requested.
+func readKey(r io.Reader) ([]byte, error) {
 	key := make([]byte, keySize)
-	if _, err := hkdfReader.Read(key); err != nil {
+	if n, err := io.ReadFull(r, key); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("%w: read %d of %d bytes", ErrShortKeyDerivation, n, keySize)
+		}
 		return nil, fmt.Errorf("HKDF read error: %w", err)
 	}
 	return key, nil
@@ -44,13 +214,453 @@ func GenerateMnemonic(inputData []byte) (string, error) {
 	return mnemonic, nil
 }
 
+// Accepted modes of GenerateMnemonicBits.
+const (
+	// TruncateModeTruncate keeps the leading bytes of the input data.
+	TruncateModeTruncate = "truncate"
+	// TruncateModeHKDF expands the whole input data with HKDF-Expand into exactly the needed bytes.
+	TruncateModeHKDF = "hkdf"
+)
+
+// truncateInfo is the HKDF info of TruncateModeHKDF, which separates its output from the other derived keys.
+var truncateInfo = []byte("aeb/bip39-entropy")
+
+// ErrUnknownTruncateMode indicates a truncation mode that GenerateMnemonicBits does not support.
+var ErrUnknownTruncateMode = errors.New("unknown truncate mode")
+
+// ValidateTruncateMode checks that the mode is supported by GenerateMnemonicBits.
+func ValidateTruncateMode(mode string) error {
+	if mode != TruncateModeTruncate && mode != TruncateModeHKDF {
+		return fmt.Errorf("%w %q: must be %q or %q", ErrUnknownTruncateMode, mode, TruncateModeTruncate, TruncateModeHKDF)
+	}
+	return nil
+}
+
+// GenerateMnemonicBits creates a mnemonic of bits of entropy, a multiple of 32 from 128 to 256, from larger
+// input data. The truncate mode keeps the leading bytes of the data and discards the others, while the hkdf
+// mode uses the data as an HKDF pseudorandom key, so that every input bit affects the mnemonic. At 256 bits,
+// the truncate mode gives the same mnemonic as GenerateMnemonic.
+func GenerateMnemonicBits(inputData []byte, bits int, mode string) (string, error) {
+	if err := ValidateTruncateMode(mode); err != nil {
+		return "", err
+	}
+	size := bits / 8
+	if len(inputData) < size {
+		return "", fmt.Errorf("need at least %d bits of input data, got %d", bits, len(inputData)*8)
+	}
+
+	entropy := inputData[:size]
+	if mode == TruncateModeHKDF {
+		entropy = make([]byte, size)
+		if n, err := io.ReadFull(hkdf.Expand(sha256.New, inputData, truncateInfo), entropy); err != nil {
+			return "", fmt.Errorf("%w: read %d of %d bytes", ErrShortKeyDerivation, n, size)
+		}
+	}
+	return GenerateMnemonic(entropy)
+}
+
+// GenerateMnemonics derives count independent BIP-39 mnemonics from the input data (see GenerateMnemonicsWithScheme).
+func GenerateMnemonics(inputData []byte, count int) ([]string, error) {
+	return GenerateMnemonicsWithScheme(BIP39Scheme{}, inputData, count)
+}
+
+// GenerateMnemonicsWithScheme derives count independent mnemonics of the scheme from the input data, each from
+// a key derived with HKDF and its own info label ("mnemonic/0", "mnemonic/1", ...). The same input always yields
+// the same list.
+func GenerateMnemonicsWithScheme(scheme MnemonicScheme, inputData []byte, count int) ([]string, error) {
+	mnemonics := make([]string, count)
+	for i := range mnemonics {
+		key, err := DeriveKeyWithParams(inputData, nil, []byte(fmt.Sprintf("mnemonic/%d", i)))
+		if err != nil {
+			return nil, err
+		}
+		if mnemonics[i], err = scheme.Generate(key); err != nil {
+			return nil, err
+		}
+	}
+	return mnemonics, nil
+}
+
+// ErrInvalidMnemonic indicates that a mnemonic is not a valid BIP-39 phrase.
+var ErrInvalidMnemonic = errors.New("invalid mnemonic")
+
+// ValidateMnemonic checks that the mnemonic is a valid BIP-39 phrase, including its checksum.
+func ValidateMnemonic(mnemonic string) error {
+	if !bip39.IsMnemonicValid(mnemonic) {
+		return ErrInvalidMnemonic
+	}
+	return nil
+}
+
+// MnemonicWordIndices returns the 0-based wordlist index of every word of a valid mnemonic.
+func MnemonicWordIndices(mnemonic string) ([]int, error) {
+	if err := ValidateMnemonic(mnemonic); err != nil {
+		return nil, err
+	}
+
+	words := strings.Fields(mnemonic)
+	indices := make([]int, len(words))
+	for i, word := range words {
+		index, ok := bip39.GetWordIndex(word)
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown word %q", ErrInvalidMnemonic, word)
+		}
+		indices[i] = index
+	}
+	return indices, nil
+}
+
+// verificationWordTag domain-separates the hash of VerificationWord.
+var verificationWordTag = []byte("aeb/verification-word")
+
+// VerificationWord returns a word of the English wordlist derived from the SHA-256 hash of the phrase, to check
+// a handwritten copy: a copy with any word altered, missing or swapped gives a different word in about 2047 cases
+// out of 2048. It works for any phrase of wordlist words, such as BIP-39 mnemonics and Electrum seeds; unknown
+// words return ErrInvalidMnemonic.
+func VerificationWord(mnemonic string) (string, error) {
+	words := strings.Fields(mnemonic)
+	if len(words) == 0 {
+		return "", fmt.Errorf("%w: no words", ErrInvalidMnemonic)
+	}
+	for _, word := range words {
+		if _, ok := bip39.GetWordIndex(word); !ok {
+			return "", fmt.Errorf("%w: unknown word %q", ErrInvalidMnemonic, word)
+		}
+	}
+
+	hash := sha256.New()
+	hash.Write(verificationWordTag)
+	hash.Write([]byte(strings.Join(words, " ")))
+	sum := hash.Sum(nil)
+
+	// The first 11 bits of the hash select the word.
+	index := binary.BigEndian.Uint16(sum) >> 5
+	return bip39.GetWordList()[index], nil
+}
+
+// MnemonicChecksum recomputes the BIP-39 checksum of a mnemonic from the entropy encoded by its words, and
+// returns it with the checksum bits embedded in the last word, which differ if a word is wrong.
+// Unknown words or an invalid word count return ErrInvalidMnemonic.
+func MnemonicChecksum(mnemonic string) (expected, actual string, err error) {
+	words := strings.Fields(mnemonic)
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return "", "", fmt.Errorf("%w: %d words", ErrInvalidMnemonic, len(words))
+	}
+
+	// Concatenate the 11-bit wordlist indices.
+	var bits strings.Builder
+	for _, word := range words {
+		index, found := bip39.GetWordIndex(word)
+		if !found {
+			return "", "", fmt.Errorf("%w: unknown word %q", ErrInvalidMnemonic, word)
+		}
+		fmt.Fprintf(&bits, "%011b", index)
+	}
+
+	// The checksum takes the last bit per 32 bits of entropy.
+	checksumLength := len(words) * 11 / 33
+	entropyBits := bits.String()[:bits.Len()-checksumLength]
+	entropy := make([]byte, len(entropyBits)/8)
+	for i := range entropy {
+		for _, bit := range entropyBits[i*8 : i*8+8] {
+			entropy[i] = entropy[i]<<1 | byte(bit-'0')
+		}
+	}
+
+	hash := sha256.Sum256(entropy)
+	expected = fmt.Sprintf("%08b", hash[0])[:checksumLength]
+	return expected, bits.String()[len(entropyBits):], nil
+}
+
+// MnemonicEntropy returns the entropy a BIP-39 mnemonic encodes, which is exactly the input GenerateMnemonic
+// was given, so that the mnemonic can be cross-checked with other implementations.
+func MnemonicEntropy(mnemonic string) ([]byte, error) {
+	entropy, err := bip39.EntropyFromMnemonic(mnemonic)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMnemonic, err)
+	}
+	return entropy, nil
+}
+
+// MnemonicToSeedQRDigits encodes a mnemonic in the Standard SeedQR numeric format used by SeedSigner:
+// the 4-digit, zero-padded wordlist index of every word, concatenated.
+func MnemonicToSeedQRDigits(mnemonic string) (string, error) {
+	indices, err := MnemonicWordIndices(mnemonic)
+	if err != nil {
+		return "", err
+	}
+
+	var digits strings.Builder
+	for _, index := range indices {
+		fmt.Fprintf(&digits, "%04d", index)
+	}
+	return digits.String(), nil
+}
+
+// DeriveSeed returns the 64-byte BIP-39 seed of a mnemonic and passphrase, from which BIP-32 wallets derive
+// their keys.
+func DeriveSeed(mnemonic, passphrase string) []byte {
+	return bip39.NewSeed(mnemonic, passphrase)
+}
+
+// seedFileMagic starts every seed file, followed by the version of its format.
+var seedFileMagic = []byte("AEBS")
+
+const (
+	seedFileVersion = 1
+	seedSize        = 64
+)
+
+// ErrInvalidSeedFile indicates a seed file of an unknown format or version, or of the wrong size.
+var ErrInvalidSeedFile = errors.New("invalid seed file")
+
+// EncodeSeedFile encodes a BIP-39 seed in the seed file format: the magic "AEBS", a version byte of 1,
+// and the 64 bytes of the seed.
+func EncodeSeedFile(seed []byte) ([]byte, error) {
+	if len(seed) != seedSize {
+		return nil, fmt.Errorf("%w: seed of %d bytes, expected %d", ErrInvalidSeedFile, len(seed), seedSize)
+	}
+	return append(append(append([]byte{}, seedFileMagic...), seedFileVersion), seed...), nil
+}
+
+// DecodeSeedFile returns the seed of a file produced by EncodeSeedFile.
+func DecodeSeedFile(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, seedFileMagic) || len(data) < len(seedFileMagic)+1 {
+		return nil, fmt.Errorf("%w: unknown format", ErrInvalidSeedFile)
+	}
+	if version := data[len(seedFileMagic)]; version != seedFileVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidSeedFile, version)
+	}
+	seed := data[len(seedFileMagic)+1:]
+	if len(seed) != seedSize {
+		return nil, fmt.Errorf("%w: seed of %d bytes, expected %d", ErrInvalidSeedFile, len(seed), seedSize)
+	}
+	return seed, nil
+}
+
+// MnemonicFingerprint returns a short label identifying the wallet of a mnemonic without revealing it:
+// the first 8 hex characters of the SHA-256 hash of its BIP-39 seed, with an empty passphrase.
+func MnemonicFingerprint(mnemonic string) string {
+	hash := sha256.Sum256(DeriveSeed(mnemonic, ""))
+	return hex.EncodeToString(hash[:4])
+}
+
 // HashAudioData creates a SHA-256 hash of the input data.
 func HashAudioData(data []byte) [sha256.Size]byte {
 	return sha256.Sum256(data)
 }
 
-// CombineAndHashData combines two byte slices and hashes the resulting data.
-func CombineAndHashData(data1, data2 []byte) [sha256.Size]byte {
-	combinedData := append(data1, data2...)
-	return sha256.Sum256(combinedData)
+// DeviceContext identifies the device audio was captured with.
+type DeviceContext struct {
+	Name       string
+	Index      int
+	SampleRate int
+}
+
+// HashAudioDataWithContext hashes the input data prefixed with the device context, so that identical audio
+// captured on different devices hashes differently. An empty context gives the same hash as HashAudioData.
+func HashAudioDataWithContext(data []byte, ctx DeviceContext) [sha256.Size]byte {
+	if ctx == (DeviceContext{}) {
+		return HashAudioData(data)
+	}
+
+	// Length-prefix the name so that no two contexts share an encoding.
+	h := sha256.New()
+	h.Write([]byte("aeb/device"))
+	binary.Write(h, binary.BigEndian, uint32(len(ctx.Name)))
+	h.Write([]byte(ctx.Name))
+	binary.Write(h, binary.BigEndian, int64(ctx.Index))
+	binary.Write(h, binary.BigEndian, int64(ctx.SampleRate))
+	h.Write(data)
+
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// CombineAndHashData concatenates byte slices and hashes the resulting data.
+// With two slices, e.g. the entropy and the audio hash, extra sources can be appended after them.
+func CombineAndHashData(data ...[]byte) [sha256.Size]byte {
+	hash := sha256.New()
+	for _, d := range data {
+		hash.Write(d)
+	}
+
+	var sum [sha256.Size]byte
+	copy(sum[:], hash.Sum(nil))
+	return sum
+}
+
+// CombineAudioHashes combines the hashes of several independent recordings into a single audio hash.
+// The hashes are sorted first, so the result does not depend on their order: in a multi-party ceremony,
+// no participant's recording takes precedence.
+func CombineAudioHashes(hashes ...[sha256.Size]byte) [sha256.Size]byte {
+	sorted := make([][]byte, len(hashes))
+	for i := range hashes {
+		sorted[i] = hashes[i][:]
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i], sorted[j]) < 0
+	})
+	return CombineAndHashData(append([][]byte{[]byte("aeb/audio-hashes")}, sorted...)...)
+}
+
+// Separate HKDF info labels of the two shares of SplitEntropy.
+var (
+	splitRNGInfo   = []byte("aeb/split/rng")
+	splitAudioInfo = []byte("aeb/split/audio")
+)
+
+// SplitEntropy composes entropy of a fixed budget from two sources instead of mixing them equally: rngBits
+// are derived from the generated entropy and audioBits from the audio hash, each with HKDF and its own info
+// label, and the two shares are concatenated, RNG first. The bit counts must be positive multiples of 8.
+func SplitEntropy(entropy, audioHash []byte, rngBits, audioBits int) ([]byte, error) {
+	if rngBits <= 0 || audioBits <= 0 || rngBits%8 != 0 || audioBits%8 != 0 {
+		return nil, fmt.Errorf("invalid split %d:%d: both shares must be positive multiples of 8 bits", rngBits, audioBits)
+	}
+
+	split := make([]byte, (rngBits+audioBits)/8)
+	rngShare, audioShare := split[:rngBits/8], split[rngBits/8:]
+	if n, err := io.ReadFull(hkdf.New(sha256.New, entropy, nil, splitRNGInfo), rngShare); err != nil {
+		return nil, fmt.Errorf("%w: read %d of %d bytes", ErrShortKeyDerivation, n, len(rngShare))
+	}
+	if n, err := io.ReadFull(hkdf.New(sha256.New, audioHash, nil, splitAudioInfo), audioShare); err != nil {
+		return nil, fmt.Errorf("%w: read %d of %d bytes", ErrShortKeyDerivation, n, len(audioShare))
+	}
+	return split, nil
+}
+
+// entropyPassphraseInfo prefixes the passphrase in the HKDF info of ApplyEntropyPassphrase.
+var entropyPassphraseInfo = []byte("aeb/entropy-passphrase/")
+
+// ApplyEntropyPassphrase folds a memorized passphrase into the mnemonic input, so that the mnemonic itself
+// depends on it: the input is expanded with HKDF-SHA256, with the passphrase in the info, into as many bytes.
+// Unlike the BIP-39 passphrase, which only changes the seed a wallet derives from a mnemonic, it changes the
+// mnemonic.
+func ApplyEntropyPassphrase(input []byte, passphrase string) ([]byte, error) {
+	info := append(append([]byte{}, entropyPassphraseInfo...), passphrase...)
+	output := make([]byte, len(input))
+	if n, err := io.ReadFull(hkdf.New(sha256.New, input, nil, info), output); err != nil {
+		return nil, fmt.Errorf("%w: read %d of %d bytes", ErrShortKeyDerivation, n, len(output))
+	}
+	return output, nil
+}
+
+// IterateHash hashes the data with SHA-256 and re-hashes the digest rounds-1 more times.
+// A single round is a plain SHA-256 of the data; rounds below 1 are treated as 1.
+// This only makes brute-forcing the input slower by a constant factor and is no substitute for a real KDF.
+func IterateHash(data []byte, rounds int) [sha256.Size]byte {
+	sum := sha256.Sum256(data)
+	for i := 1; i < rounds; i++ {
+		sum = sha256.Sum256(sum[:])
+	}
+	return sum
+}
+
+// Parameters of the passphrase encryption of EncryptWithPassphrase.
+const (
+	scryptN            = 1 << 15
+	scryptR            = 8
+	scryptP            = 1
+	encryptionSaltSize = 16
+)
+
+// encryptionMagic starts every encrypted blob and versions its format.
+var encryptionMagic = []byte("AEB1")
+
+// ErrDecryptionFailed indicates a wrong passphrase or a corrupted encrypted blob.
+var ErrDecryptionFailed = errors.New("decryption failed")
+
+// newPassphraseCipher derives an AES-256-GCM cipher from the passphrase and salt with scrypt.
+func newPassphraseCipher(passphrase, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, keySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptWithPassphrase encrypts plaintext with AES-256-GCM under a key derived from the passphrase with scrypt.
+// The result is the magic "AEB1", the random salt and nonce, and the ciphertext; the magic is authenticated too.
+func EncryptWithPassphrase(plaintext, passphrase []byte) ([]byte, error) {
+	salt := make([]byte, encryptionSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := newPassphraseCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	blob := append(append(append([]byte{}, encryptionMagic...), salt...), nonce...)
+	return aead.Seal(blob, nonce, plaintext, encryptionMagic), nil
+}
+
+// DecryptWithPassphrase decrypts a blob produced by EncryptWithPassphrase.
+func DecryptWithPassphrase(blob, passphrase []byte) ([]byte, error) {
+	if !bytes.HasPrefix(blob, encryptionMagic) || len(blob) < len(encryptionMagic)+encryptionSaltSize {
+		return nil, fmt.Errorf("%w: unknown format", ErrDecryptionFailed)
+	}
+	salt := blob[len(encryptionMagic) : len(encryptionMagic)+encryptionSaltSize]
+	aead, err := newPassphraseCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	rest := blob[len(encryptionMagic)+encryptionSaltSize:]
+	if len(rest) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: truncated", ErrDecryptionFailed)
+	}
+	plaintext, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], encryptionMagic)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	return plaintext, nil
+}
+
+// brainSongSalt is the PBKDF2 salt of DeriveEntropyFromFeatures, separating it from other uses of PBKDF2.
+var brainSongSalt = []byte("aeb/brain-song")
+
+// DeriveEntropyFromFeatures derives 256 bits of entropy from an audio feature vector with PBKDF2-HMAC-SHA512,
+// like BIP-39 derives its seed. The result only depends on the features, so the same feature vector always
+// yields the same mnemonic, and the iteration count slows down guessing the (low-entropy) features.
+func DeriveEntropyFromFeatures(features []byte, iterations int) []byte {
+	return pbkdf2.Key(features, brainSongSalt, iterations, keySize, sha512.New)
+}
+
+// selfTestEntropy and selfTestMnemonic are the first BIP-39 test vector (all-zero 128-bit entropy).
+var selfTestEntropy = make([]byte, 16)
+
+const selfTestMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+// ErrSelfTestFailed indicates that a known-answer test did not produce the expected result.
+var ErrSelfTestFailed = errors.New("self-test failed")
+
+// SelfTest runs known-answer tests of the mnemonic generation and validation.
+func SelfTest() error {
+	mnemonic, err := GenerateMnemonic(selfTestEntropy)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSelfTestFailed, err)
+	}
+	if mnemonic != selfTestMnemonic {
+		return fmt.Errorf("%w: unexpected mnemonic %q", ErrSelfTestFailed, mnemonic)
+	}
+	if err := ValidateMnemonic(mnemonic); err != nil {
+		return fmt.Errorf("%w: %v", ErrSelfTestFailed, err)
+	}
+
+	// Hashing must be deterministic and sensitive to its input.
+	if HashAudioData([]byte{0}) == HashAudioData([]byte{1}) {
+		return fmt.Errorf("%w: audio hash ignores its input", ErrSelfTestFailed)
+	}
+
+	return nil
 }
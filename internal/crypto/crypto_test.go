@@ -0,0 +1,559 @@
+// crypto/crypto_test.go
+
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/tyler-smith/go-bip39"
+)
+
+func TestDeriveKeyWithParamsAudioSalt(t *testing.T) {
+	entropy := bytes.Repeat([]byte{0x42}, 32)
+	hash1 := HashAudioData([]byte("first recording"))
+	hash2 := HashAudioData([]byte("second recording"))
+
+	key1, err := DeriveKeyWithParams(entropy, hash1[:], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key2, err := DeriveKeyWithParams(entropy, hash2[:], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(key1, key2) {
+		t.Error("the derived key does not change with the audio hash salt")
+	}
+
+	again, err := DeriveKeyWithParams(entropy, hash1[:], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key1, again) {
+		t.Error("the derived key is not deterministic")
+	}
+
+	unsalted, err := DeriveKey(entropy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(key1, unsalted) {
+		t.Error("the salted key equals the unsalted key")
+	}
+	if len(key1) != keySize {
+		t.Errorf("key size = %d, want %d", len(key1), keySize)
+	}
+}
+
+func TestSchemeTag(t *testing.T) {
+	if got := string(SchemeTag(1)); got != "aeb/v1" {
+		t.Errorf("SchemeTag(1) = %q, want aeb/v1", got)
+	}
+	if tag := SchemeTag(0); tag != nil {
+		t.Errorf("SchemeTag(0) = %q, want no tag", tag)
+	}
+
+	entropy := bytes.Repeat([]byte{0x42}, 32)
+	audioHash := HashAudioData([]byte("recording"))
+	v1, err := DeriveKeyWithParams(entropy, audioHash[:], SchemeTag(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := DeriveKeyWithParams(entropy, audioHash[:], SchemeTag(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(v1, v2) {
+		t.Error("the v1 and v2 tags derive the same key")
+	}
+	if CombineAndHashData(SchemeTag(1), entropy, audioHash[:], nil) == CombineAndHashData(SchemeTag(2), entropy, audioHash[:], nil) {
+		t.Error("the v1 and v2 tags give the same combined data hash")
+	}
+}
+
+func TestPersonalizeTag(t *testing.T) {
+	tag := SchemeTag(1)
+	if got := PersonalizeTag(tag, ""); !bytes.Equal(got, tag) {
+		t.Errorf("PersonalizeTag without a personalization = %q, want %q", got, tag)
+	}
+	if got := string(PersonalizeTag(tag, "my-app")); got != "aeb/v1/personalize:my-app\x00" {
+		t.Errorf("PersonalizeTag(my-app) = %q", got)
+	}
+	if string(tag) != "aeb/v1" {
+		t.Errorf("PersonalizeTag modified the tag to %q", tag)
+	}
+
+	entropy := bytes.Repeat([]byte{0x42}, 32)
+	audioHash := HashAudioData([]byte("recording"))
+	plain := CombineAndHashData(tag, entropy, audioHash[:], nil)
+	app1 := CombineAndHashData(PersonalizeTag(tag, "app-one"), entropy, audioHash[:], nil)
+	app2 := CombineAndHashData(PersonalizeTag(tag, "app-two"), entropy, audioHash[:], nil)
+	if app1 == app2 || app1 == plain {
+		t.Error("different personalizations give the same combined data hash")
+	}
+	if CombineAndHashData(PersonalizeTag(tag, ""), entropy, audioHash[:], nil) != plain {
+		t.Error("the empty personalization changes the combined data hash")
+	}
+}
+
+func TestValidateSchemeVersion(t *testing.T) {
+	for version := 0; version <= SchemeVersion; version++ {
+		if err := ValidateSchemeVersion(version); err != nil {
+			t.Errorf("ValidateSchemeVersion(%d): %v", version, err)
+		}
+	}
+	for _, version := range []int{-1, SchemeVersion + 1} {
+		if err := ValidateSchemeVersion(version); !errors.Is(err, ErrUnsupportedScheme) {
+			t.Errorf("ValidateSchemeVersion(%d) = %v, want ErrUnsupportedScheme", version, err)
+		}
+	}
+}
+
+func TestIterateHash(t *testing.T) {
+	tag, entropy, audio := SchemeTag(SchemeVersion), []byte("entropy"), []byte("audio")
+	combined := CombineAndHashData(tag, entropy, audio)
+	concatenated := append(append(append([]byte{}, tag...), entropy...), audio...)
+	if IterateHash(concatenated, 1) != combined {
+		t.Error("one round differs from CombineAndHashData")
+	}
+
+	three := IterateHash(concatenated, 3)
+	if three == combined {
+		t.Error("three rounds equal one")
+	}
+	if three != IterateHash(concatenated, 3) {
+		t.Error("three rounds are not deterministic")
+	}
+	// Each round hashes the previous one.
+	if IterateHash(combined[:], 2) != three {
+		t.Error("three rounds differ from two more rounds of the first")
+	}
+}
+
+func TestMnemonicToSeedQRDigits(t *testing.T) {
+	// The 24-word example of the SeedQR specification of SeedSigner, and the zero entropy phrase.
+	tests := []struct {
+		mnemonic, digits string
+	}{
+		{
+			"attack pizza motion avocado network gather crop fresh patrol unusual wild holiday candy pony ranch winter theme error hybrid van cereal salon goddess expire",
+			"011513251154012711900771041507421289190620080870026613431420201617920614089619290300152408010643",
+		},
+		{
+			"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+			"000000000000000000000000000000000000000000000003",
+		},
+	}
+	for _, tt := range tests {
+		digits, err := MnemonicToSeedQRDigits(tt.mnemonic)
+		if err != nil {
+			t.Errorf("MnemonicToSeedQRDigits(%q): %v", tt.mnemonic, err)
+			continue
+		}
+		if digits != tt.digits {
+			t.Errorf("MnemonicToSeedQRDigits(%q) = %s, want %s", tt.mnemonic, digits, tt.digits)
+		}
+	}
+
+	if _, err := MnemonicToSeedQRDigits("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon"); err == nil {
+		t.Error("MnemonicToSeedQRDigits of a mnemonic with a bad checksum succeeded")
+	}
+}
+
+// constantReader is a broken random source that always returns the same byte.
+type constantReader byte
+
+func (r constantReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(r)
+	}
+	return len(p), nil
+}
+
+// repeatingReader is a broken random source that returns the same varied block on each read.
+type repeatingReader struct{}
+
+func (repeatingReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(i * 7)
+	}
+	return len(p), nil
+}
+
+// failingReader is a random source whose reads fail.
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("device unavailable")
+}
+
+func TestCheckEntropySource(t *testing.T) {
+	if err := CheckEntropySource(rand.Reader); err != nil {
+		t.Errorf("CheckEntropySource(crypto/rand): %v", err)
+	}
+	for name, r := range map[string]io.Reader{
+		"constant":  constantReader(0x42),
+		"repeating": repeatingReader{},
+		"failing":   failingReader{},
+	} {
+		if err := CheckEntropySource(r); !errors.Is(err, ErrWeakSystemEntropy) {
+			t.Errorf("CheckEntropySource(%s reader) = %v, want ErrWeakSystemEntropy", name, err)
+		}
+	}
+}
+
+func TestDeriveEntropyFromFeatures(t *testing.T) {
+	features := []byte{7, 6, 3, 0, 1, 4, 7, 2}
+	entropy := DeriveEntropyFromFeatures(features, 1000)
+	again := DeriveEntropyFromFeatures(append([]byte{}, features...), 1000)
+	if !bytes.Equal(entropy, again) {
+		t.Error("the same features give different entropy")
+	}
+	mnemonic, err := GenerateMnemonic(entropy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := GenerateMnemonic(again); err != nil || again != mnemonic {
+		t.Errorf("the same features give the mnemonics %q and %q (%v)", mnemonic, again, err)
+	}
+
+	other := append([]byte{}, features...)
+	other[3] = 1
+	if bytes.Equal(entropy, DeriveEntropyFromFeatures(other, 1000)) {
+		t.Error("different features give the same entropy")
+	}
+	if bytes.Equal(entropy, DeriveEntropyFromFeatures(features, 1001)) {
+		t.Error("different iteration counts give the same entropy")
+	}
+}
+
+func TestVerificationWord(t *testing.T) {
+	mnemonic := "legal winner thank year wave sausage worth useful legal winner thank yellow"
+	word, err := VerificationWord(mnemonic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := bip39.GetWordIndex(word); !ok {
+		t.Errorf("verification word %q is not in the wordlist", word)
+	}
+	if again, err := VerificationWord("  legal winner thank year wave sausage\tworth useful legal winner thank yellow\n"); err != nil || again != word {
+		t.Errorf("verification word of the phrase with other spacing = %q (%v), want %q", again, err, word)
+	}
+
+	// Altering, dropping or swapping any word changes the verification word.
+	words := strings.Fields(mnemonic)
+	for i := range words {
+		altered := append([]string{}, words...)
+		altered[i] = "zoo"
+		if got, err := VerificationWord(strings.Join(altered, " ")); err != nil || got == word {
+			t.Errorf("verification word with word %d altered = %q (%v), want other than %q", i+1, got, err, word)
+		}
+		dropped := append(append([]string{}, words[:i]...), words[i+1:]...)
+		if got, err := VerificationWord(strings.Join(dropped, " ")); err != nil || got == word {
+			t.Errorf("verification word with word %d dropped = %q (%v), want other than %q", i+1, got, err, word)
+		}
+	}
+	swapped := append([]string{}, words...)
+	swapped[0], swapped[1] = swapped[1], swapped[0]
+	if got, _ := VerificationWord(strings.Join(swapped, " ")); got == word {
+		t.Errorf("verification word with the first two words swapped = %q, want other than %q", got, word)
+	}
+
+	for _, phrase := range []string{"", "legal winner thnak"} {
+		if _, err := VerificationWord(phrase); !errors.Is(err, ErrInvalidMnemonic) {
+			t.Errorf("VerificationWord(%q) = %v, want ErrInvalidMnemonic", phrase, err)
+		}
+	}
+}
+
+func TestMnemonicChecksum(t *testing.T) {
+	abandon := strings.Repeat("abandon ", 11)
+	tests := []struct {
+		mnemonic         string
+		expected, actual string
+	}{
+		// The first byte of the SHA-256 hash of 16 zero bytes is 0x37, and "about" is word 3.
+		{abandon + "about", "0011", "0011"},
+		// The last word is corrupted to word 0.
+		{abandon + "abandon", "0011", "0000"},
+		// The first byte of the SHA-256 hash of 32 zero bytes is 0x66, and "art" is word 102.
+		{strings.Repeat("abandon ", 23) + "art", "01100110", "01100110"},
+		// "arrow" is word 101.
+		{strings.Repeat("abandon ", 23) + "arrow", "01100110", "01100101"},
+	}
+	for _, tt := range tests {
+		expected, actual, err := MnemonicChecksum(tt.mnemonic)
+		if err != nil {
+			t.Errorf("MnemonicChecksum(%q): %v", tt.mnemonic, err)
+			continue
+		}
+		if expected != tt.expected || actual != tt.actual {
+			t.Errorf("MnemonicChecksum(%q) = %s, %s, want %s, %s", tt.mnemonic, expected, actual, tt.expected, tt.actual)
+		}
+	}
+
+	for _, mnemonic := range []string{abandon + "notaword", abandon} {
+		if _, _, err := MnemonicChecksum(mnemonic); !errors.Is(err, ErrInvalidMnemonic) {
+			t.Errorf("MnemonicChecksum(%q) = %v, want ErrInvalidMnemonic", mnemonic, err)
+		}
+	}
+}
+
+func TestGenerateMnemonics(t *testing.T) {
+	input := bytes.Repeat([]byte{0x17}, 32)
+	mnemonics, err := GenerateMnemonics(input, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mnemonics) != 5 {
+		t.Fatalf("GenerateMnemonics gave %d mnemonics, want 5", len(mnemonics))
+	}
+	seen := make(map[string]bool)
+	for i, mnemonic := range mnemonics {
+		if err := ValidateMnemonic(mnemonic); err != nil {
+			t.Errorf("mnemonic %d %q: %v", i, mnemonic, err)
+		}
+		if seen[mnemonic] {
+			t.Errorf("mnemonic %d %q is repeated", i, mnemonic)
+		}
+		seen[mnemonic] = true
+	}
+
+	// The list is deterministic, and each mnemonic only depends on its own label.
+	again, err := GenerateMnemonics(input, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range again {
+		if again[i] != mnemonics[i] {
+			t.Errorf("mnemonic %d = %q, then %q", i, mnemonics[i], again[i])
+		}
+	}
+	single, err := GenerateMnemonic(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen[single] {
+		t.Error("a numbered mnemonic equals the single mnemonic of the same input")
+	}
+}
+
+func TestHashAudioDataWithContext(t *testing.T) {
+	data := []byte("identical PCM")
+	contexts := []DeviceContext{
+		{Name: "USB Microphone", Index: 3, SampleRate: 44100},
+		{Name: "USB Microphone", Index: 4, SampleRate: 44100},
+		{Name: "USB Microphone", Index: 3, SampleRate: 48000},
+		{Name: "Line In", Index: 3, SampleRate: 44100},
+	}
+	hashes := make(map[[32]byte]DeviceContext)
+	for _, ctx := range contexts {
+		hash := HashAudioDataWithContext(data, ctx)
+		if other, ok := hashes[hash]; ok {
+			t.Errorf("contexts %+v and %+v give the same hash", ctx, other)
+		}
+		hashes[hash] = ctx
+	}
+	if HashAudioDataWithContext(data, DeviceContext{}) != HashAudioData(data) {
+		t.Error("the empty context changes the hash")
+	}
+	if _, ok := hashes[HashAudioData(data)]; ok {
+		t.Error("a device context gives the hash without context")
+	}
+}
+
+func TestCombineAudioHashes(t *testing.T) {
+	a, b, c := HashAudioData([]byte("a")), HashAudioData([]byte("b")), HashAudioData([]byte("c"))
+	if CombineAudioHashes(a, b) != CombineAudioHashes(b, a) {
+		t.Error("CombineAudioHashes depends on the order of the hashes")
+	}
+	if CombineAudioHashes(a, b, c) != CombineAudioHashes(c, a, b) {
+		t.Error("CombineAudioHashes of three hashes depends on their order")
+	}
+	if CombineAudioHashes(a, b) == CombineAudioHashes(a, c) || CombineAudioHashes(a, b) == a {
+		t.Error("CombineAudioHashes ignores a hash")
+	}
+}
+
+func TestMnemonicFingerprint(t *testing.T) {
+	const mnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	// The first four bytes of the SHA-256 of the BIP-39 test vector seed 5eb00bbd...
+	if got, want := MnemonicFingerprint(mnemonic), "62a772f8"; got != want {
+		t.Errorf("MnemonicFingerprint = %s, want %s", got, want)
+	}
+	if MnemonicFingerprint(mnemonic) != MnemonicFingerprint(mnemonic) {
+		t.Error("MnemonicFingerprint is not deterministic")
+	}
+	other := "legal winner thank year wave sausage worth useful legal winner thank yellow"
+	if MnemonicFingerprint(other) == MnemonicFingerprint(mnemonic) {
+		t.Error("different mnemonics have the same fingerprint")
+	}
+}
+
+// oneByteReader returns one byte per Read, as io.Reader allows.
+type oneByteReader struct{ r io.Reader }
+
+func (o oneByteReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return o.r.Read(p[:1])
+}
+
+func TestReadKey(t *testing.T) {
+	want := bytes.Repeat([]byte{0xab}, keySize)
+	key, err := readKey(oneByteReader{bytes.NewReader(want)})
+	if err != nil || !bytes.Equal(key, want) {
+		t.Errorf("readKey of a byte-at-a-time reader = %x (%v), want %x", key, err, want)
+	}
+	if _, err := readKey(oneByteReader{bytes.NewReader(want[:keySize-1])}); !errors.Is(err, ErrShortKeyDerivation) {
+		t.Errorf("readKey of a short reader = %v, want ErrShortKeyDerivation", err)
+	}
+}
+
+func TestSeedFileRoundTrip(t *testing.T) {
+	seed := DeriveSeed("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "")
+	data, err := EncodeSeedFile(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data[:5], []byte("AEBS\x01")) || len(data) != 5+len(seed) {
+		t.Errorf("seed file starts with %q and has %d bytes, want \"AEBS\\x01\" and %d", data[:5], len(data), 5+len(seed))
+	}
+	if decoded, err := DecodeSeedFile(data); err != nil || !bytes.Equal(decoded, seed) {
+		t.Errorf("DecodeSeedFile = %x (%v), want %x", decoded, err, seed)
+	}
+
+	badVersion := append([]byte{}, data...)
+	badVersion[4] = 2
+	for name, bad := range map[string][]byte{
+		"bad magic":   append([]byte("XEBS\x01"), seed...),
+		"bad version": badVersion,
+		"truncated":   data[:len(data)-1],
+		"header only": data[:5],
+	} {
+		if _, err := DecodeSeedFile(bad); !errors.Is(err, ErrInvalidSeedFile) {
+			t.Errorf("DecodeSeedFile of a %s file = %v, want ErrInvalidSeedFile", name, err)
+		}
+	}
+	if _, err := EncodeSeedFile(seed[:32]); !errors.Is(err, ErrInvalidSeedFile) {
+		t.Errorf("EncodeSeedFile of a 32-byte seed = %v, want ErrInvalidSeedFile", err)
+	}
+}
+
+func TestGenerateMnemonicBitsModes(t *testing.T) {
+	input := make([]byte, 32)
+	for i := range input {
+		input[i] = byte(i)
+	}
+	mnemonicOf := func(entropyHex string) string {
+		t.Helper()
+		entropy, _ := hex.DecodeString(entropyHex)
+		mnemonic, err := bip39.NewMnemonic(entropy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return mnemonic
+	}
+
+	// The truncate mode keeps the first 16 bytes; the hkdf mode expands all 32 bytes with HKDF-Expand.
+	truncated, err := GenerateMnemonicBits(input, 128, TruncateModeTruncate)
+	if want := mnemonicOf("000102030405060708090a0b0c0d0e0f"); err != nil || truncated != want {
+		t.Errorf("truncate mode = %q (%v), want %q", truncated, err, want)
+	}
+	expanded, err := GenerateMnemonicBits(input, 128, TruncateModeHKDF)
+	if want := mnemonicOf("1b702e63a248f24e31484d53a53b9777"); err != nil || expanded != want {
+		t.Errorf("hkdf mode = %q (%v), want %q", expanded, err, want)
+	}
+	for _, mnemonic := range []string{truncated, expanded} {
+		if len(strings.Fields(mnemonic)) != 12 || !bip39.IsMnemonicValid(mnemonic) {
+			t.Errorf("%q is not a valid 12-word mnemonic", mnemonic)
+		}
+	}
+
+	// Only the hkdf mode depends on the discarded bytes.
+	changed := append([]byte{}, input...)
+	changed[31] ^= 1
+	if again, _ := GenerateMnemonicBits(changed, 128, TruncateModeTruncate); again != truncated {
+		t.Error("the truncate mode depends on the last byte")
+	}
+	if again, _ := GenerateMnemonicBits(changed, 128, TruncateModeHKDF); again == expanded {
+		t.Error("the hkdf mode ignores the last byte")
+	}
+	if full, _ := GenerateMnemonic(input); full != mustGenerate(t, input, 256, TruncateModeTruncate) {
+		t.Error("the truncate mode at 256 bits differs from GenerateMnemonic")
+	}
+}
+
+// mustGenerate returns GenerateMnemonicBits of the input, failing the test on errors.
+func mustGenerate(t *testing.T, input []byte, bits int, mode string) string {
+	t.Helper()
+	mnemonic, err := GenerateMnemonicBits(input, bits, mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mnemonic
+}
+
+func TestSplitEntropy(t *testing.T) {
+	entropy, audioHash := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	split, err := SplitEntropy(entropy, audioHash, 64, 192)
+	if err != nil || len(split) != 32 {
+		t.Fatalf("SplitEntropy 64:192 = %d bytes (%v), want 32", len(split), err)
+	}
+	// Each share only depends on its source.
+	other, _ := SplitEntropy(entropy, bytes.Repeat([]byte{3}, 32), 64, 192)
+	if !bytes.Equal(split[:8], other[:8]) || bytes.Equal(split[8:], other[8:]) {
+		t.Error("changing the audio hash does not only change the audio share")
+	}
+	for _, bits := range [][2]int{{0, 256}, {128, -128}, {100, 156}} {
+		if _, err := SplitEntropy(entropy, audioHash, bits[0], bits[1]); err == nil {
+			t.Errorf("SplitEntropy %d:%d succeeded", bits[0], bits[1])
+		}
+	}
+}
+
+// flakyReader fails its first failures reads, then reads from r.
+type flakyReader struct {
+	failures int
+	reads    int
+	r        io.Reader
+}
+
+func (f *flakyReader) Read(p []byte) (int, error) {
+	f.reads++
+	if f.reads <= f.failures {
+		return 0, errors.New("transient RNG failure")
+	}
+	return f.r.Read(p)
+}
+
+func TestGenerateEntropyFromRetries(t *testing.T) {
+	want := bytes.Repeat([]byte{0x42}, 32)
+	flaky := &flakyReader{failures: 2, r: bytes.NewReader(want)}
+	entropy, err := GenerateEntropyFrom(flaky, 256, 3)
+	if err != nil || !bytes.Equal(entropy, want) {
+		t.Errorf("GenerateEntropyFrom of a reader failing twice = %x (%v), want %x", entropy, err, want)
+	}
+	if flaky.reads != 3 {
+		t.Errorf("%d reads, want 2 failed ones and a successful one", flaky.reads)
+	}
+
+	broken := &flakyReader{failures: 100}
+	if _, err := GenerateEntropyFrom(broken, 256, 2); !errors.Is(err, ErrEntropyUnavailable) {
+		t.Errorf("GenerateEntropyFrom of a failing reader = %v, want ErrEntropyUnavailable", err)
+	}
+	if broken.reads != 3 {
+		t.Errorf("%d reads of a failing reader with 2 retries, want 3", broken.reads)
+	}
+
+	if _, err := GenerateEntropyFrom(bytes.NewReader(want), 100, 0); err == nil {
+		t.Error("GenerateEntropyFrom of 100 bits succeeded")
+	}
+}
@@ -0,0 +1,138 @@
+// crypto/electrum.go
+
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/tyler-smith/go-bip39"
+)
+
+const (
+	// ElectrumSegwitPrefix is the version prefix of Electrum native segwit seeds.
+	ElectrumSegwitPrefix = "100"
+
+	// ElectrumEntropyBits is the entropy of a new Electrum seed, as in Electrum's make_seed.
+	ElectrumEntropyBits = 132
+
+	// electrumBitsPerWord is the number of bits each word of an Electrum seed encodes.
+	electrumBitsPerWord = 11
+)
+
+// ErrInvalidElectrumSeed indicates that a phrase is not an Electrum seed of the expected version.
+var ErrInvalidElectrumSeed = errors.New("invalid Electrum seed")
+
+// MnemonicScheme turns entropy into a mnemonic phrase and checks phrases of its kind.
+type MnemonicScheme interface {
+	Name() string
+	Generate(entropy []byte) (string, error)
+	Validate(mnemonic string) error
+}
+
+// BIP39Scheme generates standard BIP-39 mnemonics. Bits is the entropy of the mnemonics (see
+// GenerateMnemonicBits) and TruncateMode how it is taken from larger entropy; a zero Bits uses all the entropy.
+type BIP39Scheme struct {
+	Bits         int
+	TruncateMode string
+}
+
+// Name returns "bip39".
+func (BIP39Scheme) Name() string {
+	return "bip39"
+}
+
+// Generate returns the BIP-39 mnemonic of the entropy.
+func (s BIP39Scheme) Generate(entropy []byte) (string, error) {
+	if s.Bits == 0 {
+		return GenerateMnemonic(entropy)
+	}
+	return GenerateMnemonicBits(entropy, s.Bits, s.TruncateMode)
+}
+
+// Validate checks the BIP-39 checksum of the mnemonic.
+func (BIP39Scheme) Validate(mnemonic string) error {
+	return ValidateMnemonic(mnemonic)
+}
+
+// ElectrumScheme generates Electrum "new" seeds of the native segwit type, which Electrum accepts
+// instead of BIP-39 mnemonics. They use the same English wordlist but are checked with a version prefix
+// of an HMAC of the phrase rather than with a checksum.
+type ElectrumScheme struct{}
+
+// Name returns "electrum".
+func (ElectrumScheme) Name() string {
+	return "electrum"
+}
+
+// Generate derives an Electrum segwit seed from the first 132 bits of the entropy. Like Electrum,
+// it increments the number until its encoding has the segwit version prefix, skipping phrases that
+// also happen to be valid BIP-39 mnemonics so that wallets cannot mistake one for the other.
+// Electrum draws numbers again until they are at least 2^121, so that seeds have 12 words; the number is
+// instead given its bit 121, and the search wraps around to 2^121 rather than reach 2^132.
+func (ElectrumScheme) Generate(entropy []byte) (string, error) {
+	if len(entropy)*8 < ElectrumEntropyBits {
+		return "", fmt.Errorf("need at least %d bits of entropy, got %d", ElectrumEntropyBits, len(entropy)*8)
+	}
+	number := new(big.Int).SetBytes(entropy)
+	number.Rsh(number, uint(len(entropy)*8-ElectrumEntropyBits))
+
+	one := big.NewInt(1)
+	lower := new(big.Int).Lsh(one, ElectrumEntropyBits-electrumBitsPerWord)
+	upper := new(big.Int).Lsh(one, ElectrumEntropyBits)
+	if number.Cmp(lower) < 0 {
+		number.Or(number, lower)
+	}
+	for {
+		number.Add(number, one)
+		if number.Cmp(upper) >= 0 {
+			number.Set(lower)
+		}
+		seed := electrumEncode(number)
+		if electrumSeedHasPrefix(seed, ElectrumSegwitPrefix) && !bip39.IsMnemonicValid(seed) {
+			return seed, nil
+		}
+	}
+}
+
+// Validate checks that the seed has the Electrum segwit version prefix.
+func (ElectrumScheme) Validate(mnemonic string) error {
+	for _, word := range strings.Fields(mnemonic) {
+		if _, ok := bip39.GetWordIndex(word); !ok {
+			return fmt.Errorf("%w: unknown word %q", ErrInvalidElectrumSeed, word)
+		}
+	}
+	if !electrumSeedHasPrefix(mnemonic, ElectrumSegwitPrefix) {
+		return ErrInvalidElectrumSeed
+	}
+	return nil
+}
+
+// electrumEncode encodes a number in base 2048 with the BIP-39 English wordlist, least significant word first.
+func electrumEncode(number *big.Int) string {
+	wordlist := bip39.GetWordList()
+	base := big.NewInt(int64(len(wordlist)))
+	remaining := new(big.Int).Set(number)
+	digit := new(big.Int)
+
+	var words []string
+	for remaining.Sign() > 0 {
+		remaining.DivMod(remaining, base, digit)
+		words = append(words, wordlist[digit.Int64()])
+	}
+	return strings.Join(words, " ")
+}
+
+// electrumSeedHasPrefix reports whether the hex HMAC-SHA512 of the seed, keyed with "Seed version",
+// starts with the version prefix. Phrases of lowercase English words separated by single spaces are
+// already in Electrum's normalized form.
+func electrumSeedHasPrefix(seed, prefix string) bool {
+	mac := hmac.New(sha512.New, []byte("Seed version"))
+	mac.Write([]byte(strings.Join(strings.Fields(strings.ToLower(seed)), " ")))
+	return strings.HasPrefix(hex.EncodeToString(mac.Sum(nil)), prefix)
+}
@@ -0,0 +1,62 @@
+// crypto/electrum_test.go
+
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestElectrumGenerate(t *testing.T) {
+	// Known answers of an independent implementation of Electrum's make_seed, from the first 132 bits.
+	tests := []struct {
+		name    string
+		entropy []byte
+		want    string
+	}{
+		// Below 2^121 the number starts from 2^121, whose encoding ends with "ability" (word 1).
+		{"zero", make([]byte, 32), "dog abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon ability"},
+		// The search wraps around from 2^132 - 1 to 2^121 rather than give a 13-word seed.
+		{"all ones", bytes.Repeat([]byte{0xff}, 32), "dog abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon ability"},
+		{"counting", []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31}, "report dry gather arch candy cage adjust expire amount liar amount ability"},
+	}
+	for _, tt := range tests {
+		seed, err := ElectrumScheme{}.Generate(tt.entropy)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if seed != tt.want {
+			t.Errorf("%s: Generate = %q, want %q", tt.name, seed, tt.want)
+		}
+		if words := len(strings.Fields(seed)); words != 12 {
+			t.Errorf("%s: seed of %d words, want 12", tt.name, words)
+		}
+		if !electrumSeedHasPrefix(seed, ElectrumSegwitPrefix) {
+			t.Errorf("%s: seed %q lacks the segwit version prefix", tt.name, seed)
+		}
+		if ValidateMnemonic(seed) == nil {
+			t.Errorf("%s: seed %q is also a valid BIP-39 mnemonic", tt.name, seed)
+		}
+	}
+
+	if _, err := (ElectrumScheme{}).Generate(make([]byte, 16)); err == nil {
+		t.Error("Generate of 128 bits succeeded, want an error")
+	}
+}
+
+func TestElectrumValidate(t *testing.T) {
+	// A segwit seed of the mnemonic tests of Electrum.
+	if err := (ElectrumScheme{}).Validate("wild father tree among universe such mobile favorite target dynamic credit identify"); err != nil {
+		t.Errorf("Validate of an Electrum segwit seed: %v", err)
+	}
+	// The HMAC of this BIP-39 mnemonic starts with 9b, not 100.
+	if err := (ElectrumScheme{}).Validate(selfTestMnemonic); !errors.Is(err, ErrInvalidElectrumSeed) {
+		t.Errorf("Validate of a BIP-39 mnemonic = %v, want ErrInvalidElectrumSeed", err)
+	}
+	if err := (ElectrumScheme{}).Validate("wild father tree among universe such mobile favorite target dynamic credit notaword"); !errors.Is(err, ErrInvalidElectrumSeed) {
+		t.Errorf("Validate of an unknown word = %v, want ErrInvalidElectrumSeed", err)
+	}
+}
@@ -0,0 +1,58 @@
+// crypto/keyformat.go
+
+package crypto
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// Accepted formats of EncodeKey.
+const (
+	KeyFormatHex = "hex"
+	KeyFormatPEM = "pem"
+	KeyFormatJWK = "jwk"
+)
+
+// pemKeyType is the PEM block type of symmetric keys encoded by EncodeKey.
+const pemKeyType = "SYMMETRIC KEY"
+
+// ErrUnknownKeyFormat indicates a key format that EncodeKey does not support.
+var ErrUnknownKeyFormat = errors.New("unknown key format")
+
+// JWK is a JSON Web Key (RFC 7517) of a symmetric key: key type "oct" and the base64url-encoded key, unpadded.
+type JWK struct {
+	KeyType string `json:"kty"`
+	Key     string `json:"k"`
+}
+
+// ValidateKeyFormat checks that the format is supported by EncodeKey.
+func ValidateKeyFormat(format string) error {
+	switch format {
+	case KeyFormatHex, KeyFormatPEM, KeyFormatJWK:
+		return nil
+	}
+	return fmt.Errorf("%w %q: must be %q, %q or %q", ErrUnknownKeyFormat, format, KeyFormatHex, KeyFormatPEM, KeyFormatJWK)
+}
+
+// EncodeKey encodes a symmetric key, such as a key of DeriveKeyWithParams, as lowercase hex, as a PEM block of
+// type "SYMMETRIC KEY", or as a JWK document. The PEM block ends with a newline, the other formats do not.
+func EncodeKey(key []byte, format string) (string, error) {
+	switch format {
+	case KeyFormatHex:
+		return hex.EncodeToString(key), nil
+	case KeyFormatPEM:
+		return string(pem.EncodeToMemory(&pem.Block{Type: pemKeyType, Bytes: key})), nil
+	case KeyFormatJWK:
+		data, err := json.Marshal(JWK{KeyType: "oct", Key: base64.RawURLEncoding.EncodeToString(key)})
+		if err != nil {
+			return "", fmt.Errorf("error encoding JWK: %w", err)
+		}
+		return string(data), nil
+	}
+	return "", ValidateKeyFormat(format)
+}
@@ -0,0 +1,51 @@
+// crypto/keyformat_test.go
+
+package crypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"testing"
+)
+
+func TestEncodeKey(t *testing.T) {
+	key := make([]byte, keySize)
+	for i := range key {
+		key[i] = byte(0xf0 + i%16) // Bytes that need the URL-safe base64 alphabet
+	}
+
+	if got, err := EncodeKey(key, KeyFormatHex); err != nil || got != "f0f1f2f3f4f5f6f7f8f9fafbfcfdfefff0f1f2f3f4f5f6f7f8f9fafbfcfdfeff" {
+		t.Errorf("hex key = %s (%v)", got, err)
+	}
+
+	encoded, err := EncodeKey(key, KeyFormatJWK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var jwk map[string]string
+	if err := json.Unmarshal([]byte(encoded), &jwk); err != nil {
+		t.Fatalf("JWK %s is not valid JSON: %v", encoded, err)
+	}
+	if jwk["kty"] != "oct" {
+		t.Errorf("JWK key type = %q, want \"oct\"", jwk["kty"])
+	}
+	if decoded, err := base64.RawURLEncoding.DecodeString(jwk["k"]); err != nil || !bytes.Equal(decoded, key) {
+		t.Errorf("JWK key %q decodes to %x (%v), want %x", jwk["k"], decoded, err, key)
+	}
+
+	encoded, err = EncodeKey(key, KeyFormatPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, rest := pem.Decode([]byte(encoded))
+	if block == nil || block.Type != "SYMMETRIC KEY" || !bytes.Equal(block.Bytes, key) || len(rest) != 0 {
+		t.Errorf("PEM key %q does not hold a single SYMMETRIC KEY block of the key", encoded)
+	}
+
+	if _, err := EncodeKey(key, "der"); !errors.Is(err, ErrUnknownKeyFormat) {
+		t.Errorf("EncodeKey in an unknown format = %v, want ErrUnknownKeyFormat", err)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+// crypto/mlock_other.go
+
+package crypto
+
+import "fmt"
+
+// LockMemory returns ErrMemoryLock, as memory locking is not supported on this platform, and a function that
+// does nothing.
+func LockMemory(b []byte) (unlock func(), err error) {
+	return func() {}, fmt.Errorf("%w: not supported on this platform", ErrMemoryLock)
+}
@@ -0,0 +1,42 @@
+// crypto/mlock_test.go
+
+package crypto
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLockMemory(t *testing.T) {
+	secret := make([]byte, 64)
+	unlock, err := LockMemory(secret)
+	if unlock == nil {
+		t.Fatal("LockMemory returned no unlock function")
+	}
+	defer unlock()
+	if err != nil {
+		// Unsupported platforms and exhausted RLIMIT_MEMLOCK limits degrade to a warning in the command.
+		if !errors.Is(err, ErrMemoryLock) {
+			t.Fatalf("LockMemory = %v, want ErrMemoryLock", err)
+		}
+		t.Skipf("memory locking is not available: %v", err)
+	}
+
+	// The buffer stays usable while locked.
+	secret[0] = 1
+	Wipe(secret)
+	if secret[0] != 0 {
+		t.Error("Wipe did not clear the locked buffer")
+	}
+}
+
+func TestLockMemoryEmpty(t *testing.T) {
+	unlock, err := LockMemory(nil)
+	if unlock == nil {
+		t.Fatal("LockMemory returned no unlock function")
+	}
+	unlock()
+	if err != nil && !errors.Is(err, ErrMemoryLock) {
+		t.Errorf("LockMemory(nil) = %v, want nil or ErrMemoryLock", err)
+	}
+}
@@ -0,0 +1,26 @@
+//go:build unix
+
+// crypto/mlock_unix.go
+
+package crypto
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// LockMemory locks the pages of b into RAM, so that a secret it holds is never written to swap, and returns
+// the function that unlocks them. Locking may fail when it exceeds the limit of locked memory of the process
+// (RLIMIT_MEMLOCK), in which case the returned function does nothing. Copies of b are not locked.
+func LockMemory(b []byte) (unlock func(), err error) {
+	if len(b) == 0 {
+		return func() {}, nil
+	}
+	if err := unix.Mlock(b); err != nil {
+		return func() {}, fmt.Errorf("%w: %v", ErrMemoryLock, err)
+	}
+	return func() {
+		unix.Munlock(b) // Unlocking only fails for memory that is not mapped, which b always is.
+	}, nil
+}
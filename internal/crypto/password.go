@@ -0,0 +1,86 @@
+// crypto/password.go
+
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// Base58Alphabet is the Bitcoin base58 alphabet, without the look-alike characters 0, O, I and l.
+	Base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+	// MaxPasswordLength is the longest password BytesToPassword generates.
+	MaxPasswordLength = 1024
+
+	maxPasswordAlphabet = 256 // One byte of the key stream selects a character
+)
+
+// passwordTag domain-separates the key stream of BytesToPassword.
+var passwordTag = []byte("aeb/password")
+
+// ErrInvalidPasswordAlphabet indicates an alphabet that BytesToPassword cannot use.
+var ErrInvalidPasswordAlphabet = errors.New("invalid password alphabet")
+
+// ValidatePasswordAlphabet checks that the alphabet has 2 to 256 distinct printable, non-space characters.
+func ValidatePasswordAlphabet(alphabet string) error {
+	if !utf8.ValidString(alphabet) {
+		return fmt.Errorf("%w: not valid UTF-8", ErrInvalidPasswordAlphabet)
+	}
+	seen := make(map[rune]bool)
+	for _, r := range alphabet {
+		if !unicode.IsPrint(r) || unicode.IsSpace(r) {
+			return fmt.Errorf("%w: %q is not a printable character", ErrInvalidPasswordAlphabet, r)
+		}
+		if seen[r] {
+			return fmt.Errorf("%w: %q appears more than once", ErrInvalidPasswordAlphabet, r)
+		}
+		seen[r] = true
+	}
+	if len(seen) < 2 || len(seen) > maxPasswordAlphabet {
+		return fmt.Errorf("%w: has %d characters, must have 2 to %d", ErrInvalidPasswordAlphabet, len(seen), maxPasswordAlphabet)
+	}
+	return nil
+}
+
+// PasswordBits returns the strength in bits of a uniform password of length characters of the alphabet,
+// rounded down.
+func PasswordBits(length int, alphabet string) int {
+	return int(float64(length) * math.Log2(float64(utf8.RuneCountInString(alphabet))))
+}
+
+// BytesToPassword deterministically maps a key to a password of length characters of the alphabet, which must
+// pass ValidatePasswordAlphabet. The key is stretched into a stream of SHA-256 blocks, and each byte of the
+// stream selects a character; bytes that would make some characters more likely than others are rejected, so
+// that every character is uniform. length is capped at MaxPasswordLength.
+func BytesToPassword(key []byte, length int, alphabet string) string {
+	characters := []rune(alphabet)
+	size := len(characters)
+	// The largest multiple of size that fits in a byte, below which byte % size is uniform.
+	limit := maxPasswordAlphabet - maxPasswordAlphabet%size
+	if length > MaxPasswordLength {
+		length = MaxPasswordLength
+	}
+
+	password := make([]rune, 0, length)
+	var counter [8]byte
+	for block := uint64(0); len(password) < length; block++ {
+		binary.BigEndian.PutUint64(counter[:], block)
+		h := sha256.New()
+		h.Write(passwordTag)
+		h.Write(counter[:])
+		h.Write(key)
+		for _, b := range h.Sum(nil) {
+			if int(b) < limit && len(password) < length {
+				password = append(password, characters[int(b)%size])
+			}
+		}
+	}
+	return string(password)
+}
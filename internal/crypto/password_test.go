@@ -0,0 +1,63 @@
+// crypto/password_test.go
+
+package crypto
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestBytesToPassword(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	for _, tc := range []struct {
+		length   int
+		alphabet string
+	}{
+		{1, Base58Alphabet},
+		{20, Base58Alphabet},
+		{100, "01"},
+		{64, "äöüß€"},
+		{MaxPasswordLength, Base58Alphabet},
+	} {
+		password := BytesToPassword(key, tc.length, tc.alphabet)
+		if n := utf8.RuneCountInString(password); n != tc.length {
+			t.Errorf("password of length %d over %q has %d characters", tc.length, tc.alphabet, n)
+		}
+		for _, r := range password {
+			if !strings.ContainsRune(tc.alphabet, r) {
+				t.Errorf("password over %q contains %q", tc.alphabet, r)
+				break
+			}
+		}
+		if again := BytesToPassword(key, tc.length, tc.alphabet); again != password {
+			t.Errorf("BytesToPassword is not deterministic: %q, then %q", password, again)
+		}
+	}
+
+	if got := BytesToPassword(key, MaxPasswordLength+1, Base58Alphabet); len(got) != MaxPasswordLength {
+		t.Errorf("password longer than the maximum has %d characters, want %d", len(got), MaxPasswordLength)
+	}
+	if BytesToPassword(key, 20, Base58Alphabet) == BytesToPassword([]byte("another key"), 20, Base58Alphabet) {
+		t.Error("different keys gave the same password")
+	}
+	// A shorter password is a prefix of a longer one from the same key.
+	if short, long := BytesToPassword(key, 10, Base58Alphabet), BytesToPassword(key, 40, Base58Alphabet); !strings.HasPrefix(long, short) {
+		t.Errorf("password %q is not a prefix of %q", short, long)
+	}
+}
+
+func TestValidatePasswordAlphabet(t *testing.T) {
+	if err := ValidatePasswordAlphabet(Base58Alphabet); err != nil {
+		t.Errorf("ValidatePasswordAlphabet(base58) = %v", err)
+	}
+	for _, alphabet := range []string{"", "a", "aba", "ab c", "ab\x00", "ab\xff"} {
+		if err := ValidatePasswordAlphabet(alphabet); !errors.Is(err, ErrInvalidPasswordAlphabet) {
+			t.Errorf("ValidatePasswordAlphabet(%q) = %v, want ErrInvalidPasswordAlphabet", alphabet, err)
+		}
+	}
+	if bits := PasswordBits(20, Base58Alphabet); bits != 117 {
+		t.Errorf("PasswordBits(20, base58) = %d, want 117", bits)
+	}
+}
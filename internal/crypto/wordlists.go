@@ -0,0 +1,52 @@
+// crypto/wordlists.go
+
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/tyler-smith/go-bip39/wordlists"
+)
+
+// WordlistSize is the number of words of a BIP-39 wordlist.
+const WordlistSize = 2048
+
+// ErrInvalidWordlist indicates a wordlist that does not match its published BIP-39 version.
+var ErrInvalidWordlist = errors.New("invalid wordlist")
+
+// Wordlist is an embedded BIP-39 wordlist and the SHA-256 checksum of its published text file,
+// one word per line, which detects a corrupted list.
+type Wordlist struct {
+	Language string
+	Words    []string
+	Checksum string
+}
+
+// Wordlists lists the embedded BIP-39 wordlists, by language.
+var Wordlists = []Wordlist{
+	{"chinese-simplified", wordlists.ChineseSimplified, "5c5942792bd8340cb8b27cd592f1015edf56a8c5b26276ee18a482428e7c5726"},
+	{"chinese-traditional", wordlists.ChineseTraditional, "417b26b3d8500a4ae3d59717d7011952db6fc2fb84b807f3f94ac734e89c1b5f"},
+	{"czech", wordlists.Czech, "7e80e161c3e93d9554c2efb78d4e3cebf8fc727e9c52e03b83b94406bdcc95fc"},
+	{"english", wordlists.English, "2f5eed53a4727b4bf8880d8f3f199efc90e58503646d9ff8eff3a2ed3b24dbda"},
+	{"french", wordlists.French, "ebc3959ab7801a1df6bac4fa7d970652f1df76b683cd2f4003c941c63d517e59"},
+	{"italian", wordlists.Italian, "d392c49fdb700a24cd1fceb237c1f65dcc128f6b34a8aacb58b59384b5c648c2"},
+	{"japanese", wordlists.Japanese, "2eed0aef492291e061633d7ad8117f1a2b03eb80a29d0e4e3117ac2528d05ffd"},
+	{"korean", wordlists.Korean, "9e95f86c167de88f450f0aaf89e87f6624a57f973c67b516e338e8e8b8897f60"},
+	{"spanish", wordlists.Spanish, "46846a5a0139d1e3cb77293e521c2865f7bcdb82c44e8d0a06a2cd0ecba48c0b"},
+}
+
+// Check verifies that the wordlist has exactly WordlistSize words, and that they match its checksum.
+func (w Wordlist) Check() error {
+	if len(w.Words) != WordlistSize {
+		return fmt.Errorf("%w: %s has %d words, want %d", ErrInvalidWordlist, w.Language, len(w.Words), WordlistSize)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(w.Words, "\n") + "\n"))
+	if checksum := hex.EncodeToString(sum[:]); checksum != w.Checksum {
+		return fmt.Errorf("%w: %s has checksum %s, want %s", ErrInvalidWordlist, w.Language, checksum, w.Checksum)
+	}
+	return nil
+}
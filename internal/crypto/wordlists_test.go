@@ -0,0 +1,32 @@
+// crypto/wordlists_test.go
+
+package crypto
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestWordlistCheck(t *testing.T) {
+	for _, wordlist := range Wordlists {
+		if err := wordlist.Check(); err != nil {
+			t.Errorf("embedded %s wordlist: %v", wordlist.Language, err)
+		}
+		if wordlist.Language == "english" && len(wordlist.Words) != WordlistSize {
+			t.Errorf("English wordlist has %d words, want %d", len(wordlist.Words), WordlistSize)
+		}
+	}
+
+	english := Wordlists[3]
+	if english.Language != "english" {
+		t.Fatalf("Wordlists[3] is %s, want english", english.Language)
+	}
+	truncated := Wordlist{Language: "truncated", Words: english.Words[:WordlistSize-1], Checksum: english.Checksum}
+	if err := truncated.Check(); !errors.Is(err, ErrInvalidWordlist) {
+		t.Errorf("Check of a truncated wordlist = %v, want ErrInvalidWordlist", err)
+	}
+	corrupted := Wordlist{Language: "corrupted", Words: append([]string{"abandons"}, english.Words[1:]...), Checksum: english.Checksum}
+	if err := corrupted.Check(); !errors.Is(err, ErrInvalidWordlist) {
+		t.Errorf("Check of a corrupted wordlist = %v, want ErrInvalidWordlist", err)
+	}
+}
@@ -0,0 +1,334 @@
+// qr/qr.go
+
+package qr
+
+import (
+	"errors"
+	"image"
+	"image/color"
+)
+
+const (
+	maxVersion = 5 // Largest supported version; versions 1 to 5 at level L use a single error correction block
+	quietZone  = 4 // Width of the light border around the symbol, in modules
+)
+
+// dataCodewords and ecCodewords are the numbers of data and error correction codewords
+// of versions 1 to maxVersion at error correction level L.
+var (
+	dataCodewords = [maxVersion + 1]int{0, 19, 34, 55, 80, 108}
+	ecCodewords   = [maxVersion + 1]int{0, 7, 10, 15, 20, 26}
+)
+
+// ErrDataTooLong indicates that the data does not fit in the largest supported QR code version.
+var ErrDataTooLong = errors.New("data too long for a QR code")
+
+// Code is a QR code symbol.
+type Code struct {
+	Size       int // Number of modules per side
+	modules    [][]bool
+	isFunction [][]bool
+}
+
+// Encode encodes text in the smallest QR code of versions 1 to 5 with error correction level L and mask 0.
+// Text made only of digits, such as SeedQR digits, uses the compact numeric mode; other text is encoded as bytes.
+func Encode(text string) (*Code, error) {
+	numeric := isNumeric(text)
+	for version := 1; version <= maxVersion; version++ {
+		bits := encodeSegment(text, numeric)
+		if bits.len() > dataCodewords[version]*8 {
+			continue
+		}
+		data := bits.codewords(dataCodewords[version])
+		data = append(data, reedSolomonRemainder(data, ecCodewords[version])...)
+
+		code := newCode(version)
+		code.drawFunctionPatterns(version)
+		code.drawCodewords(data)
+		code.applyMask()
+		code.drawFormatBits()
+		return code, nil
+	}
+	return nil, ErrDataTooLong
+}
+
+// Dark reports whether the module at row y and column x is dark.
+func (c *Code) Dark(x, y int) bool {
+	return c.modules[y][x]
+}
+
+// Image renders the code with scale pixels per module and a quiet zone around it.
+func (c *Code) Image(scale int) image.Image {
+	side := (c.Size + 2*quietZone) * scale
+	img := image.NewGray(image.Rect(0, 0, side, side))
+	for y := 0; y < side; y++ {
+		for x := 0; x < side; x++ {
+			mx, my := x/scale-quietZone, y/scale-quietZone
+			dark := mx >= 0 && my >= 0 && mx < c.Size && my < c.Size && c.modules[my][mx]
+			if dark {
+				img.SetGray(x, y, color.Gray{Y: 0})
+			} else {
+				img.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+	return img
+}
+
+// isNumeric reports whether text is made only of decimal digits.
+func isNumeric(text string) bool {
+	for _, r := range text {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// bitBuffer accumulates the bits of the data stream.
+type bitBuffer []bool
+
+// append appends the length low-order bits of value, most significant first.
+func (b *bitBuffer) append(value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		*b = append(*b, value>>i&1 == 1)
+	}
+}
+
+func (b bitBuffer) len() int {
+	return len(b)
+}
+
+// codewords terminates and pads the bits to count codewords.
+func (b bitBuffer) codewords(count int) []byte {
+	capacity := count * 8
+	terminator := capacity - len(b)
+	if terminator > 4 {
+		terminator = 4
+	}
+	b.append(0, terminator)
+	b.append(0, (8-len(b)%8)%8)
+
+	data := make([]byte, 0, count)
+	for i := 0; i < len(b); i += 8 {
+		var codeword byte
+		for _, bit := range b[i : i+8] {
+			codeword <<= 1
+			if bit {
+				codeword |= 1
+			}
+		}
+		data = append(data, codeword)
+	}
+	for pad := byte(0xEC); len(data) < count; pad ^= 0xEC ^ 0x11 {
+		data = append(data, pad)
+	}
+	return data
+}
+
+// encodeSegment encodes text as a single numeric or byte mode segment, with the character count
+// field length of versions 1 to 9.
+func encodeSegment(text string, numeric bool) bitBuffer {
+	var bits bitBuffer
+	if !numeric {
+		bits.append(0x4, 4)
+		bits.append(len(text), 8)
+		for i := 0; i < len(text); i++ {
+			bits.append(int(text[i]), 8)
+		}
+		return bits
+	}
+
+	// Groups of three digits take 10 bits, a final group of two or one digits 7 or 4 bits.
+	bits.append(0x1, 4)
+	bits.append(len(text), 10)
+	for i := 0; i < len(text); i += 3 {
+		group := text[i:min(i+3, len(text))]
+		value := 0
+		for _, digit := range group {
+			value = value*10 + int(digit-'0')
+		}
+		bits.append(value, len(group)*3+1)
+	}
+	return bits
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// gfMultiply multiplies two elements of GF(2^8) modulo the QR code polynomial x^8 + x^4 + x^3 + x^2 + 1.
+func gfMultiply(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11D
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+// reedSolomonRemainder returns the degree error correction codewords of data.
+func reedSolomonRemainder(data []byte, degree int) []byte {
+	// Compute the generator polynomial, the product of (x - 2^i) for i below degree, without its leading term.
+	divisor := make([]byte, degree)
+	divisor[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range divisor {
+			divisor[j] = gfMultiply(divisor[j], root)
+			if j+1 < len(divisor) {
+				divisor[j] ^= divisor[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+
+	// Divide the data polynomial by the generator polynomial.
+	remainder := make([]byte, degree)
+	for _, b := range data {
+		factor := b ^ remainder[0]
+		copy(remainder, remainder[1:])
+		remainder[degree-1] = 0
+		for i := range remainder {
+			remainder[i] ^= gfMultiply(divisor[i], factor)
+		}
+	}
+	return remainder
+}
+
+// newCode creates an empty symbol of the given version.
+func newCode(version int) *Code {
+	size := version*4 + 17
+	code := &Code{Size: size, modules: make([][]bool, size), isFunction: make([][]bool, size)}
+	for y := range code.modules {
+		code.modules[y] = make([]bool, size)
+		code.isFunction[y] = make([]bool, size)
+	}
+	return code
+}
+
+// setFunction sets a module of a function pattern, which data and masking leave untouched.
+func (c *Code) setFunction(x, y int, dark bool) {
+	c.modules[y][x] = dark
+	c.isFunction[y][x] = true
+}
+
+// drawFunctionPatterns draws the timing, finder, and alignment patterns and reserves the format areas.
+func (c *Code) drawFunctionPatterns(version int) {
+	for i := 0; i < c.Size; i++ {
+		c.setFunction(6, i, i%2 == 0)
+		c.setFunction(i, 6, i%2 == 0)
+	}
+
+	// The finder patterns include their light separators.
+	for _, center := range [][2]int{{3, 3}, {c.Size - 4, 3}, {3, c.Size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := center[0]+dx, center[1]+dy
+				if x < 0 || y < 0 || x >= c.Size || y >= c.Size {
+					continue
+				}
+				distance := max(abs(dx), abs(dy))
+				c.setFunction(x, y, distance != 2 && distance != 4)
+			}
+		}
+	}
+
+	// Versions 2 to 6 have a single alignment pattern, near the bottom right corner.
+	if version >= 2 {
+		center := c.Size - 7
+		for dy := -2; dy <= 2; dy++ {
+			for dx := -2; dx <= 2; dx++ {
+				c.setFunction(center+dx, center+dy, max(abs(dx), abs(dy)) != 1)
+			}
+		}
+	}
+
+	// Reserve the format areas, drawn last.
+	c.drawFormatBits()
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func abs(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// drawCodewords places the codewords in the zigzag order of the standard, from the bottom right corner.
+func (c *Code) drawCodewords(data []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		// Skip the vertical timing pattern.
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < c.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = c.Size - 1 - vert
+				}
+				if !c.isFunction[y][x] && i < len(data)*8 {
+					c.modules[y][x] = data[i>>3]>>(7-i&7)&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask applies mask 0, which inverts the data modules whose row and column add up to an even number.
+func (c *Code) applyMask() {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.isFunction[y][x] && (x+y)%2 == 0 {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// drawFormatBits draws both copies of the format information for level L and mask 0, and the dark module.
+func (c *Code) drawFormatBits() {
+	const data = 1 << 3 // Level L, mask 0
+	remainder := data
+	for i := 0; i < 10; i++ {
+		remainder = remainder<<1 ^ (remainder>>9)*0x537
+	}
+	bits := (data<<10 | remainder) ^ 0x5412
+	bit := func(i int) bool {
+		return bits>>i&1 == 1
+	}
+
+	// First copy, around the top left finder pattern.
+	for i := 0; i <= 5; i++ {
+		c.setFunction(8, i, bit(i))
+	}
+	c.setFunction(8, 7, bit(6))
+	c.setFunction(8, 8, bit(7))
+	c.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		c.setFunction(14-i, 8, bit(i))
+	}
+
+	// Second copy, split between the two other finder patterns.
+	for i := 0; i < 8; i++ {
+		c.setFunction(c.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		c.setFunction(8, c.Size-15+i, bit(i))
+	}
+	c.setFunction(8, c.Size-8, true)
+}
@@ -0,0 +1,147 @@
+// qr/qr_test.go
+
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// render draws the modules of a code as rows of '#' for dark and '.' for light modules.
+func render(code *Code) []string {
+	rows := make([]string, code.Size)
+	for y := range rows {
+		var row strings.Builder
+		for x := 0; x < code.Size; x++ {
+			if code.Dark(x, y) {
+				row.WriteByte('#')
+			} else {
+				row.WriteByte('.')
+			}
+		}
+		rows[y] = row.String()
+	}
+	return rows
+}
+
+func TestEncodeGolden(t *testing.T) {
+	// The symbols decode to their text with an independent reader: format information of level L and mask 0,
+	// zero Reed-Solomon syndromes, and the numeric and byte segments.
+	tests := []struct {
+		name, text string
+		want       []string
+	}{
+		{"version 1 numeric", "01234567", []string{
+			"#######...#.#.#######",
+			"#.....#.....#.#.....#",
+			"#.###.#.#.#...#.###.#",
+			"#.###.#.....#.#.###.#",
+			"#.###.#..#.##.#.###.#",
+			"#.....#..###..#.....#",
+			"#######.#.#.#.#######",
+			"........#.#..........",
+			"###.#####.#.###...#..",
+			"..##.#..#..#.#.#...#.",
+			"#.....######.###.###.",
+			"##.#.#.###.###.##..#.",
+			"#.#.#.####.#.###....#",
+			"........#.....#....#.",
+			"#######.###.#...#...#",
+			"#.....#.#.....#..#.##",
+			"#.###.#.###.#.#.###.#",
+			"#.###.#..###.#.#.###.",
+			"#.###.#.####.###..#.#",
+			"#.....#.#..###.###...",
+			"#######.##.#.###..#.#",
+		}},
+		{"version 2 byte", "https://example.org/seed", []string{
+			"#######...#....#..#######",
+			"#.....#..#.....##.#.....#",
+			"#.###.#.#..#..##..#.###.#",
+			"#.###.#..#..#.#...#.###.#",
+			"#.###.#..#..#.##..#.###.#",
+			"#.....#...###.##..#.....#",
+			"#######.#.#.#.#.#.#######",
+			"........#..#.##.#........",
+			"###.#####...#######...#..",
+			".###.#.#.#.##.....#.....#",
+			"...####...####.....##.###",
+			"##.#.#...##.######.....#.",
+			"#..######.##.#..###..#.##",
+			"..#..#....##.##.###..#..#",
+			"#..##.##.#...##.#.##..###",
+			".##.##.#.#.#.####...#..#.",
+			"#..##.#.....##.#######...",
+			"........######.##...##.##",
+			"#######.#.###..##.#.##.##",
+			"#.....#.##..###.#...##.#.",
+			"#.###.#.#..###..######...",
+			"#.###.#...##.#.#...####..",
+			"#.###.#.#...#...#...#...#",
+			"#.....#.#.#####.#.#.##.#.",
+			"#######.##..##.#####...##",
+		}},
+	}
+	for _, tt := range tests {
+		code, err := Encode(tt.text)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		got := render(code)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: %d modules per side, want %d", tt.name, len(got), len(tt.want))
+			continue
+		}
+		for y := range got {
+			if got[y] != tt.want[y] {
+				t.Errorf("%s: row %d = %s, want %s", tt.name, y, got[y], tt.want[y])
+			}
+		}
+	}
+}
+
+func TestReedSolomonRemainder(t *testing.T) {
+	// The version 1-M examples of the standard, "01234567" and "HELLO WORLD".
+	tests := []struct {
+		data, want []byte
+	}{
+		{
+			[]byte{0x10, 0x20, 0x0C, 0x56, 0x61, 0x80, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11},
+			[]byte{0xA5, 0x24, 0xD4, 0xC1, 0xED, 0x36, 0xC7, 0x87, 0x2C, 0x55},
+		},
+		{
+			[]byte{0x20, 0x5B, 0x0B, 0x78, 0xD1, 0x72, 0xDC, 0x4D, 0x43, 0x40, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11},
+			[]byte{0xC4, 0x23, 0x27, 0x77, 0xEB, 0xD7, 0xE7, 0xE2, 0x5D, 0x17},
+		},
+	}
+	for _, tt := range tests {
+		if got := reedSolomonRemainder(tt.data, len(tt.want)); !bytes.Equal(got, tt.want) {
+			t.Errorf("reedSolomonRemainder(%X) = %X, want %X", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeSegmentNumeric(t *testing.T) {
+	// Mode 0001, count 8, then 012, 345 and 67 in 10, 10 and 7 bits.
+	want := "0001" + "0000001000" + "0000001100" + "0101011001" + "1000011"
+	var got strings.Builder
+	for _, bit := range encodeSegment("01234567", true) {
+		if bit {
+			got.WriteByte('1')
+		} else {
+			got.WriteByte('0')
+		}
+	}
+	if got.String() != want {
+		t.Errorf("encodeSegment(01234567) = %s, want %s", got.String(), want)
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	if _, err := Encode(strings.Repeat("x", dataCodewords[maxVersion])); !errors.Is(err, ErrDataTooLong) {
+		t.Errorf("Encode of too much data = %v, want ErrDataTooLong", err)
+	}
+}
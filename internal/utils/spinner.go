@@ -0,0 +1,52 @@
+// utils/spinner.go
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// spinnerFrames are the frames of the spinner, drawn in turn.
+const spinnerFrames = `|/-\`
+
+// SpinnerInterval is the interval between two frames of a spinner.
+const SpinnerInterval = 100 * time.Millisecond
+
+// StartSpinner draws a spinner with the label and the elapsed time on w, one frame per interval, until the
+// returned function is called. The first frame is drawn after one interval, so that quick work shows nothing.
+// Stopping waits for the spinner to finish, clears its line, and can be called more than once.
+func StartSpinner(w io.Writer, label string, interval time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		started := time.Now()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		drawn := false
+		for frame := 0; ; frame++ {
+			select {
+			case <-ctx.Done():
+				if drawn {
+					fmt.Fprint(w, "\r\033[K")
+				}
+				return
+			case <-ticker.C:
+				fmt.Fprintf(w, "\r%c %s %.1fs", spinnerFrames[frame%len(spinnerFrames)], label, time.Since(started).Seconds())
+				drawn = true
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cancel()
+			<-done
+		})
+	}
+}
@@ -0,0 +1,62 @@
+// utils/spinner_test.go
+
+package utils
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer that the spinner goroutine and the test can use at the same time.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestStartSpinner(t *testing.T) {
+	var out syncBuffer
+	stop := StartSpinner(&out, "Deriving", time.Millisecond)
+	deadline := time.Now().Add(5 * time.Second)
+	for strings.Count(out.String(), "Deriving") < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	stop()
+
+	output := out.String()
+	if !strings.HasPrefix(output, "\r| Deriving ") || !strings.Contains(output, "\r/ Deriving ") {
+		t.Errorf("spinner frames = %q, want | then / with the label", output)
+	}
+	if !strings.HasSuffix(output, "\r\033[K") {
+		t.Errorf("spinner output = %q, want its line cleared when stopped", output)
+	}
+
+	// Stopping waits for the spinner, which draws nothing more, and can be repeated.
+	stop()
+	time.Sleep(10 * time.Millisecond)
+	if out.String() != output {
+		t.Error("the spinner drew after it was stopped")
+	}
+}
+
+func TestStartSpinnerQuickWork(t *testing.T) {
+	var out syncBuffer
+	StartSpinner(&out, "Deriving", time.Hour)()
+	if got := out.String(); got != "" {
+		t.Errorf("spinner stopped before its first frame drew %q, want nothing", got)
+	}
+}
@@ -0,0 +1,74 @@
+// utils/timing.go
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrNoTimingEntropy indicates that too few input events were collected to extract timing entropy.
+var ErrNoTimingEntropy = errors.New("no timing entropy collected")
+
+// CollectTimingEntropy collects timing entropy from the user typing on stdin until ctx is done.
+// See CollectTimingEntropyFrom.
+func CollectTimingEntropy(ctx context.Context) ([]byte, error) {
+	return CollectTimingEntropyFrom(ctx, os.Stdin)
+}
+
+// CollectTimingEntropyFrom timestamps every read from r until ctx is done or r is exhausted, and extracts the
+// jitter between them with ExtractTimingBits. A terminal in its default line mode returns one read per line,
+// so the user should press Enter often. It returns ErrNoTimingEntropy if fewer than two reads were timestamped.
+func CollectTimingEntropyFrom(ctx context.Context, r io.Reader) ([]byte, error) {
+	events := make(chan time.Time, 64)
+	go func() {
+		defer close(events)
+		buf := make([]byte, 256)
+		for {
+			if _, err := r.Read(buf); err != nil {
+				return
+			}
+			select {
+			case events <- time.Now():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var timestamps []time.Time
+collect:
+	for {
+		select {
+		case timestamp, ok := <-events:
+			if !ok {
+				break collect
+			}
+			timestamps = append(timestamps, timestamp)
+		case <-ctx.Done():
+			break collect
+		}
+	}
+
+	entropy := ExtractTimingBits(timestamps)
+	if len(entropy) == 0 {
+		return nil, ErrNoTimingEntropy
+	}
+	return entropy, nil
+}
+
+// ExtractTimingBits returns the low 8 bits of the number of nanoseconds between each pair of consecutive
+// timestamps. Only the low bits of human input timing are unpredictable, so the high bits are dropped.
+func ExtractTimingBits(timestamps []time.Time) []byte {
+	if len(timestamps) < 2 {
+		return nil
+	}
+	entropy := make([]byte, len(timestamps)-1)
+	for i := range entropy {
+		entropy[i] = byte(timestamps[i+1].Sub(timestamps[i]).Nanoseconds())
+	}
+	return entropy
+}
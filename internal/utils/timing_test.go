@@ -0,0 +1,40 @@
+// utils/timing_test.go
+
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestExtractTimingBits(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	// Deltas of 0x1234, 0xff, 0x100 and 0x3b9aca07 (1s + 7ns) nanoseconds keep their low bytes.
+	timestamps := []time.Time{start}
+	for _, delta := range []time.Duration{0x1234, 0xff, 0x100, time.Second + 7} {
+		timestamps = append(timestamps, timestamps[len(timestamps)-1].Add(delta))
+	}
+	want := []byte{0x34, 0xff, 0x00, 0x07}
+	if got := ExtractTimingBits(timestamps); !bytes.Equal(got, want) {
+		t.Errorf("ExtractTimingBits = %x, want %x", got, want)
+	}
+	if got := ExtractTimingBits(timestamps[:1]); got != nil {
+		t.Errorf("ExtractTimingBits of a single timestamp = %x, want nil", got)
+	}
+}
+
+func TestCollectTimingEntropyFrom(t *testing.T) {
+	// One byte per read gives a timestamp per byte, and a byte of jitter between each pair of them.
+	entropy, err := CollectTimingEntropyFrom(context.Background(), iotest.OneByteReader(strings.NewReader("abcd")))
+	if err != nil || len(entropy) != 3 {
+		t.Errorf("CollectTimingEntropyFrom of 4 reads = %x (%v), want 3 bytes", entropy, err)
+	}
+	if _, err := CollectTimingEntropyFrom(context.Background(), strings.NewReader("")); !errors.Is(err, ErrNoTimingEntropy) {
+		t.Errorf("CollectTimingEntropyFrom without input = %v, want ErrNoTimingEntropy", err)
+	}
+}
@@ -3,10 +3,24 @@
 package utils
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"math"
+	"math/rand"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // ClearScreen clears the terminal screen.
@@ -14,6 +28,15 @@ func ClearScreen() {
 	fmt.Print("\033[H\033[2J")
 }
 
+// IsTerminal reports whether the file, such as os.Stdout, is a terminal rather than a pipe or a regular file.
+func IsTerminal(file interface{ Stat() (os.FileInfo, error) }) bool {
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
 var Debug bool
 
 const (
@@ -56,7 +79,7 @@ type wavHeaderData struct {
 	Format        [4]byte // "WAVE"
 	SubChunk1ID   [4]byte // "fmt "
 	SubChunk1Size uint32  // 16 for PCM
-	AudioFormat   uint16  // PCM = 1
+	AudioFormat   uint16  // PCM = 1, IEEE float = 3
 	NumChannels   uint16  // Mono = 1, Stereo = 2, etc.
 	SampleRate    uint32  // 8000, 44100, etc.
 	ByteRate      uint32  // SampleRate * NumChannels * BitsPerSample/8
@@ -66,8 +89,14 @@ type wavHeaderData struct {
 	SubChunk2Size uint32  // data size in bytes
 }
 
+// WAV audio format codes.
+const (
+	AudioFormatPCM       = 1 // Linear quantization
+	AudioFormatIEEEFloat = 3 // IEEE 754 floating point
+)
+
 // newWAVHeader creates a new WAV header based on the input parameters.
-func newWAVHeader(sampleRate, numChannels, bitsPerSample, dataLength int) *wavHeaderData {
+func newWAVHeader(audioFormat, sampleRate, numChannels, bitsPerSample, dataLength int) *wavHeaderData {
 	byteRate := sampleRate * numChannels * bitsPerSample / 8
 	blockAlign := numChannels * bitsPerSample / 8
 
@@ -77,7 +106,7 @@ func newWAVHeader(sampleRate, numChannels, bitsPerSample, dataLength int) *wavHe
 		Format:        [4]byte{'W', 'A', 'V', 'E'},
 		SubChunk1ID:   [4]byte{'f', 'm', 't', ' '},
 		SubChunk1Size: 16, // For PCM
-		AudioFormat:   1,  // PCM = 1 (i.e., Linear quantization)
+		AudioFormat:   uint16(audioFormat),
 		NumChannels:   uint16(numChannels),
 		SampleRate:    uint32(sampleRate),
 		ByteRate:      uint32(byteRate),
@@ -88,8 +117,81 @@ func newWAVHeader(sampleRate, numChannels, bitsPerSample, dataLength int) *wavHe
 	}
 }
 
+// WAVFormat describes the layout of the audio data stored in a WAV file.
+type WAVFormat struct {
+	AudioFormat   int
+	SampleRate    int
+	NumChannels   int
+	BitsPerSample int
+}
+
+// DefaultWAVFormat is the format of the audio recorded from the microphone.
+var DefaultWAVFormat = WAVFormat{AudioFormat: AudioFormatPCM, SampleRate: 44100, NumChannels: 1, BitsPerSample: 16}
+
+// FloatWAVFormat is the 32-bit IEEE float variant of DefaultWAVFormat.
+var FloatWAVFormat = WAVFormat{AudioFormat: AudioFormatIEEEFloat, SampleRate: 44100, NumChannels: 1, BitsPerSample: 32}
+
+// blockAlign returns the size in bytes of one frame (one sample for every channel).
+func (f WAVFormat) blockAlign() int {
+	return f.NumChannels * f.BitsPerSample / 8
+}
+
+// Validate checks that the format describes a usable PCM or IEEE float layout.
+func (f WAVFormat) Validate() error {
+	switch f.AudioFormat {
+	case AudioFormatPCM:
+	case AudioFormatIEEEFloat:
+		if f.BitsPerSample != 32 {
+			return fmt.Errorf("invalid bits per sample for IEEE float: %d", f.BitsPerSample)
+		}
+	default:
+		return fmt.Errorf("unsupported audio format: %d", f.AudioFormat)
+	}
+	if f.SampleRate <= 0 {
+		return fmt.Errorf("invalid sample rate: %d", f.SampleRate)
+	}
+	if f.NumChannels <= 0 {
+		return fmt.Errorf("invalid channel count: %d", f.NumChannels)
+	}
+	if f.BitsPerSample <= 0 || f.BitsPerSample%8 != 0 {
+		return fmt.Errorf("invalid bits per sample: %d", f.BitsPerSample)
+	}
+	return nil
+}
+
+// ErrTruncatedPCM indicates that raw PCM data does not end on a frame boundary.
+var ErrTruncatedPCM = errors.New("truncated PCM data")
+
+// ReadPCM reads headerless little-endian PCM data in the given format from r until EOF.
+func ReadPCM(r io.Reader, format WAVFormat) ([]byte, error) {
+	if err := format.Validate(); err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading PCM data: %w", err)
+	}
+
+	// Raw PCM has no header, so a partial frame means the input was cut short.
+	if len(data)%format.blockAlign() != 0 {
+		return nil, fmt.Errorf("%w: %d bytes is not a multiple of the %d-byte frame size", ErrTruncatedPCM, len(data), format.blockAlign())
+	}
+
+	return data, nil
+}
+
 // SaveAudioDataToFile saves the audio data to a file as a WAV file.
 func SaveAudioDataToFile(filename string, data []byte) error {
+	return SaveAudioDataToFileWithFormat(filename, data, DefaultWAVFormat)
+}
+
+// SaveAudioDataToFileWithFormat saves the audio data to a file as a WAV file with the given format.
+func SaveAudioDataToFileWithFormat(filename string, data []byte, format WAVFormat) error {
+	if err := format.Validate(); err != nil {
+		return err
+	}
+
 	// Create the file
 	file, err := os.Create(filename)
 	if err != nil {
@@ -97,16 +199,47 @@ func SaveAudioDataToFile(filename string, data []byte) error {
 	}
 	defer file.Close()
 
+	return writeWAV(file, data, format)
+}
+
+// SaveRawPCMToFile saves audio data as raw PCM, without a WAV header.
+func SaveRawPCMToFile(filename string, data []byte) error {
+	return os.WriteFile(filename, data, 0644)
+}
+
+// SaveCompressedAudioDataToFile saves the audio data to a gzip-compressed WAV file with the given format.
+// The Load functions decompress such files transparently.
+func SaveCompressedAudioDataToFile(filename string, data []byte, format WAVFormat) error {
+	if err := format.Validate(); err != nil {
+		return err
+	}
+
+	// Create the file
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := gzip.NewWriter(file)
+	if err := writeWAV(writer, data, format); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// writeWAV writes the WAV header and the audio data.
+func writeWAV(w io.Writer, data []byte, format WAVFormat) error {
 	// Create the WAV header
-	header := newWAVHeader(44100, 1, 16, len(data))
+	header := newWAVHeader(format.AudioFormat, format.SampleRate, format.NumChannels, format.BitsPerSample, len(data))
 	// Write the WAV header
-	err = binary.Write(file, binary.LittleEndian, header)
+	err := binary.Write(w, binary.LittleEndian, header)
 	if err != nil {
 		return err
 	}
 
 	// Write the audio data
-	err = binary.Write(file, binary.LittleEndian, data)
+	err = binary.Write(w, binary.LittleEndian, data)
 	if err != nil {
 		return err
 	}
@@ -114,6 +247,238 @@ func SaveAudioDataToFile(filename string, data []byte) error {
 	return nil
 }
 
+// EncodeWAV returns the bytes of the WAV file SaveAudioDataToFileWithFormat writes for the audio data.
+func EncodeWAV(data []byte, format WAVFormat) ([]byte, error) {
+	if err := format.Validate(); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := writeWAV(&buf, data, format); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// gzipMagic starts every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// openWAV opens a WAV file for reading, decompressing it if it is gzip-compressed.
+func openWAV(filename string) (io.ReadCloser, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(file)
+	magic, _ := reader.Peek(len(gzipMagic))
+	if !bytes.Equal(magic, gzipMagic) {
+		return struct {
+			io.Reader
+			io.Closer
+		}{reader, file}, nil
+	}
+
+	decompressor, err := gzip.NewReader(reader)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWAV, err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{decompressor, file}, nil
+}
+
+// ErrInvalidWAV indicates that a file is not a WAV file this package can read.
+var ErrInvalidWAV = errors.New("invalid WAV file")
+
+// ErrAudioDataMismatch indicates that the audio data read back from disk differs from the expected data.
+var ErrAudioDataMismatch = errors.New("saved audio data does not match")
+
+// ErrMnemonicMismatch indicates that the mnemonic read back from disk differs from the expected mnemonic.
+var ErrMnemonicMismatch = errors.New("saved mnemonic does not match")
+
+// readWAVHeader reads and validates a canonical 44-byte PCM WAV header.
+func readWAVHeader(r io.Reader) (*wavHeaderData, error) {
+	header := &wavHeaderData{}
+	if err := binary.Read(r, binary.LittleEndian, header); err != nil {
+		return nil, fmt.Errorf("%w: reading header: %v", ErrInvalidWAV, err)
+	}
+
+	if header.ChunkID != [4]byte{'R', 'I', 'F', 'F'} ||
+		header.Format != [4]byte{'W', 'A', 'V', 'E'} ||
+		header.SubChunk1ID != [4]byte{'f', 'm', 't', ' '} ||
+		header.SubChunk2ID != [4]byte{'d', 'a', 't', 'a'} {
+		return nil, fmt.Errorf("%w: unexpected chunk identifiers", ErrInvalidWAV)
+	}
+	if header.BlockAlign == 0 {
+		return nil, fmt.Errorf("%w: zero block alignment", ErrInvalidWAV)
+	}
+
+	return header, nil
+}
+
+// LoadAudioDataFromFile reads a WAV file written by SaveAudioDataToFile and returns its audio data.
+func LoadAudioDataFromFile(filename string) ([]byte, error) {
+	data, _, err := LoadAudioDataFromFileWithFormat(filename)
+	return data, err
+}
+
+// LoadAudioDataFromFileWithFormat reads a WAV file, possibly gzip-compressed, and returns its audio data along with its format.
+func LoadAudioDataFromFileWithFormat(filename string) ([]byte, WAVFormat, error) {
+	file, err := openWAV(filename)
+	if err != nil {
+		return nil, WAVFormat{}, err
+	}
+	defer file.Close()
+
+	header, err := readWAVHeader(file)
+	if err != nil {
+		return nil, WAVFormat{}, err
+	}
+
+	// Read exactly the amount of data announced by the header.
+	data := make([]byte, header.SubChunk2Size)
+	if _, err := io.ReadFull(file, data); err != nil {
+		return nil, WAVFormat{}, fmt.Errorf("%w: reading data: %v", ErrInvalidWAV, err)
+	}
+
+	format := WAVFormat{
+		AudioFormat:   int(header.AudioFormat),
+		SampleRate:    int(header.SampleRate),
+		NumChannels:   int(header.NumChannels),
+		BitsPerSample: int(header.BitsPerSample),
+	}
+
+	return data, format, nil
+}
+
+// ErrWAVFormatMismatch indicates that audio data cannot be appended to a WAV file of a different format.
+var ErrWAVFormatMismatch = errors.New("WAV format mismatch")
+
+// AppendAudioDataToFile appends the audio data to a WAV file of the same format, updating the sizes in its header,
+// and returns the combined audio data. The file is created if it does not exist.
+func AppendAudioDataToFile(filename string, data []byte, format WAVFormat) ([]byte, error) {
+	existing, existingFormat, err := LoadAudioDataFromFileWithFormat(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return data, SaveAudioDataToFileWithFormat(filename, data, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if existingFormat != format {
+		return nil, fmt.Errorf("%w: %s has %d Hz, %d channel(s), %d bits, format %d",
+			ErrWAVFormatMismatch, filename, existingFormat.SampleRate, existingFormat.NumChannels,
+			existingFormat.BitsPerSample, existingFormat.AudioFormat)
+	}
+
+	// Rewrite the whole file, which also drops anything after the data chunk.
+	combined := append(existing[:len(existing):len(existing)], data...)
+	if err := SaveAudioDataToFileWithFormat(filename, combined, format); err != nil {
+		return nil, err
+	}
+	return combined, nil
+}
+
+// WAVInfo describes the properties of a WAV file.
+type WAVInfo struct {
+	WAVFormat
+	NumSamples int // Number of frames, i.e. samples per channel
+	Duration   time.Duration
+}
+
+// InspectWAV reads the header of a WAV file and returns its properties.
+func InspectWAV(filename string) (WAVInfo, error) {
+	file, err := openWAV(filename)
+	if err != nil {
+		return WAVInfo{}, err
+	}
+	defer file.Close()
+
+	header, err := readWAVHeader(file)
+	if err != nil {
+		return WAVInfo{}, err
+	}
+	if header.SampleRate == 0 {
+		return WAVInfo{}, fmt.Errorf("%w: zero sample rate", ErrInvalidWAV)
+	}
+
+	numSamples := int(header.SubChunk2Size) / int(header.BlockAlign)
+	return WAVInfo{
+		WAVFormat: WAVFormat{
+			AudioFormat:   int(header.AudioFormat),
+			SampleRate:    int(header.SampleRate),
+			NumChannels:   int(header.NumChannels),
+			BitsPerSample: int(header.BitsPerSample),
+		},
+		NumSamples: numSamples,
+		Duration:   time.Duration(numSamples) * time.Second / time.Duration(header.SampleRate),
+	}, nil
+}
+
+// VerifyAudioDataFile re-reads a saved WAV file and checks that its sample count and content match data.
+func VerifyAudioDataFile(filename string, data []byte) error {
+	file, err := openWAV(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	header, err := readWAVHeader(file)
+	if err != nil {
+		return err
+	}
+
+	// Compare the number of samples announced by the header with the expected one.
+	expectedSamples := len(data) / int(header.BlockAlign)
+	storedSamples := int(header.SubChunk2Size) / int(header.BlockAlign)
+	if storedSamples != expectedSamples {
+		return fmt.Errorf("%w: header has %d samples, expected %d", ErrAudioDataMismatch, storedSamples, expectedSamples)
+	}
+
+	// Compare the payload itself, including any trailing bytes.
+	stored, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(stored, data) {
+		return fmt.Errorf("%w: payload differs", ErrAudioDataMismatch)
+	}
+
+	return nil
+}
+
+// ErrShortEntropyRead indicates that an entropy source returned fewer bytes than requested.
+var ErrShortEntropyRead = errors.New("short entropy read")
+
+// ReadEntropyFromFile reads n bytes from a file or device such as /dev/hwrng.
+func ReadEntropyFromFile(filename string, n int) ([]byte, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("invalid entropy size: %d", n)
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return nil, fmt.Errorf("%w (devices such as /dev/hwrng are usually only readable by root)", err)
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	// Devices may return less than requested per read, so keep reading until n bytes are collected.
+	data := make([]byte, n)
+	read, err := io.ReadFull(file, data)
+	if err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("%w: got %d of %d bytes from %s", ErrShortEntropyRead, read, n, filename)
+		}
+		return nil, fmt.Errorf("error reading entropy from %s: %w", filename, err)
+	}
+
+	return data, nil
+}
+
 // SaveMnemonicToFile saves the mnemonic to a file.
 func SaveMnemonicToFile(filename string, mnemonic string) error {
 	// Create the file
@@ -132,14 +497,305 @@ func SaveMnemonicToFile(filename string, mnemonic string) error {
 	return nil
 }
 
-// Float32ToByteSlice converts a float32 slice to a byte slice.
+// Float32ToByteSlice converts a float32 slice to a byte slice of little-endian 16-bit samples.
 func Float32ToByteSlice(floats []float32) []byte {
-	bytes := make([]byte, 4*len(floats))
+	return Float32ToByteSliceWithOrder(floats, binary.LittleEndian)
+}
+
+// Float32ToByteSliceWithOrder converts a float32 slice to a byte slice of 16-bit samples in the given byte order.
+func Float32ToByteSliceWithOrder(floats []float32, order binary.ByteOrder) []byte {
+	bytes := make([]byte, 2*len(floats))
 	for i, f := range floats {
-		// Convert the float to a scaled int16
+		// Clamp the float to [-1, 1], where NaN counts as silence, and convert it to a scaled int16
+		switch {
+		case f > 1:
+			f = 1
+		case f < -1:
+			f = -1
+		case math.IsNaN(float64(f)):
+			f = 0
+		}
 		val := int16(f * 32767)
 		// Write the int16 to bytes
-		binary.LittleEndian.PutUint16(bytes[i*2:], uint16(val))
+		order.PutUint16(bytes[i*2:], uint16(val))
 	}
 	return bytes
 }
+
+// SaveMnemonicToCSV saves the words of a mnemonic as CSV rows of 1-based position, word, and wordlist index.
+// The file is only readable by its owner.
+func SaveMnemonicToCSV(filename string, mnemonic string, indices []int) error {
+	words := strings.Fields(mnemonic)
+	if len(words) != len(indices) {
+		return fmt.Errorf("mnemonic has %d words but %d indices were given", len(words), len(indices))
+	}
+
+	// Create the file
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Write the header and one row per word
+	writer := csv.NewWriter(file)
+	if err := writer.Write([]string{"position", "word", "index"}); err != nil {
+		return err
+	}
+	for i, word := range words {
+		if err := writer.Write([]string{strconv.Itoa(i + 1), word, strconv.Itoa(indices[i])}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+
+	return writer.Error()
+}
+
+// MnemonicJSON is the JSON document written by SaveMnemonicToJSON.
+type MnemonicJSON struct {
+	Scheme   int      `json:"scheme"`
+	Mnemonic string   `json:"mnemonic"`
+	Words    []string `json:"words"`
+	Indices  []int    `json:"indices"`
+	// AudioHash is the hex SHA-256 hash of the audio the mnemonic was generated from.
+	AudioHash string `json:"audio_hash"`
+}
+
+// SaveMnemonicToJSON saves the mnemonic as an indented JSON document, readable only by the owner.
+func SaveMnemonicToJSON(filename string, document MnemonicJSON) error {
+	data, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0600)
+}
+
+// ParamsJSON records the parameters a mnemonic was derived with, saved by SaveParamsToJSON. It never holds
+// the mnemonic or the random entropy, so only mnemonics derived without random entropy can be reproduced from it.
+type ParamsJSON struct {
+	Scheme   int    `json:"scheme"`
+	SeedType string `json:"seed_type"`
+	// Words and TruncateMode are the length of BIP-39 mnemonics and how their entropy is taken from 256 bits.
+	Words        int    `json:"words,omitempty"`
+	TruncateMode string `json:"truncate_mode,omitempty"`
+	// PasswordLength and PasswordAlphabet describe the password generated instead of a mnemonic with -password.
+	PasswordLength   int    `json:"password_length,omitempty"`
+	PasswordAlphabet string `json:"password_alphabet,omitempty"`
+	Hash             string `json:"hash"`
+	// Mixer is how the mnemonic input is derived: "brain-song", "hkdf", "split" or "combined-hash".
+	Mixer string `json:"mixer"`
+	// Split is the RNG:audio bit budget of the "split" mixer.
+	Split               string `json:"split,omitempty"`
+	BrainSongIterations int    `json:"brain_song_iterations,omitempty"`
+	// EntropyPassphrase reports whether a memorized passphrase, not recorded here, was folded into the entropy.
+	EntropyPassphrase bool `json:"entropy_passphrase,omitempty"`
+	// Personalization is the application personalization of the scheme tag (see -personalize).
+	Personalization string `json:"personalization,omitempty"`
+	// Order is the order of the generated entropy and the audio hash in the data of the "combined-hash" mixer.
+	Order      string `json:"order,omitempty"`
+	HashRounds int    `json:"hash_rounds"`
+	Count      int    `json:"count"`
+	SampleRate int    `json:"sample_rate"`
+	Channels   int    `json:"channels"`
+	BitDepth   string `json:"bit_depth"`
+	Downmix    bool   `json:"downmix"`
+	Decimate   int    `json:"decimate"`
+	InputFile  string `json:"input_file,omitempty"`
+	// InputFileHash is the hex SHA-256 hash of the contents of the input file.
+	InputFileHash string `json:"input_file_sha256,omitempty"`
+	// AudioHash is the hex SHA-256 hash of the audio the mnemonic was generated from.
+	AudioHash string `json:"audio_hash"`
+	// Reproducible reports whether the mnemonic can be derived again from the audio and these parameters.
+	Reproducible bool `json:"reproducible"`
+}
+
+// SaveParamsToJSON saves the parameters as an indented JSON document, readable only by the owner, as the audio
+// hash and parameters they hold reproduce the mnemonics derived without random entropy.
+func SaveParamsToJSON(filename string, params ParamsJSON) error {
+	data, err := json.MarshalIndent(params, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0600)
+}
+
+// ReportJSON is the audit report of a recording saved by SaveReportToJSON. It never holds the mnemonic.
+type ReportJSON struct {
+	SampleRate       int     `json:"sample_rate"`
+	Channels         int     `json:"channels"`
+	Duration         float64 `json:"duration_seconds"`
+	DiscardedBuffers int     `json:"discarded_buffers"`
+	// TopUpBytes is the number of bytes of the system RNG added to make up for too short audio (see -topup).
+	TopUpBytes int     `json:"topup_bytes"`
+	RMS        float64 `json:"rms"`
+	Peak       float64 `json:"peak"`
+	DCOffset   float64 `json:"dc_offset"`
+	// RemovedDCOffset is the DC offset of the audio before -remove-dc subtracted it.
+	RemovedDCOffset  float64 `json:"removed_dc_offset,omitempty"`
+	ShannonEntropy   float64 `json:"shannon_entropy"`
+	MinEntropy       float64 `json:"min_entropy"`
+	SpectralFlatness float64 `json:"spectral_flatness"`
+	Periodicity      float64 `json:"periodicity"`
+	MainsHum         float64 `json:"mains_hum"`
+	NoiseFloor       float64 `json:"noise_floor"`
+	// SNR is the signal-to-noise ratio in dB of the RMS over the noise floor, omitted when the floor is zero.
+	SNR      *float64 `json:"snr_db,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+	// AudioHash is the hex SHA-256 hash of the audio the mnemonic was generated from.
+	AudioHash string `json:"audio_hash"`
+}
+
+// SaveReportToJSON saves the report as an indented JSON document, readable only by the owner, as the audio hash
+// it holds feeds the mnemonic.
+func SaveReportToJSON(filename string, report ReportJSON) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0600)
+}
+
+// ErrSymlink indicates an output path that is, or is in a directory that is, a symbolic link.
+var ErrSymlink = errors.New("output path is a symlink")
+
+// CheckNotSymlink checks with os.Lstat that neither filename nor any directory on its path is a symbolic link,
+// which could redirect a secret written to it elsewhere. The directories of a relative filename are checked up
+// to the working directory. A filename that does not exist yet is fine.
+func CheckNotSymlink(filename string) error {
+	for path := filepath.Clean(filename); ; path = filepath.Dir(path) {
+		info, err := os.Lstat(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%w: %s", ErrSymlink, path)
+		}
+		if parent := filepath.Dir(path); parent == path || parent == "." {
+			return nil
+		}
+	}
+}
+
+// SaveSecretToFile saves data to a file readable only by the owner.
+func SaveSecretToFile(filename string, data []byte) error {
+	return os.WriteFile(filename, data, 0600)
+}
+
+// SaveSecretToFileAtomically saves data to a file readable only by the owner, through a temporary file in the
+// same directory renamed over it, so that the file is never left partially written.
+func SaveSecretToFileAtomically(filename string, data []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name()) // No-op once renamed.
+
+	if err := file.Chmod(0600); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), filename)
+}
+
+// SaveImageToPNG saves an image as a PNG file readable only by the owner.
+func SaveImageToPNG(filename string, img image.Image) error {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+	return SaveSecretToFile(filename, buf.Bytes())
+}
+
+// LoadMnemonicFromFile reads a mnemonic saved by SaveMnemonicToFile.
+func LoadMnemonicFromFile(filename string) (string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// DitherQuantize16 converts a float32 slice to a byte slice of little-endian 16-bit samples,
+// adding triangular-PDF dither of ±1 LSB before rounding to decorrelate the quantization noise.
+func DitherQuantize16(floats []float32) []byte {
+	bytes := make([]byte, 2*len(floats))
+	for i, f := range floats {
+		// The sum of two uniform values in [-0.5, 0.5) has a triangular distribution over (-1, 1). The dither only
+		// shapes the quantization noise of the saved recording and is never hashed, so the global math/rand
+		// source is enough and how it is seeded does not matter.
+		dither := rand.Float64() - rand.Float64()
+		scaled := math.Round(float64(f)*32767 + dither)
+		if scaled > math.MaxInt16 {
+			scaled = math.MaxInt16
+		} else if scaled < math.MinInt16 {
+			scaled = math.MinInt16
+		}
+		binary.LittleEndian.PutUint16(bytes[i*2:], uint16(int16(scaled)))
+	}
+	return bytes
+}
+
+// Float32ToFloatByteSlice converts a float32 slice to a byte slice of little-endian IEEE float samples.
+func Float32ToFloatByteSlice(floats []float32) []byte {
+	return Float32ToFloatByteSliceWithOrder(floats, binary.LittleEndian)
+}
+
+// Float32ToFloatByteSliceWithOrder converts a float32 slice to a byte slice of IEEE float samples
+// in the given byte order.
+func Float32ToFloatByteSliceWithOrder(floats []float32, order binary.ByteOrder) []byte {
+	bytes := make([]byte, 4*len(floats))
+	for i, f := range floats {
+		order.PutUint32(bytes[i*4:], math.Float32bits(f))
+	}
+	return bytes
+}
+
+// EncodeSamples converts float32 samples to the byte layout of the given WAV format.
+func EncodeSamples(samples []float32, format WAVFormat) ([]byte, error) {
+	return EncodeSamplesWithOrder(samples, format, binary.LittleEndian)
+}
+
+// EncodeSamplesWithOrder converts float32 samples to the sample encoding of the given WAV format in the given
+// byte order. WAV files are always little-endian; other byte orders are only meant for raw PCM.
+func EncodeSamplesWithOrder(samples []float32, format WAVFormat, order binary.ByteOrder) ([]byte, error) {
+	switch {
+	case format.AudioFormat == AudioFormatPCM && format.BitsPerSample == 16:
+		return Float32ToByteSliceWithOrder(samples, order), nil
+	case format.AudioFormat == AudioFormatIEEEFloat && format.BitsPerSample == 32:
+		return Float32ToFloatByteSliceWithOrder(samples, order), nil
+	default:
+		return nil, fmt.Errorf("unsupported sample encoding: format %d, %d bits", format.AudioFormat, format.BitsPerSample)
+	}
+}
+
+// DecodeSamples converts audio data in the given WAV format to float32 samples.
+func DecodeSamples(data []byte, format WAVFormat) ([]float32, error) {
+	switch {
+	case format.AudioFormat == AudioFormatPCM && format.BitsPerSample == 16:
+		samples := make([]float32, len(data)/2)
+		for i := range samples {
+			samples[i] = float32(int16(binary.LittleEndian.Uint16(data[i*2:]))) / 32767
+		}
+		return samples, nil
+	case format.AudioFormat == AudioFormatIEEEFloat && format.BitsPerSample == 32:
+		samples := make([]float32, len(data)/4)
+		for i := range samples {
+			samples[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+		}
+		return samples, nil
+	default:
+		return nil, fmt.Errorf("unsupported sample encoding: format %d, %d bits", format.AudioFormat, format.BitsPerSample)
+	}
+}
@@ -0,0 +1,369 @@
+// utils/utils_test.go
+
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestVerifyAudioDataFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audio.wav")
+	data := Float32ToByteSlice([]float32{0, 0.25, -0.5, 1, -1, 0.125})
+	if err := SaveAudioDataToFile(filename, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyAudioDataFile(filename, data); err != nil {
+		t.Fatalf("VerifyAudioDataFile of an intact file: %v", err)
+	}
+
+	// Flip a bit of the payload, after the 44-byte header.
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents[44+3] ^= 0x01
+	if err := os.WriteFile(filename, contents, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyAudioDataFile(filename, data); !errors.Is(err, ErrAudioDataMismatch) {
+		t.Errorf("VerifyAudioDataFile of a corrupted payload = %v, want ErrAudioDataMismatch", err)
+	}
+}
+
+func TestVerifyAudioDataFileTruncated(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audio.wav")
+	data := Float32ToByteSlice([]float32{0.5, -0.5, 0.25, -0.25})
+	if err := SaveAudioDataToFile(filename, data); err != nil {
+		t.Fatal(err)
+	}
+
+	// Drop the last sample, so that the header announces more samples than the file holds.
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filename, contents[:len(contents)-2], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyAudioDataFile(filename, data); !errors.Is(err, ErrAudioDataMismatch) {
+		t.Errorf("VerifyAudioDataFile of a truncated file = %v, want ErrAudioDataMismatch", err)
+	}
+
+	// A file that is not a WAV file at all fails on its header.
+	if err := os.WriteFile(filename, []byte("not a wav file, just some text padding it out to 44 bytes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyAudioDataFile(filename, data); !errors.Is(err, ErrInvalidWAV) {
+		t.Errorf("VerifyAudioDataFile of a non-WAV file = %v, want ErrInvalidWAV", err)
+	}
+}
+
+func TestReadPCM(t *testing.T) {
+	format := WAVFormat{AudioFormat: AudioFormatPCM, SampleRate: 8000, NumChannels: 2, BitsPerSample: 16}
+	pcm := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	data, err := ReadPCM(bytes.NewReader(pcm), format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, pcm) {
+		t.Errorf("ReadPCM = %v, want %v", data, pcm)
+	}
+
+	// 6 bytes are a frame and a half of 16-bit stereo.
+	if _, err := ReadPCM(bytes.NewReader(pcm[:6]), format); !errors.Is(err, ErrTruncatedPCM) {
+		t.Errorf("ReadPCM of a partial frame = %v, want ErrTruncatedPCM", err)
+	}
+
+	format.SampleRate = 0
+	if _, err := ReadPCM(bytes.NewReader(pcm), format); err == nil {
+		t.Error("ReadPCM without a sample rate succeeded")
+	}
+}
+
+func TestSaveFloatWAV(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "float.wav")
+	samples := []float32{0, 0.1, -0.7, 1, -1, 0.333}
+	data, err := EncodeSamples(samples, FloatWAVFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveAudioDataToFileWithFormat(filename, data, FloatWAVFormat); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	header, err := readWAVHeader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.AudioFormat != AudioFormatIEEEFloat || header.BitsPerSample != 32 {
+		t.Errorf("header format %d, %d bits, want %d, 32 bits", header.AudioFormat, header.BitsPerSample, AudioFormatIEEEFloat)
+	}
+	if int(header.SubChunk2Size) != 4*len(samples) {
+		t.Errorf("payload of %d bytes, want %d", header.SubChunk2Size, 4*len(samples))
+	}
+
+	// The samples are stored as they are, without quantization.
+	loaded, format, err := LoadAudioDataFromFileWithFormat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeSamples(loaded, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != len(samples) {
+		t.Fatalf("decoded %d samples, want %d", len(decoded), len(samples))
+	}
+	for i := range samples {
+		if decoded[i] != samples[i] {
+			t.Errorf("sample %d = %v, want %v", i, decoded[i], samples[i])
+		}
+	}
+}
+
+func TestDitherQuantize16(t *testing.T) {
+	samples := make([]float32, 4096)
+	for i := range samples {
+		samples[i] = float32(i%200-100) / 1000
+	}
+	if bytes.Equal(DitherQuantize16(samples), Float32ToByteSlice(samples)) {
+		t.Error("dithered samples equal the plainly quantized ones")
+	}
+
+	// Silence only gets the dither, which never exceeds one step.
+	silence := DitherQuantize16(make([]float32, 4096))
+	for i := 0; i < len(silence); i += 2 {
+		if sample := int16(binary.LittleEndian.Uint16(silence[i:])); sample < -1 || sample > 1 {
+			t.Fatalf("dithered silence sample %d = %d, want within ±1", i/2, sample)
+		}
+	}
+}
+
+func TestInspectWAV(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "stereo.wav")
+	format := WAVFormat{AudioFormat: AudioFormatPCM, SampleRate: 8000, NumChannels: 2, BitsPerSample: 16}
+	// Half a second of 16-bit stereo at 8 kHz: 4000 frames of 4 bytes.
+	if err := SaveAudioDataToFileWithFormat(filename, make([]byte, 4000*4), format); err != nil {
+		t.Fatal(err)
+	}
+	info, err := InspectWAV(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.WAVFormat != format {
+		t.Errorf("InspectWAV format = %+v, want %+v", info.WAVFormat, format)
+	}
+	if info.NumSamples != 4000 {
+		t.Errorf("InspectWAV samples = %d, want 4000", info.NumSamples)
+	}
+	if info.Duration != 500*time.Millisecond {
+		t.Errorf("InspectWAV duration = %v, want 500ms", info.Duration)
+	}
+}
+
+func TestFloat32ToByteSliceClamps(t *testing.T) {
+	floats := []float32{0.5, 1, 1.5, -1, -3, float32(math.Inf(1)), float32(math.Inf(-1)), float32(math.NaN())}
+	want := []int16{16383, 32767, 32767, -32767, -32767, 32767, -32767, 0}
+	data := Float32ToByteSlice(floats)
+	for i, w := range want {
+		if got := int16(binary.LittleEndian.Uint16(data[i*2:])); got != w {
+			t.Errorf("sample %v = %d, want %d", floats[i], got, w)
+		}
+	}
+}
+
+func TestFloat32ToByteSliceHash(t *testing.T) {
+	// The hashed audio data is two bytes per sample, without padding: its hash feeds the mnemonic, so any change
+	// to this encoding changes the mnemonic of every recording.
+	data := Float32ToByteSlice([]float32{0, 0.5, -0.5, 1, -1, 0.25})
+	if got, want := hex.EncodeToString(data), "0000ff3f01c0ff7f0180ff1f"; got != want {
+		t.Errorf("Float32ToByteSlice = %s, want %s", got, want)
+	}
+	sum := sha256.Sum256(data)
+	if got, want := hex.EncodeToString(sum[:]), "98cd54df8a7d187cd75ce835d753eae1690bd3d0183f9026c7310aaeca1182ed"; got != want {
+		t.Errorf("hash of the encoded samples = %s, want %s", got, want)
+	}
+}
+
+func TestEncodeSamplesWithOrder(t *testing.T) {
+	samples := []float32{0.5, -0.25}
+	tests := []struct {
+		format WAVFormat
+		little []byte
+		big    []byte
+	}{
+		// 16383 = 0x3fff and -8191 = 0xe001.
+		{WAVFormat{AudioFormat: AudioFormatPCM, BitsPerSample: 16}, []byte{0xff, 0x3f, 0x01, 0xe0}, []byte{0x3f, 0xff, 0xe0, 0x01}},
+		// 0.5 = 0x3f000000 and -0.25 = 0xbe800000.
+		{WAVFormat{AudioFormat: AudioFormatIEEEFloat, BitsPerSample: 32}, []byte{0, 0, 0, 0x3f, 0, 0, 0x80, 0xbe}, []byte{0x3f, 0, 0, 0, 0xbe, 0x80, 0, 0}},
+	}
+	for _, tt := range tests {
+		for _, order := range []struct {
+			order binary.ByteOrder
+			want  []byte
+		}{{binary.LittleEndian, tt.little}, {binary.BigEndian, tt.big}} {
+			got, err := EncodeSamplesWithOrder(samples, tt.format, order.order)
+			if err != nil || !bytes.Equal(got, order.want) {
+				t.Errorf("%d-bit %v encoding = %x (%v), want %x", tt.format.BitsPerSample, order.order, got, err, order.want)
+			}
+		}
+	}
+	if little := Float32ToByteSlice(samples); !bytes.Equal(little, tests[0].little) {
+		t.Errorf("Float32ToByteSlice = %x, want the little-endian %x", little, tests[0].little)
+	}
+}
+
+func TestAppendAudioDataToFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "partial.wav")
+	first := Float32ToByteSlice([]float32{0.1, 0.2, 0.3})
+	second := Float32ToByteSlice([]float32{-0.1, -0.2})
+
+	// Appending to a missing file creates it.
+	combined, err := AppendAudioDataToFile(filename, first, DefaultWAVFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(combined, first) {
+		t.Errorf("first append = %v, want %v", combined, first)
+	}
+	combined, err = AppendAudioDataToFile(filename, second, DefaultWAVFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append(append([]byte{}, first...), second...)
+	if !bytes.Equal(combined, want) {
+		t.Errorf("second append = %v, want %v", combined, want)
+	}
+
+	// The header of the rewritten file describes the five samples.
+	info, err := InspectWAV(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.NumSamples != 5 || info.WAVFormat != DefaultWAVFormat {
+		t.Errorf("InspectWAV = %d samples of %+v, want 5 of %+v", info.NumSamples, info.WAVFormat, DefaultWAVFormat)
+	}
+	loaded, err := LoadAudioDataFromFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(loaded, want) {
+		t.Errorf("loaded data = %v, want %v", loaded, want)
+	}
+
+	stereo := DefaultWAVFormat
+	stereo.NumChannels = 2
+	if _, err := AppendAudioDataToFile(filename, second, stereo); !errors.Is(err, ErrWAVFormatMismatch) {
+		t.Errorf("appending stereo to mono = %v, want ErrWAVFormatMismatch", err)
+	}
+}
+
+func TestCompressedWAVRoundTrip(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audio-data.wav.gz")
+	data := Float32ToByteSlice([]float32{0.1, -0.2, 0.3, -0.4, 0.5, 0, 0, 0})
+	format := WAVFormat{AudioFormat: AudioFormatPCM, SampleRate: 22050, NumChannels: 2, BitsPerSample: 16}
+	if err := SaveCompressedAudioDataToFile(filename, data, format); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file is gzip data, which the loader decompresses transparently.
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(contents, gzipMagic) {
+		t.Errorf("compressed file starts with %x, want the gzip magic number", contents[:2])
+	}
+	loaded, loadedFormat, err := LoadAudioDataFromFileWithFormat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(loaded, data) || loadedFormat != format {
+		t.Errorf("loaded %v in %+v, want %v in %+v", loaded, loadedFormat, data, format)
+	}
+}
+
+func TestCheckNotSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on Windows")
+	}
+	// The temporary directory itself may be under a symlink, such as /var on macOS.
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(dir, "target")
+	if err := os.MkdirAll(filepath.Join(target, "sub"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(target, "file.txt"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, filepath.Join(dir, "linked-dir")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(target, "file.txt"), filepath.Join(dir, "linked.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"target/file.txt", "target/new.txt", "target/sub/new.txt", "new.txt"} {
+		if err := CheckNotSymlink(filepath.Join(dir, name)); err != nil {
+			t.Errorf("CheckNotSymlink(%s) = %v", name, err)
+		}
+	}
+	// A symlinked grandparent directory is refused as well as a symlinked file or parent.
+	for _, name := range []string{"linked.txt", "linked-dir/file.txt", "linked-dir/new.txt", "linked-dir/sub/new.txt"} {
+		if err := CheckNotSymlink(filepath.Join(dir, name)); !errors.Is(err, ErrSymlink) {
+			t.Errorf("CheckNotSymlink(%s) = %v, want ErrSymlink", name, err)
+		}
+	}
+}
+
+func TestSaveReportToJSONPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix permissions")
+	}
+	filename := filepath.Join(t.TempDir(), "report.json")
+	if err := SaveReportToJSON(filename, ReportJSON{AudioHash: "00"}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("report permissions = %v, want 0600", perm)
+	}
+}
+
+func TestSaveParamsToJSONPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix permissions")
+	}
+	filename := filepath.Join(t.TempDir(), "params.json")
+	if err := SaveParamsToJSON(filename, ParamsJSON{Scheme: 1, SeedType: "bip39"}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("parameters permissions = %v, want 0600", perm)
+	}
+}
@@ -0,0 +1,130 @@
+// aeb/generator.go
+
+// Package aeb generates BIP-39 mnemonics from audio mixed with system entropy, as the audio-entropy-bip39
+// command does by default, for programs that record or read the audio themselves.
+package aeb
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gianlucamazza/audio-entropy-bip39/internal/crypto"
+)
+
+// Orders of the generated entropy and the audio hash in the combined data, as with the -order flag.
+const (
+	OrderRNGFirst   = "rng-first"
+	OrderAudioFirst = "audio-first"
+)
+
+// Truncate modes of the mnemonics shorter than 24 words, as with the -truncate-mode flag.
+const (
+	TruncateModeTruncate = crypto.TruncateModeTruncate
+	TruncateModeHKDF     = crypto.TruncateModeHKDF
+)
+
+// entropyBits is the size of the entropy drawn from Rand for each mnemonic.
+const entropyBits = 256
+
+// ErrInvalidGenerator indicates a Generator whose fields are out of range.
+var ErrInvalidGenerator = errors.New("invalid generator")
+
+// Generator generates mnemonics from the SHA-256 hash of audio data combined with entropy read from Rand. Its
+// fields match the flags of the command of the same name, and NewGenerator sets them to the defaults of the
+// command, so that the same entropy and audio give the same mnemonic with both.
+type Generator struct {
+	// Rand is the source of the 256 bits of entropy of each mnemonic. Nil means crypto/rand.
+	Rand io.Reader
+	// SchemeVersion is the version of the mixing scheme (see -scheme-version); 0 is the legacy untagged scheme.
+	SchemeVersion int
+	// Personalization separates the mnemonics of an application from the others (see -personalize).
+	Personalization string
+	// HashRounds is the number of SHA-256 rounds applied to the combined data, at least 1.
+	HashRounds int
+	// Order is the order of the entropy and the audio hash in the combined data, OrderRNGFirst or OrderAudioFirst.
+	Order string
+	// Words is the number of words of the mnemonic: 12, 15, 18, 21 or 24.
+	Words int
+	// TruncateMode is how mnemonics shorter than 24 words take their entropy, TruncateModeTruncate or
+	// TruncateModeHKDF.
+	TruncateMode string
+}
+
+// NewGenerator returns a Generator with the defaults of the command, drawing its entropy from crypto/rand.
+func NewGenerator() *Generator {
+	return &Generator{
+		SchemeVersion: crypto.SchemeVersion,
+		HashRounds:    1,
+		Order:         OrderRNGFirst,
+		Words:         24,
+		TruncateMode:  TruncateModeTruncate,
+	}
+}
+
+// Validate checks that the fields of the generator are in range.
+func (g *Generator) Validate() error {
+	if err := crypto.ValidateSchemeVersion(g.SchemeVersion); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidGenerator, err)
+	}
+	if strings.ContainsRune(g.Personalization, 0) {
+		return fmt.Errorf("%w: the personalization must not contain NUL characters", ErrInvalidGenerator)
+	}
+	if g.HashRounds < 1 {
+		return fmt.Errorf("%w: %d hash rounds, must be at least 1", ErrInvalidGenerator, g.HashRounds)
+	}
+	if g.Order != OrderRNGFirst && g.Order != OrderAudioFirst {
+		return fmt.Errorf("%w: order %q, must be %q or %q", ErrInvalidGenerator, g.Order, OrderRNGFirst, OrderAudioFirst)
+	}
+	if g.Words < 12 || g.Words > 24 || g.Words%3 != 0 {
+		return fmt.Errorf("%w: %d words, must be 12, 15, 18, 21 or 24", ErrInvalidGenerator, g.Words)
+	}
+	if err := crypto.ValidateTruncateMode(g.TruncateMode); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidGenerator, err)
+	}
+	return nil
+}
+
+// Generate hashes the audio data and generates a mnemonic from it, see GenerateFromHash.
+func (g *Generator) Generate(audioData []byte) (string, error) {
+	return g.GenerateFromHash(crypto.HashAudioData(audioData))
+}
+
+// GenerateFromHash reads 256 bits of entropy from Rand, hashes them with the audio hash, prefixed by the
+// personalized scheme tag, and generates a mnemonic from the combined hash. The entropy is wiped before it
+// returns.
+func (g *Generator) GenerateFromHash(audioHash [32]byte) (string, error) {
+	if err := g.Validate(); err != nil {
+		return "", err
+	}
+	r := g.Rand
+	if r == nil {
+		r = rand.Reader
+	}
+	entropy, err := crypto.GenerateEntropyFrom(r, entropyBits, crypto.DefaultEntropyRetries)
+	if err != nil {
+		return "", fmt.Errorf("error generating entropy: %w", err)
+	}
+	defer crypto.Wipe(entropy)
+
+	first, second := entropy, audioHash[:]
+	if g.Order == OrderAudioFirst {
+		first, second = second, first
+	}
+	schemeTag := crypto.PersonalizeTag(crypto.SchemeTag(g.SchemeVersion), g.Personalization)
+	combined := crypto.CombineAndHashData(schemeTag, first, second)
+	if g.HashRounds > 1 {
+		// The first round is the combining hash itself.
+		combined = crypto.IterateHash(combined[:], g.HashRounds-1)
+	}
+	defer crypto.Wipe(combined[:])
+
+	scheme := crypto.BIP39Scheme{Bits: g.Words / 3 * 32, TruncateMode: g.TruncateMode}
+	mnemonic, err := scheme.Generate(combined[:])
+	if err != nil {
+		return "", fmt.Errorf("error generating mnemonic: %w", err)
+	}
+	return mnemonic, nil
+}
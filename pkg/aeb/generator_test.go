@@ -0,0 +1,108 @@
+// aeb/generator_test.go
+
+package aeb
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/tyler-smith/go-bip39"
+)
+
+// testEntropy is the entropy of the tests, the bytes 0 to 31, in place of crypto/rand.
+func testEntropy() *bytes.Reader {
+	entropy := make([]byte, 32)
+	for i := range entropy {
+		entropy[i] = byte(i)
+	}
+	return bytes.NewReader(entropy)
+}
+
+// generate generates the mnemonic of the test entropy and audio with a default generator changed by configure.
+func generate(t *testing.T, configure func(g *Generator)) string {
+	t.Helper()
+	g := NewGenerator()
+	g.Rand = testEntropy()
+	if configure != nil {
+		configure(g)
+	}
+	mnemonic, err := g.Generate([]byte("recording"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mnemonic
+}
+
+func TestGenerate(t *testing.T) {
+	// SHA-256("aeb/v1" || entropy || SHA-256("recording")), computed independently.
+	combined, _ := hex.DecodeString("403da679ac208e5fb833ce1d260d69cfe4b6e60ac9c6e77b3cdc04a83f3d051d")
+	want, err := bip39.NewMnemonic(combined)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := generate(t, nil); got != want {
+		t.Errorf("Generate = %q, want %q", got, want)
+	}
+
+	// Each setting changes the mnemonic.
+	for name, configure := range map[string]func(g *Generator){
+		"scheme version 0": func(g *Generator) { g.SchemeVersion = 0 },
+		"personalization":  func(g *Generator) { g.Personalization = "my-app" },
+		"hash rounds":      func(g *Generator) { g.HashRounds = 2 },
+		"audio first":      func(g *Generator) { g.Order = OrderAudioFirst },
+	} {
+		if got := generate(t, configure); got == want {
+			t.Errorf("Generate with %s = %q, want another mnemonic", name, got)
+		}
+	}
+
+	// Shorter mnemonics truncate the combined hash, or derive their entropy from it with HKDF.
+	short := generate(t, func(g *Generator) { g.Words = 12 })
+	if words := strings.Fields(short); len(words) != 12 || !bip39.IsMnemonicValid(short) || !strings.HasPrefix(want, strings.Join(words[:11], " ")) {
+		t.Errorf("12-word mnemonic = %q, want the first 128 bits of %q", short, want)
+	}
+	if hkdf := generate(t, func(g *Generator) { g.Words = 12; g.TruncateMode = TruncateModeHKDF }); hkdf == short || !bip39.IsMnemonicValid(hkdf) {
+		t.Errorf("12-word HKDF mnemonic = %q, want a valid mnemonic other than %q", hkdf, short)
+	}
+}
+
+func TestGenerateSystemRandom(t *testing.T) {
+	first, err := NewGenerator().Generate([]byte("recording"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewGenerator().Generate([]byte("recording"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bip39.IsMnemonicValid(first) || first == second {
+		t.Errorf("mnemonics from crypto/rand %q and %q, want two different valid mnemonics", first, second)
+	}
+}
+
+func TestGeneratorValidate(t *testing.T) {
+	for name, configure := range map[string]func(g *Generator){
+		"scheme version": func(g *Generator) { g.SchemeVersion = 99 },
+		"NUL":            func(g *Generator) { g.Personalization = "a\x00b" },
+		"hash rounds":    func(g *Generator) { g.HashRounds = 0 },
+		"order":          func(g *Generator) { g.Order = "" },
+		"words":          func(g *Generator) { g.Words = 13 },
+		"truncate mode":  func(g *Generator) { g.TruncateMode = "round" },
+	} {
+		g := NewGenerator()
+		g.Rand = testEntropy()
+		configure(g)
+		if _, err := g.Generate([]byte("recording")); !errors.Is(err, ErrInvalidGenerator) {
+			t.Errorf("Generate with an invalid %s = %v, want ErrInvalidGenerator", name, err)
+		}
+	}
+
+	g := NewGenerator()
+	g.Rand = bytes.NewReader(make([]byte, 16))
+	if _, err := g.Generate([]byte("recording")); err == nil {
+		t.Error("Generate with 128 bits of entropy succeeded, want an error")
+	}
+}